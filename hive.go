@@ -127,6 +127,9 @@ func main() {
 	}
 }
 
+// simOutputDir is the path of the log directory in the simulator container.
+const simOutputDir = "/hive-output"
+
 type simRunner struct {
 	inv       libhive.Inventory
 	container libhive.ContainerBackend
@@ -212,6 +215,7 @@ func (r *simRunner) runSimulations(ctx context.Context, simList []string) error
 
 func (r *simRunner) runSimulatorAPIDevMode(ctx context.Context, endpoint string) error {
 	tm := libhive.NewTestManager(r.env, r.container, -1)
+	tm.SetBuilder(r.builder)
 	defer func() {
 		if err := tm.Terminate(); err != nil {
 			log15.Error("could not terminate test manager", "error", err)
@@ -231,6 +235,9 @@ func (r *simRunner) runSimulatorAPIDevMode(ctx context.Context, endpoint string)
 	}
 
 	log15.Info(fmt.Sprintf("simulator API listening at %s", addr))
+	if logDir, err := filepath.Abs(r.env.LogDir); err == nil {
+		log15.Info(fmt.Sprintf("set HIVE_OUTPUT_DIR=%s to write test output files", logDir))
+	}
 	server := &http.Server{Handler: tm.API()}
 	defer shutdownServer(server)
 
@@ -250,6 +257,7 @@ func (r *simRunner) run(ctx context.Context, sim string) error {
 
 	// Start the simulation API.
 	tm := libhive.NewTestManager(r.env, r.container, -1)
+	tm.SetBuilder(r.builder)
 	defer func() {
 		if err := tm.Terminate(); err != nil {
 			log15.Error("could not terminate test manager", "error", err)
@@ -262,13 +270,20 @@ func (r *simRunner) run(ctx context.Context, sim string) error {
 	}
 	defer shutdownServer(server)
 
-	// Create the simulator container.
+	// Create the simulator container. The log directory is mounted into it,
+	// so the simulator can write test output files.
+	logDir, err := filepath.Abs(r.env.LogDir)
+	if err != nil {
+		return err
+	}
 	opts := libhive.ContainerOptions{
 		Env: map[string]string{
 			"HIVE_SIMULATOR":   "http://" + addr.String(),
 			"HIVE_PARALLELISM": strconv.Itoa(r.env.SimParallelism),
 			"HIVE_LOGLEVEL":    strconv.Itoa(r.env.SimLogLevel),
+			"HIVE_OUTPUT_DIR":  simOutputDir,
 		},
+		Mounts: []libhive.Mount{{HostDir: logDir, Target: simOutputDir}},
 	}
 	if r.env.SimTestLimit != 0 {
 		opts.Env["HIVE_SIMLIMIT"] = strconv.Itoa(r.env.SimTestLimit)
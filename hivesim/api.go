@@ -0,0 +1,39 @@
+package hivesim
+
+import (
+	"net"
+)
+
+// API is the set of simulation API operations used by most simulators. Simulation is
+// the implementation provided by this package.
+//
+// Simulator code which accepts an API instead of *Simulation can be tested with a fake
+// implementation. Fakes can embed API and override only the methods used by the code
+// under test. For tests which need the exact requests sent to hive, use NewRecording.
+type API interface {
+	// Suites and tests.
+	StartSuite(name, description, simlog string) (SuiteID, error)
+	EndSuite(testSuite SuiteID) error
+	StartTest(testSuite SuiteID, name string, description string) (TestID, error)
+	EndTest(testSuite SuiteID, test TestID, summaryResult TestResult) error
+
+	// Clients.
+	ClientTypes() ([]*ClientDefinition, error)
+	StartClient(testSuite SuiteID, test TestID, parameters map[string]string, initFiles map[string]string) (string, net.IP, error)
+	StartClientWithOptions(testSuite SuiteID, test TestID, clientType string, options ...StartOption) (string, net.IP, error)
+	StopClient(testSuite SuiteID, test TestID, nodeid string) error
+	PauseClient(testSuite SuiteID, test TestID, nodeid string) error
+	UnpauseClient(testSuite SuiteID, test TestID, nodeid string) error
+	ClientEnodeURL(testSuite SuiteID, test TestID, node string) (string, error)
+	ClientExec(testSuite SuiteID, test TestID, nodeid string, cmd []string) (*ExecInfo, error)
+	ClientExecWithOptions(testSuite SuiteID, test TestID, nodeid string, cmd []string, options ...ExecOption) (*ExecInfo, error)
+
+	// Networks.
+	CreateNetwork(testSuite SuiteID, networkName string) error
+	RemoveNetwork(testSuite SuiteID, network string) error
+	ConnectContainer(testSuite SuiteID, network, containerID string) error
+	DisconnectContainer(testSuite SuiteID, network, containerID string) error
+	ContainerNetworkIP(testSuite SuiteID, network, containerID string) (string, error)
+}
+
+var _ API = (*Simulation)(nil)
@@ -0,0 +1,45 @@
+package hivesim
+
+import (
+	"net"
+	"testing"
+)
+
+// fakeAPI implements the client start of API for testing code which uses it.
+type fakeAPI struct {
+	API
+	started []string
+}
+
+func (f *fakeAPI) StartClientWithOptions(testSuite SuiteID, test TestID, clientType string, options ...StartOption) (string, net.IP, error) {
+	f.started = append(f.started, clientType)
+	return clientType + "-container", net.IPv4(192, 0, 2, 1), nil
+}
+
+// startAll is an example of simulator code accepting the API interface.
+func startAll(api API, suite SuiteID, test TestID, clientTypes []string) ([]string, error) {
+	var ids []string
+	for _, clientType := range clientTypes {
+		id, _, err := api.StartClientWithOptions(suite, test, clientType)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// This test checks that API can be implemented by a fake which overrides some methods.
+func TestAPIFake(t *testing.T) {
+	fake := new(fakeAPI)
+	ids, err := startAll(fake, 1, 2, []string{"client-1", "client-2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 2 || ids[0] != "client-1-container" || ids[1] != "client-2-container" {
+		t.Fatalf("wrong container IDs %v", ids)
+	}
+	if len(fake.started) != 2 {
+		t.Fatalf("wrong started clients %v", fake.started)
+	}
+}
@@ -1,5 +1,13 @@
 package hivesim
 
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
 // SuiteID identifies a test suite context.
 type SuiteID uint32
 
@@ -17,6 +25,132 @@ type ExecInfo struct {
 	Stdout   string `json:"stdout"`
 	Stderr   string `json:"stderr"`
 	ExitCode int    `json:"exitCode"`
+	TimedOut bool   `json:"timedOut,omitempty"`
+}
+
+// ClientStopStatus is the state of a client before it was stopped.
+type ClientStopStatus struct {
+	// Running is true if the client was running when it was stopped. It is false when
+	// the client process had already exited on its own, e.g. because it crashed.
+	Running bool `json:"running"`
+	// ExitCode is the exit code of the client process if it had already exited.
+	ExitCode int `json:"exitCode"`
+}
+
+// ExitEvent is sent by WatchClient when a client exits.
+type ExitEvent struct {
+	// ExitCode is the exit code of the client process.
+	ExitCode int
+	// Err is set if the state of the client could not be checked, e.g. because the
+	// client was stopped by the simulation. ExitCode is not valid in this case.
+	Err error
+}
+
+// NodeInfo describes a running client.
+type NodeInfo struct {
+	ID   string `json:"id"`   // container ID
+	Type string `json:"name"` // client type
+	IP   net.IP `json:"ip"`
+}
+
+// ContainerErrors is returned by operations on multiple clients when the operation
+// failed for some of them. It maps container IDs to errors.
+type ContainerErrors map[string]error
+
+func (errs ContainerErrors) Error() string {
+	ids := make([]string, 0, len(errs))
+	for id := range errs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	msgs := make([]string, len(ids))
+	for i, id := range ids {
+		msgs[i] = fmt.Sprintf("%s: %v", id, errs[id])
+	}
+	return fmt.Sprintf("%d clients failed: %s", len(ids), strings.Join(msgs, "; "))
+}
+
+// ClientStartSpec describes a client started by StartClients.
+type ClientStartSpec struct {
+	Type    string
+	Options []StartOption
+}
+
+// StartedClient is a running client container.
+type StartedClient struct {
+	Container string           // container ID
+	IP        net.IP           // IP address in the bridge network
+	MAC       net.HardwareAddr // MAC address in the bridge network, if reported by hive
+
+	// StartDuration is the time taken by the start request, measured by the simulator.
+	// This includes uploading client files.
+	StartDuration time.Duration
+	// ServerStartDuration is the time from container creation until the client was
+	// ready, measured by hive. It is zero if hive doesn't report it.
+	ServerStartDuration time.Duration
+}
+
+// StartClientsError is returned by StartClients when some clients could not be started.
+type StartClientsError struct {
+	Errors map[int]error // index of spec -> error
+}
+
+func (err *StartClientsError) Error() string {
+	indexes := make([]int, 0, len(err.Errors))
+	for i := range err.Errors {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	msgs := make([]string, len(indexes))
+	for i, index := range indexes {
+		msgs[i] = fmt.Sprintf("client %d: %v", index, err.Errors[index])
+	}
+	return fmt.Sprintf("%d clients failed to start: %s", len(indexes), strings.Join(msgs, "; "))
+}
+
+// ContainerStats is a resource usage sample of a client container.
+type ContainerStats struct {
+	Time           time.Time `json:"time"`
+	CPUPercent     float64   `json:"cpuPercent"`     // CPU usage, 100% = one core
+	MemoryUsage    uint64    `json:"memoryUsage"`    // in bytes
+	MemoryLimit    uint64    `json:"memoryLimit"`    // in bytes
+	NetworkRxBytes uint64    `json:"networkRxBytes"` // total received on all networks
+	NetworkTxBytes uint64    `json:"networkTxBytes"` // total sent on all networks
+}
+
+// NetworkOptions configures CreateNetworkWithOptions.
+type NetworkOptions struct {
+	// Subnet is the IP range of the network in CIDR notation, e.g. "10.1.0.0/16". If
+	// empty, docker assigns an unused range.
+	Subnet string
+	// Gateway is the IP address of the network gateway. It can only be set together
+	// with Subnet. If empty, docker uses the first address of the subnet.
+	Gateway string
+	// Internal creates a network without external connectivity. Containers on an
+	// internal network can only reach other containers of the network.
+	Internal bool
+}
+
+// ShapeOptions configures ShapeNetwork. Fields left at zero are not applied.
+type ShapeOptions struct {
+	// Latency is the delay added to every packet sent by a client on the network.
+	// Since it applies to both directions, the round-trip time between two clients
+	// increases by twice the latency.
+	Latency time.Duration
+	// Jitter is the random variation of the latency. It requires Latency to be set.
+	Jitter time.Duration
+	// LossPercent is the percentage of packets dropped, between 0 and 100.
+	LossPercent float64
+	// RateLimit is the bandwidth limit of every client on the network in bits per second.
+	RateLimit uint64
+}
+
+// LogsOptions configures ClientLogsWithOptions.
+type LogsOptions struct {
+	// If set, output is streamed until the client exits or the reader is closed.
+	Follow bool
+	// If non-zero, only output produced after this time is returned.
+	Since time.Time
 }
 
 // Params contains client launch parameters.
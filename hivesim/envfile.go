@@ -0,0 +1,101 @@
+package hivesim
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// WithEnvFile adds client parameters from a file in dotenv format. Each line of the file
+// has the form KEY=VALUE. Empty lines and lines starting with '#' are ignored. Values can
+// be quoted with single or double quotes. Double-quoted values support escape sequences
+// like "\n".
+//
+// Like other parameter options, later options override values set by earlier ones. If the
+// file can't be read or contains invalid lines, starting the client fails.
+func WithEnvFile(path string) StartOption {
+	return optionFunc(func(setup *clientSetup) {
+		params, err := readEnvFile(path)
+		if err != nil {
+			setup.setError(err)
+			return
+		}
+		for k, v := range params {
+			setup.parameters[k] = v
+		}
+	})
+}
+
+func readEnvFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	params, err := parseEnvFile(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%v", path, err)
+	}
+	return params, nil
+}
+
+// parseEnvFile parses the content of a dotenv file.
+func parseEnvFile(r io.Reader) (map[string]string, error) {
+	params := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		eq := strings.IndexByte(line, '=')
+		if eq < 0 {
+			return nil, fmt.Errorf("%d: missing '=' in line", lineNum)
+		}
+		key := strings.TrimSpace(line[:eq])
+		if key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("%d: invalid key %q", lineNum, key)
+		}
+		value, err := parseEnvValue(strings.TrimSpace(line[eq+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("%d: %v", lineNum, err)
+		}
+		params[key] = value
+	}
+	return params, scanner.Err()
+}
+
+// parseEnvValue decodes the value part of a dotenv line.
+func parseEnvValue(v string) (string, error) {
+	if v == "" {
+		return "", nil
+	}
+	switch quote := v[0]; quote {
+	case '"', '\'':
+		end := strings.LastIndexByte(v, quote)
+		if end == 0 {
+			return "", fmt.Errorf("unterminated quoted value %s", v)
+		}
+		if rest := strings.TrimSpace(v[end+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+			return "", fmt.Errorf("unexpected characters after quoted value: %s", rest)
+		}
+		if quote == '\'' {
+			return v[1:end], nil
+		}
+		s, err := strconv.Unquote(v[:end+1])
+		if err != nil {
+			return "", fmt.Errorf("invalid quoted value %s", v[:end+1])
+		}
+		return s, nil
+	default:
+		// Unquoted values end at a comment.
+		if i := strings.Index(v, " #"); i >= 0 {
+			v = strings.TrimSpace(v[:i])
+		}
+		return v, nil
+	}
+}
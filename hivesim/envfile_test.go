@@ -0,0 +1,87 @@
+package hivesim
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseEnvFile(t *testing.T) {
+	input := `
+# Network configuration
+HIVE_CHAIN_ID=7
+export HIVE_NETWORK_ID = 8
+HIVE_BOOTNODE="enode://abc@10.0.0.1:30303"
+HIVE_GRAPHQL_ENABLED='true' # enable graphql
+HIVE_EXTRA="a\nb"
+HIVE_SINGLE='no \n escapes'
+HIVE_COMMENTED=1 # comment
+HIVE_EMPTY=
+HIVE_HASH=a#b
+`
+	params, err := parseEnvFile(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"HIVE_CHAIN_ID":        "7",
+		"HIVE_NETWORK_ID":      "8",
+		"HIVE_BOOTNODE":        "enode://abc@10.0.0.1:30303",
+		"HIVE_GRAPHQL_ENABLED": "true",
+		"HIVE_EXTRA":           "a\nb",
+		"HIVE_SINGLE":          `no \n escapes`,
+		"HIVE_COMMENTED":       "1",
+		"HIVE_EMPTY":           "",
+		"HIVE_HASH":            "a#b",
+	}
+	if !reflect.DeepEqual(params, want) {
+		t.Fatalf("wrong params:\ngot  %q\nwant %q", params, want)
+	}
+}
+
+func TestParseEnvFileErrors(t *testing.T) {
+	tests := []struct {
+		input, err string
+	}{
+		{"HIVE_FOO", "1: missing '=' in line"},
+		{"\n=1", "2: invalid key \"\""},
+		{"HIVE FOO=1", "1: invalid key \"HIVE FOO\""},
+		{`HIVE_FOO="abc`, "1: unterminated quoted value \"abc"},
+		{`HIVE_FOO="abc" def`, "1: unexpected characters after quoted value: def"},
+	}
+	for _, test := range tests {
+		_, err := parseEnvFile(strings.NewReader(test.input))
+		if err == nil || err.Error() != test.err {
+			t.Errorf("input %q: wrong error %v, want %q", test.input, err, test.err)
+		}
+	}
+}
+
+func TestWithEnvFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hivesim-envfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "client.env")
+	ioutil.WriteFile(file, []byte("HIVE_FOO=1\nHIVE_BAR=2\n"), 0644)
+
+	setup := &clientSetup{parameters: make(map[string]string)}
+	Bundle(Params{"HIVE_FOO": "0"}, WithEnvFile(file), Params{"HIVE_BAR": "3"}).Apply(setup)
+	if setup.err != nil {
+		t.Fatal(setup.err)
+	}
+	want := map[string]string{"HIVE_FOO": "1", "HIVE_BAR": "3"}
+	if !reflect.DeepEqual(setup.parameters, want) {
+		t.Fatalf("wrong params %v, want %v", setup.parameters, want)
+	}
+
+	setup = &clientSetup{parameters: make(map[string]string)}
+	WithEnvFile(filepath.Join(dir, "missing.env")).Apply(setup)
+	if !os.IsNotExist(setup.err) {
+		t.Fatalf("wrong error for missing file: %v", setup.err)
+	}
+}
@@ -2,6 +2,10 @@ package hivesim
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,57 +14,227 @@ import (
 	"mime/multipart"
 	"net"
 	"net/http"
+	"net/textproto"
 	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
 )
 
+// defaultHTTPClient is used for API requests when no client is set using SetHTTPClient.
+var defaultHTTPClient = http.DefaultClient
+
 // Simulation wraps the simulation HTTP API provided by hive.
+//
+// A Simulation is safe for concurrent use by multiple goroutines. Simulators running
+// tests in parallel should share a single instance. Call Close when the simulation is
+// no longer needed.
 type Simulation struct {
 	url string
+
+	// These are set by SetHTTPClient, SetRetryPolicy, SetLogger and SetRequestHook.
+	mu     sync.RWMutex
+	client *http.Client
+	retry  retryPolicy
+	logger Logger
+	hook   RequestHook
+	closed bool
+
+	// outputDir is the log directory of hive in the simulator container.
+	outputDir string
+
+	// ClientTypes caches the client list, which doesn't change during a run.
+	clientTypesMu sync.Mutex
+	clientTypes   []*ClientDefinition
 }
 
 // New looks up the hive host URI using the HIVE_SIMULATOR environment variable
-// and connects to it. It will panic if HIVE_SIMULATOR is not set.
+// and connects to it. It will panic if HIVE_SIMULATOR is not set or invalid.
+// Use NewFromEnv to handle these errors.
 func New() *Simulation {
+	sim, err := NewFromEnv()
+	if err != nil {
+		panic(err)
+	}
+	return sim
+}
+
+// NewFromEnv is like New, but returns an error when the HIVE_SIMULATOR environment
+// variable is not set or does not contain a valid URL. Tools which can run both inside
+// and outside of hive can use this to detect whether the hive API is available.
+func NewFromEnv() (*Simulation, error) {
 	simulator, isSet := os.LookupEnv("HIVE_SIMULATOR")
 	if !isSet {
-		panic("HIVE_SIMULATOR environment variable not set")
+		return nil, errors.New("HIVE_SIMULATOR environment variable not set")
+	}
+	apiURL, err := parseAPIURL(simulator)
+	if err != nil {
+		return nil, fmt.Errorf("invalid HIVE_SIMULATOR environment variable: %v", err)
 	}
-	return &Simulation{url: simulator}
+	return &Simulation{url: apiURL, outputDir: os.Getenv("HIVE_OUTPUT_DIR")}, nil
 }
 
 // NewAt creates a simulation connected to the given API endpoint. You'll will rarely need
 // to use this. In simulations launched by hive, use New() instead.
+//
+// NewAt panics if url is not an absolute http or https URL.
 func NewAt(url string) *Simulation {
-	return &Simulation{url: url}
+	apiURL, err := parseAPIURL(url)
+	if err != nil {
+		panic(fmt.Sprintf("hivesim.NewAt: %v", err))
+	}
+	return &Simulation{url: apiURL}
 }
 
-// EndTest finishes the test case, cleaning up everything, logging results, and returning
-// an error if the process could not be completed.
-func (sim *Simulation) EndTest(testSuite SuiteID, test TestID, summaryResult TestResult) error {
-	// post results (which deletes the test case - because DELETE message body is not always supported)
-	summaryResultData, err := json.Marshal(summaryResult)
+// endpoint returns the URL of an API endpoint. The path is formatted using fmt.Sprintf
+// and must start with a slash.
+func (sim *Simulation) endpoint(path string, args ...interface{}) string {
+	return strings.TrimRight(sim.url, "/") + fmt.Sprintf(path, args...)
+}
+
+// parseAPIURL validates the URL of the hive API. The result has no trailing slash, so
+// endpoint paths can be appended to it.
+func parseAPIURL(s string) (string, error) {
+	u, err := url.Parse(s)
 	if err != nil {
-		return err
+		return "", err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("%q is not an absolute http or https URL", s)
+	}
+	return strings.TrimRight(s, "/"), nil
+}
+
+// SetHTTPClient configures the HTTP client used for API requests. This can be used to
+// set timeouts, TLS settings or proxies. If client is nil, the default client is used.
+//
+// SetHTTPClient can be called while the simulation is in use. Requests which have
+// already started are not affected.
+func (sim *Simulation) SetHTTPClient(client *http.Client) {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	sim.client = client
+}
+
+// SetTLSConfig configures TLS for requests to an https:// API endpoint, e.g. to trust
+// an internal CA using config.RootCAs. The config is ignored for http:// endpoints.
+//
+// SetTLSConfig keeps the settings of the client set by SetHTTPClient, but replaces its
+// transport with a copy of http.DefaultTransport using the given config.
+func (sim *Simulation) SetTLSConfig(config *tls.Config) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = config
+
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	client := new(http.Client)
+	if sim.client != nil {
+		*client = *sim.client
+	}
+	client.Transport = transport
+	sim.client = client
+}
+
+// httpClient returns the HTTP client used for API requests.
+func (sim *Simulation) httpClient() *http.Client {
+	sim.mu.RLock()
+	defer sim.mu.RUnlock()
+	if sim.client != nil {
+		return sim.client
+	}
+	return defaultHTTPClient
+}
+
+// ErrClosed is returned for requests made after the simulation was closed.
+var ErrClosed = errors.New("hivesim: simulation is closed")
+
+// Close releases the resources of the simulation. It closes idle connections of the HTTP
+// client. Requests made after Close fail with ErrClosed, while requests which have
+// already started are not affected. Calling Close more than once has no effect.
+func (sim *Simulation) Close() error {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	if sim.closed {
+		return nil
+	}
+	sim.closed = true
+	client := sim.client
+	if client == nil {
+		client = defaultHTTPClient
+	}
+	client.CloseIdleConnections()
+	return nil
+}
+
+// do sends an API request.
+func (sim *Simulation) do(req *http.Request) (*http.Response, error) {
+	sim.mu.RLock()
+	closed := sim.closed
+	sim.mu.RUnlock()
+	if closed {
+		return nil, ErrClosed
+	}
+
+	start := time.Now()
+	resp, err := sim.httpClient().Do(req)
+	sim.logRequest(req, resp, err, time.Since(start))
+	return resp, err
+}
+
+// Ping checks that the hive API is reachable and responds correctly. Simulators can call
+// this before running a suite to fail early when hive is not available. Unlike other
+// requests, Ping does not retry on failure.
+func (sim *Simulation) Ping(ctx context.Context) error {
+	body, err := sim.requestOnce(ctx, http.MethodGet, sim.endpoint("/clients"))
+	if err != nil {
+		return fmt.Errorf("hive API at %s is not reachable: %w", sim.url, err)
 	}
+	var clients []json.RawMessage
+	if err := json.Unmarshal([]byte(body), &clients); err != nil {
+		return fmt.Errorf("hive API at %s sent invalid response: %v", sim.url, err)
+	}
+	return nil
+}
 
-	vals := make(url.Values)
-	vals.Add("summaryresult", string(summaryResultData))
+// EndTest finishes the test case, cleaning up everything, logging results, and returning
+// an error if the process could not be completed.
+func (sim *Simulation) EndTest(testSuite SuiteID, test TestID, summaryResult TestResult) error {
+	return sim.EndTestContext(context.Background(), testSuite, test, summaryResult)
+}
 
-	_, err = wrapHTTPErrorsPost(fmt.Sprintf("%s/testsuite/%d/test/%d", sim.url, testSuite, test), vals)
+// EndTestContext is like EndTest, but the request can be cancelled using ctx.
+//
+// Ending a test also stops its clients, which can take a while. Setting a deadline on ctx
+// prevents teardown from hanging when hive is unresponsive. If the request is aborted by
+// ctx, the returned error wraps ctx.Err().
+func (sim *Simulation) EndTestContext(ctx context.Context, testSuite SuiteID, test TestID, summaryResult TestResult) error {
+	// post results (which deletes the test case - because DELETE message body is not always supported)
+	request := struct {
+		SummaryResult TestResult `json:"summaryresult"`
+	}{summaryResult}
+	_, err := sim.postJSON(ctx, sim.endpoint("/testsuite/%d/test/%d", testSuite, test), request)
 	return err
 }
 
 // StartSuite signals the start of a test suite.
 func (sim *Simulation) StartSuite(name, description, simlog string) (SuiteID, error) {
-	vals := make(url.Values)
-	vals.Add("name", name)
-	vals.Add("description", description)
-	vals.Add("simlog", simlog)
-	idstring, err := wrapHTTPErrorsPost(fmt.Sprintf("%s/testsuite", sim.url), vals)
+	return sim.StartSuiteContext(context.Background(), name, description, simlog)
+}
+
+// StartSuiteContext is like StartSuite, but the request can be cancelled using ctx.
+func (sim *Simulation) StartSuiteContext(ctx context.Context, name, description, simlog string) (SuiteID, error) {
+	request := struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		SimLog      string `json:"simlog"`
+	}{name, description, simlog}
+	idstring, err := sim.postJSON(ctx, sim.endpoint("/testsuite"), request)
 	if err != nil {
 		return 0, err
 	}
@@ -73,21 +247,41 @@ func (sim *Simulation) StartSuite(name, description, simlog string) (SuiteID, er
 
 // EndSuite signals the end of a test suite.
 func (sim *Simulation) EndSuite(testSuite SuiteID) error {
-	req, err := http.NewRequest(http.MethodDelete, fmt.Sprintf("%s/testsuite/%d", sim.url, testSuite), nil)
-	if err != nil {
-		return err
-	}
-	_, err = http.DefaultClient.Do(req)
+	return sim.EndSuiteContext(context.Background(), testSuite)
+}
+
+// EndSuiteContext is like EndSuite, but the request can be cancelled using ctx.
+func (sim *Simulation) EndSuiteContext(ctx context.Context, testSuite SuiteID) error {
+	_, err := sim.request(ctx, http.MethodDelete, sim.endpoint("/testsuite/%d", testSuite))
 	return err
 }
 
 // StartTest starts a new test case, returning the testcase id as a context identifier.
 func (sim *Simulation) StartTest(testSuite SuiteID, name string, description string) (TestID, error) {
-	vals := make(url.Values)
-	vals.Add("name", name)
-	vals.Add("description", description)
+	return sim.StartTestContext(context.Background(), testSuite, name, description)
+}
+
+// StartTestContext is like StartTest, but the request can be cancelled using ctx.
+func (sim *Simulation) StartTestContext(ctx context.Context, testSuite SuiteID, name string, description string) (TestID, error) {
+	return sim.StartTestWithOptionsContext(ctx, testSuite, name, description, nil)
+}
+
+// StartTestWithOptions is like StartTest, but also assigns labels to the test, e.g.
+// {"category": "slow"}. Labels are stored with the test result, so result viewers and
+// scripts can filter and group tests by them.
+func (sim *Simulation) StartTestWithOptions(testSuite SuiteID, name, description string, labels map[string]string) (TestID, error) {
+	return sim.StartTestWithOptionsContext(context.Background(), testSuite, name, description, labels)
+}
 
-	idstring, err := wrapHTTPErrorsPost(fmt.Sprintf("%s/testsuite/%d/test", sim.url, testSuite), vals)
+// StartTestWithOptionsContext is like StartTestWithOptions, but the request can be
+// cancelled using ctx.
+func (sim *Simulation) StartTestWithOptionsContext(ctx context.Context, testSuite SuiteID, name, description string, labels map[string]string) (TestID, error) {
+	request := struct {
+		Name        string            `json:"name"`
+		Description string            `json:"description"`
+		Labels      map[string]string `json:"labels,omitempty"`
+	}{name, description, labels}
+	idstring, err := sim.postJSON(ctx, sim.endpoint("/testsuite/%d/test", testSuite), request)
 	if err != nil {
 		return 0, err
 	}
@@ -100,7 +294,9 @@ func (sim *Simulation) StartTest(testSuite SuiteID, name string, description str
 
 // ClientMetadata is part of the ClientDefinition and lists metadata
 type ClientMetadata struct {
-	Roles []string `yaml:"roles" json:"roles"`
+	Roles []string          `yaml:"roles" json:"roles"`
+	Info  map[string]string `yaml:"info" json:"info,omitempty"`
+	Ports []int             `yaml:"ports" json:"ports,omitempty"`
 }
 
 // ClientDefinition is served by the /clients API endpoint to list the available clients
@@ -121,236 +317,1656 @@ func (m *ClientDefinition) HasRole(role string) bool {
 
 // ClientTypes returns all client types available to this simulator run. This depends on
 // both the available client set and the command line filters.
+//
+// The client list is fetched from hive once and cached for subsequent calls.
+// Use ClientTypesRefresh to fetch it again.
 func (sim *Simulation) ClientTypes() (availableClients []*ClientDefinition, err error) {
-	resp, err := http.Get(fmt.Sprintf("%s/clients?metadata=1", sim.url))
+	return sim.ClientTypesContext(context.Background())
+}
+
+// ClientTypesContext is like ClientTypes, but the request can be cancelled using ctx.
+func (sim *Simulation) ClientTypesContext(ctx context.Context) (availableClients []*ClientDefinition, err error) {
+	sim.clientTypesMu.Lock()
+	defer sim.clientTypesMu.Unlock()
+
+	if sim.clientTypes == nil {
+		if err := sim.fetchClientTypes(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return sim.copyClientTypes(), nil
+}
+
+// ClientTypesWithRole returns the available client types which have the given role.
+func (sim *Simulation) ClientTypesWithRole(role string) ([]*ClientDefinition, error) {
+	return sim.ClientTypesMatching(func(def *ClientDefinition) bool {
+		return def.HasRole(role)
+	})
+}
+
+// ClientTypesMatching returns the available client types for which match returns true.
+func (sim *Simulation) ClientTypesMatching(match func(*ClientDefinition) bool) ([]*ClientDefinition, error) {
+	clients, err := sim.ClientTypes()
 	if err != nil {
 		return nil, err
 	}
-	body, err := ioutil.ReadAll(resp.Body)
+	matching := make([]*ClientDefinition, 0, len(clients))
+	for _, def := range clients {
+		if match(def) {
+			matching = append(matching, def)
+		}
+	}
+	return matching, nil
+}
+
+// ClientTypesRefresh is like ClientTypes, but always fetches the client list from hive.
+func (sim *Simulation) ClientTypesRefresh() ([]*ClientDefinition, error) {
+	return sim.ClientTypesRefreshContext(context.Background())
+}
+
+// ClientTypesRefreshContext is like ClientTypesRefresh, but the request can be cancelled
+// using ctx.
+func (sim *Simulation) ClientTypesRefreshContext(ctx context.Context) ([]*ClientDefinition, error) {
+	sim.clientTypesMu.Lock()
+	defer sim.clientTypesMu.Unlock()
+
+	if err := sim.fetchClientTypes(ctx); err != nil {
+		return nil, err
+	}
+	return sim.copyClientTypes(), nil
+}
+
+// fetchClientTypes gets the client list and stores it in the cache.
+// This must be called with clientTypesMu held.
+func (sim *Simulation) fetchClientTypes(ctx context.Context) error {
+	body, err := sim.request(ctx, http.MethodGet, sim.endpoint("/clients?metadata=1"))
+	if err != nil {
+		return err
+	}
+	clients := make([]*ClientDefinition, 0)
+	if err := json.Unmarshal([]byte(body), &clients); err != nil {
+		return err
+	}
+	sim.clientTypes = clients
+	return nil
+}
+
+// copyClientTypes returns a copy of the cached client list, so callers can modify the
+// result. This must be called with clientTypesMu held.
+func (sim *Simulation) copyClientTypes() []*ClientDefinition {
+	cpy := make([]*ClientDefinition, len(sim.clientTypes))
+	for i, def := range sim.clientTypes {
+		d := *def
+		cpy[i] = &d
+	}
+	return cpy
+}
+
+// ErrUnknownClient is returned by ClientDefinition, ClientVersion and ClientMetadata when
+// the client type is not available to the simulation.
+var ErrUnknownClient = errors.New("unknown client type")
+
+// ClientVersion returns the version string of a client type.
+func (sim *Simulation) ClientVersion(clientType string) (string, error) {
+	return sim.ClientVersionContext(context.Background(), clientType)
+}
+
+// ClientVersionContext is like ClientVersion, but the request can be cancelled using ctx.
+func (sim *Simulation) ClientVersionContext(ctx context.Context, clientType string) (string, error) {
+	def, err := sim.ClientDefinitionContext(ctx, clientType)
+	if err != nil {
+		return "", err
+	}
+	return def.Version, nil
+}
+
+// ClientMetadata returns build information of a client type, e.g. the git commit it was
+// built from. The result contains the "info" entries of the client's hive.yaml and the
+// client version under the "version" key.
+func (sim *Simulation) ClientMetadata(clientType string) (map[string]string, error) {
+	return sim.ClientMetadataContext(context.Background(), clientType)
+}
+
+// ClientMetadataContext is like ClientMetadata, but the request can be cancelled using
+// ctx.
+func (sim *Simulation) ClientMetadataContext(ctx context.Context, clientType string) (map[string]string, error) {
+	def, err := sim.ClientDefinitionContext(ctx, clientType)
+	if err != nil {
+		return nil, err
+	}
+	meta := make(map[string]string, len(def.Meta.Info)+1)
+	for k, v := range def.Meta.Info {
+		meta[k] = v
+	}
+	if def.Version != "" {
+		meta["version"] = def.Version
+	}
+	return meta, nil
+}
+
+// ClientPorts returns the TCP ports served by a client type, as declared in its hive.yaml.
+// The result is empty if the client does not declare its ports. The client list is
+// cached like in ClientTypes. If the client type is not available, the returned error
+// wraps ErrUnknownClient.
+func (sim *Simulation) ClientPorts(clientType string) ([]int, error) {
+	return sim.ClientPortsContext(context.Background(), clientType)
+}
+
+// ClientPortsContext is like ClientPorts, but the request can be cancelled using ctx.
+func (sim *Simulation) ClientPortsContext(ctx context.Context, clientType string) ([]int, error) {
+	def, err := sim.ClientDefinitionContext(ctx, clientType)
 	if err != nil {
 		return nil, err
 	}
+	return append([]int(nil), def.Meta.Ports...), nil
+}
+
+// ClientDefinition returns the definition of a client type, including its metadata.
+// The client list is cached like in ClientTypes. If the client type is not available,
+// the returned error wraps ErrUnknownClient.
+func (sim *Simulation) ClientDefinition(clientType string) (*ClientDefinition, error) {
+	return sim.ClientDefinitionContext(context.Background(), clientType)
+}
 
-	err = json.Unmarshal(body, &availableClients)
+// ClientDefinitionContext is like ClientDefinition, but the request can be cancelled
+// using ctx.
+func (sim *Simulation) ClientDefinitionContext(ctx context.Context, clientType string) (*ClientDefinition, error) {
+	clients, err := sim.ClientTypesContext(ctx)
 	if err != nil {
 		return nil, err
 	}
-	return
+	for _, def := range clients {
+		if def.Name == clientType {
+			return def, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownClient, clientType)
 }
 
+// ErrStartTimeout is returned when starting a client fails because the client did not
+// start within the timeout. See WithStartTimeout.
+var ErrStartTimeout = errors.New("client start timed out")
+
 // StartClient starts a new node (or other container) with the specified parameters. One
 // parameter must be named CLIENT and should contain one of the client types from
 // GetClientTypes. The input is used as environment variables in the new container.
 // Returns container id and ip.
 func (sim *Simulation) StartClient(testSuite SuiteID, test TestID, parameters map[string]string, initFiles map[string]string) (string, net.IP, error) {
+	return sim.StartClientContext(context.Background(), testSuite, test, parameters, initFiles)
+}
+
+// StartClientContext is like StartClient, but the request can be cancelled using ctx.
+func (sim *Simulation) StartClientContext(ctx context.Context, testSuite SuiteID, test TestID, parameters map[string]string, initFiles map[string]string) (string, net.IP, error) {
 	clientType, ok := parameters["CLIENT"]
 	if !ok {
 		return "", nil, errors.New("missing 'CLIENT' parameter")
 	}
-	return sim.StartClientWithOptions(testSuite, test, clientType, Params(parameters), WithStaticFiles(initFiles))
+	return sim.StartClientWithOptionsContext(ctx, testSuite, test, clientType, Params(parameters), WithStaticFiles(initFiles))
 }
 
 // StartClientWithOptions starts a new node (or other container) with specified options.
-// Returns container id and ip.
+// Returns container id and ip. Use StartClientWithInfo to get the result as a
+// StartedClient, which also contains further information about the client.
+//
+// The client type is always given by clientType. Options may set the CLIENT parameter
+// only to the same value, a conflicting CLIENT parameter is an error.
 func (sim *Simulation) StartClientWithOptions(testSuite SuiteID, test TestID, clientType string, options ...StartOption) (string, net.IP, error) {
+	return sim.StartClientWithOptionsContext(context.Background(), testSuite, test, clientType, options...)
+}
+
+// StartClientWithOptionsContext is like StartClientWithOptions, but the request can be
+// cancelled using ctx.
+func (sim *Simulation) StartClientWithOptionsContext(ctx context.Context, testSuite SuiteID, test TestID, clientType string, options ...StartOption) (string, net.IP, error) {
+	c, err := sim.startClient(ctx, testSuite, test, clientType, options)
+	return c.Container, c.IP, err
+}
+
+// StartClientWithInfo is like StartClientWithOptions, but also returns timing
+// information about the client start. This can be used to track the bring-up latency
+// of client types.
+func (sim *Simulation) StartClientWithInfo(testSuite SuiteID, test TestID, clientType string, options ...StartOption) (*StartedClient, error) {
+	return sim.StartClientWithInfoContext(context.Background(), testSuite, test, clientType, options...)
+}
+
+// StartClientWithInfoContext is like StartClientWithInfo, but the request can be
+// cancelled using ctx.
+func (sim *Simulation) StartClientWithInfoContext(ctx context.Context, testSuite SuiteID, test TestID, clientType string, options ...StartOption) (*StartedClient, error) {
+	c, err := sim.startClient(ctx, testSuite, test, clientType, options)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// startDurationHeader is the response header containing the time taken by hive to
+// start the client.
+const startDurationHeader = "X-HIVE-START-DURATION"
+
+// startClient starts a client. On error, the container ID is still returned if the
+// client was started but the response couldn't be parsed.
+func (sim *Simulation) startClient(ctx context.Context, testSuite SuiteID, test TestID, clientType string, options []StartOption) (StartedClient, error) {
 	setup := &clientSetup{
 		parameters: make(map[string]string),
 		files:      make(map[string]func() (io.ReadCloser, error)),
 	}
+	if clientType == "" {
+		return StartedClient{}, errors.New("empty client type")
+	}
 	setup.parameters["CLIENT"] = clientType
 	for _, opt := range options {
 		opt.Apply(setup)
 	}
-	data, err := setup.postWithFiles(fmt.Sprintf("%s/testsuite/%d/test/%d/node", sim.url, testSuite, test))
-	if err != nil {
-		return "", nil, err
+	if setup.err != nil {
+		return StartedClient{}, setup.err
 	}
-	if idip := strings.Split(data, "@"); len(idip) >= 1 {
-		return idip[0], net.ParseIP(idip[1]), nil
+	if p := setup.parameters["CLIENT"]; p != clientType {
+		return StartedClient{}, fmt.Errorf("CLIENT parameter %q conflicts with client type %q", p, clientType)
 	}
-	return data, net.IP{}, fmt.Errorf("no ip address returned: %v", data)
-}
-
-// StopClient signals to the host that the node is no longer required.
-func (sim *Simulation) StopClient(testSuite SuiteID, test TestID, nodeid string) error {
-	req, err := http.NewRequest(http.MethodDelete, fmt.Sprintf("%s/testsuite/%d/test/%d/node/%s", sim.url, testSuite, test, nodeid), nil)
-	if err != nil {
+	startCtx := ctx
+	if setup.startTimeout > 0 {
+		var cancel context.CancelFunc
+		startCtx, cancel = context.WithTimeout(ctx, setup.startTimeout)
+		defer cancel()
+	}
+	var (
+		data   string
+		header http.Header
+		start  = time.Now()
+	)
+	post := func() (err error) {
+		data, header, err = setup.postWithFiles(startCtx, sim.do, sim.endpoint("/testsuite/%d/test/%d/node", testSuite, test))
 		return err
 	}
-	_, err = http.DefaultClient.Do(req)
-	return err
-}
-
-// ClientEnodeURL returns the enode URL of a running client.
-func (sim *Simulation) ClientEnodeURL(testSuite SuiteID, test TestID, node string) (string, error) {
-	resp, err := http.Get(fmt.Sprintf("%s/testsuite/%d/test/%d/node/%s", sim.url, testSuite, test, node))
-	if err != nil {
-		return "", err
+	var err error
+	if setup.singleUse {
+		// Readers given to WithFileReader are consumed by the first attempt.
+		err = post()
+	} else {
+		err = sim.withRetry(startCtx, post)
 	}
-	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return "", err
+		var httpErr *HTTPError
+		if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusGatewayTimeout {
+			return StartedClient{}, fmt.Errorf("%w: %v", ErrStartTimeout, err)
+		}
+		if ctx.Err() == nil && startCtx.Err() == context.DeadlineExceeded {
+			return StartedClient{}, fmt.Errorf("%w: %v", ErrStartTimeout, err)
+		}
+		return StartedClient{}, err
 	}
-	res := strings.TrimRight(string(body), "\r\n")
-	return res, nil
+	c := StartedClient{StartDuration: time.Since(start)}
+	if d, err := time.ParseDuration(header.Get(startDurationHeader)); err == nil {
+		c.ServerStartDuration = d
+	}
+	// The response is <id>@<ip>@<mac>.
+	if idip := strings.Split(data, "@"); len(idip) >= 2 {
+		c.Container = idip[0]
+		if idip[1] == "" && setup.noDefaultNetwork {
+			return c, nil // no IP without the bridge network
+		}
+		if c.IP = net.ParseIP(idip[1]); c.IP == nil {
+			return c, fmt.Errorf("malformed client start response, invalid IP address in %q", data)
+		}
+		if len(idip) >= 3 {
+			c.MAC, _ = net.ParseMAC(idip[2]) // optional, older hive versions don't send it
+		}
+		return c, nil
+	}
+	c.Container, c.IP = data, net.IP{}
+	return c, fmt.Errorf("malformed client start response, no IP address in %q", data)
 }
 
-// ClientExec runs a command in a running client.
-func (sim *Simulation) ClientExec(testSuite SuiteID, test TestID, nodeid string, cmd []string) (*ExecInfo, error) {
-	type execRequest struct {
-		Command []string `json:"command"`
-	}
-	enc, _ := json.Marshal(&execRequest{cmd})
+// Nodes returns the running clients of a test, including clients which were not started
+// by the caller. The result is ordered by client start time.
+func (sim *Simulation) Nodes(testSuite SuiteID, test TestID) ([]NodeInfo, error) {
+	return sim.NodesContext(context.Background(), testSuite, test)
+}
 
-	p := fmt.Sprintf("%s/testsuite/%d/test/%d/node/%s/exec", sim.url, testSuite, test, nodeid)
-	req, err := http.NewRequest(http.MethodPost, p, bytes.NewReader(enc))
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("content-type", "application/json")
-	resp, err := http.DefaultClient.Do(req)
+// NodesContext is like Nodes, but the request can be cancelled using ctx.
+func (sim *Simulation) NodesContext(ctx context.Context, testSuite SuiteID, test TestID) ([]NodeInfo, error) {
+	body, err := sim.request(ctx, http.MethodGet, sim.endpoint("/testsuite/%d/test/%d/node", testSuite, test))
 	if err != nil {
 		return nil, err
 	}
-	if resp.Body == nil {
-		return nil, errors.New("unexpected empty response body")
-	}
-	dec := json.NewDecoder(resp.Body)
-	var res ExecInfo
-	if err := dec.Decode(&res); err != nil {
+	var nodes []NodeInfo
+	if err := json.Unmarshal([]byte(body), &nodes); err != nil {
 		return nil, err
 	}
-	return &res, err
+	return nodes, nil
 }
 
-// CreateNetwork sends a request to the hive server to create a docker network by
-// the given name.
-func (sim *Simulation) CreateNetwork(testSuite SuiteID, networkName string) error {
-	_, err := http.Post(fmt.Sprintf("%s/testsuite/%d/network/%s", sim.url, testSuite, networkName), "application/json", nil)
-	return err
+// startClientsParallelism is the number of concurrent requests made by StartClients and
+// ConnectContainers.
+const startClientsParallelism = 8
+
+// StartClients starts multiple clients concurrently. The returned slice contains the
+// started clients in the order of specs.
+//
+// If some clients fail to start, the error is a *StartClientsError identifying the failed
+// specs. The other clients are still started and returned.
+func (sim *Simulation) StartClients(testSuite SuiteID, test TestID, specs []ClientStartSpec) ([]StartedClient, error) {
+	return sim.StartClientsContext(context.Background(), testSuite, test, specs)
 }
 
-// RemoveNetwork sends a request to the hive server to remove the given network.
-func (sim *Simulation) RemoveNetwork(testSuite SuiteID, network string) error {
-	endpoint := fmt.Sprintf("%s/testsuite/%d/network/%s", sim.url, testSuite, network)
-	req, err := http.NewRequest(http.MethodDelete, endpoint, nil)
-	if err != nil {
-		return err
+// StartClientsContext is like StartClients, but the requests can be cancelled using ctx.
+// When ctx is cancelled, all clients started by the call are stopped again and the
+// context error is returned.
+func (sim *Simulation) StartClientsContext(ctx context.Context, testSuite SuiteID, test TestID, specs []ClientStartSpec) ([]StartedClient, error) {
+	var (
+		clients = make([]StartedClient, len(specs))
+		errs    = make([]error, len(specs))
+		work    = make(chan int)
+		wg      sync.WaitGroup
+	)
+	workers := startClientsParallelism
+	if len(specs) < workers {
+		workers = len(specs)
 	}
-	_, err = http.DefaultClient.Do(req)
-	return err
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				spec := specs[i]
+				c, err := sim.startClient(ctx, testSuite, test, spec.Type, spec.Options)
+				clients[i] = c
+				if err != nil {
+					errs[i] = fmt.Errorf("%s: %w", spec.Type, err)
+				}
+			}
+		}()
+	}
+	for i := range specs {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		// Clients are also stopped if their start response was invalid.
+		for _, c := range clients {
+			if c.Container != "" {
+				sim.StopClient(testSuite, test, c.Container)
+			}
+		}
+		return nil, ctx.Err()
+	}
+	failed := make(map[int]error)
+	for i, err := range errs {
+		if err != nil {
+			failed[i] = err
+		}
+	}
+	if len(failed) > 0 {
+		return clients, &StartClientsError{Errors: failed}
+	}
+	return clients, nil
 }
 
-// ConnectContainer sends a request to the hive server to connect the given
-// container to the given network.
-func (sim *Simulation) ConnectContainer(testSuite SuiteID, network, containerID string) error {
-	endpoint := fmt.Sprintf("%s/testsuite/%d/network/%s/%s", sim.url, testSuite, network, containerID)
-	_, err := http.Post(endpoint, "application/json", nil)
-	return err
+// StopClient signals to the host that the node is no longer required.
+func (sim *Simulation) StopClient(testSuite SuiteID, test TestID, nodeid string) error {
+	return sim.StopClientContext(context.Background(), testSuite, test, nodeid)
 }
 
-// DisconnectContainer sends a request to the hive server to disconnect the given
-// container from the given network.
-func (sim *Simulation) DisconnectContainer(testSuite SuiteID, network, containerID string) error {
-	endpoint := fmt.Sprintf("%s/testsuite/%d/network/%s/%s", sim.url, testSuite, network, containerID)
-	req, err := http.NewRequest(http.MethodDelete, endpoint, nil)
-	if err != nil {
-		return err
-	}
-	_, err = http.DefaultClient.Do(req)
+// StopClientContext is like StopClient, but the request can be cancelled using ctx.
+func (sim *Simulation) StopClientContext(ctx context.Context, testSuite SuiteID, test TestID, nodeid string) error {
+	_, err := sim.request(ctx, http.MethodDelete, sim.endpoint("/testsuite/%d/test/%d/node/%s", testSuite, test, nodeid))
 	return err
 }
 
-// ContainerNetworkIP returns the IP address of a container on the given network. If the
-// container ID is "simulation", it returns the IP address of the simulator container.
-func (sim *Simulation) ContainerNetworkIP(testSuite SuiteID, network, containerID string) (string, error) {
-	resp, err := http.Get(fmt.Sprintf("%s/testsuite/%d/network/%s/%s", sim.url, testSuite, network, containerID))
+// StopClientWithStatus is like StopClient, but also reports whether the client was still
+// running. A client which had already exited, especially with a non-zero exit code, has
+// usually crashed. The status is nil if hive could not determine the state of the client.
+func (sim *Simulation) StopClientWithStatus(testSuite SuiteID, test TestID, nodeid string) (*ClientStopStatus, error) {
+	return sim.StopClientWithStatusContext(context.Background(), testSuite, test, nodeid)
+}
+
+// StopClientWithStatusContext is like StopClientWithStatus, but the request can be
+// cancelled using ctx.
+func (sim *Simulation) StopClientWithStatusContext(ctx context.Context, testSuite SuiteID, test TestID, nodeid string) (*ClientStopStatus, error) {
+	body, err := sim.request(ctx, http.MethodDelete, sim.endpoint("/testsuite/%d/test/%d/node/%s", testSuite, test, nodeid))
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return "", err
+	if strings.TrimSpace(body) == "" {
+		return nil, nil // hive didn't report a status
 	}
-	return string(body), nil
+	var status *ClientStopStatus
+	if err := json.Unmarshal([]byte(body), &status); err != nil {
+		return nil, fmt.Errorf("invalid stop response: %v", err)
+	}
+	return status, nil
 }
 
-func (setup *clientSetup) postWithFiles(url string) (string, error) {
-	var err error
+// StopClientWithOptions stops a client container gracefully. The signal is sent to the
+// client, e.g. "SIGTERM" or "SIGINT". If signal is empty, SIGTERM is used. When the client
+// does not exit within the timeout, it is killed. Clients that store data on shared
+// volumes often need a few seconds to shut down cleanly.
+//
+// If both signal and timeout are empty, this is the same as StopClient, which kills the
+// client immediately.
+func (sim *Simulation) StopClientWithOptions(testSuite SuiteID, test TestID, nodeid string, signal string, timeout time.Duration) error {
+	return sim.StopClientWithOptionsContext(context.Background(), testSuite, test, nodeid, signal, timeout)
+}
 
-	// make a dictionary of readers
-	formValues := make(map[string]io.Reader)
-	for key, s := range setup.parameters {
-		formValues[key] = strings.NewReader(s)
+// StopClientWithOptionsContext is like StopClientWithOptions, but the request can be
+// cancelled using ctx.
+func (sim *Simulation) StopClientWithOptionsContext(ctx context.Context, testSuite SuiteID, test TestID, nodeid string, signal string, timeout time.Duration) error {
+	endpoint := sim.endpoint("/testsuite/%d/test/%d/node/%s", testSuite, test, nodeid)
+	query := make(url.Values)
+	if signal != "" {
+		query.Set("signal", signal)
 	}
-	for key, src := range setup.files {
-		filereader, err := src()
-		if err != nil {
-			return "", err
-		}
-		formValues[key] = filereader
+	if timeout != 0 {
+		query.Set("timeout", timeout.String())
+	}
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
 	}
+	_, err := sim.request(ctx, http.MethodDelete, endpoint)
+	return err
+}
+
+// StopAllClients stops all running clients of a test, including clients which were not
+// started by the caller. If some clients can't be stopped, the others are still stopped
+// and the error is a ContainerErrors value containing the failures.
+func (sim *Simulation) StopAllClients(testSuite SuiteID, test TestID) error {
+	return sim.StopAllClientsContext(context.Background(), testSuite, test)
+}
 
-	// send them
-	var b bytes.Buffer
-	w := multipart.NewWriter(&b)
-	for key, r := range formValues {
-		var fw io.Writer
-		if x, ok := r.(io.Closer); ok {
-			defer x.Close()
+// StopAllClientsContext is like StopAllClients, but the request can be cancelled using ctx.
+func (sim *Simulation) StopAllClientsContext(ctx context.Context, testSuite SuiteID, test TestID) error {
+	_, err := sim.request(ctx, http.MethodDelete, sim.endpoint("/testsuite/%d/test/%d/node", testSuite, test))
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusInternalServerError {
+		var resp struct {
+			Errors map[string]string `json:"errors"`
 		}
-		if _, ok := setup.files[key]; ok {
-			if fw, err = w.CreateFormFile(key, filepath.Base(key)); err != nil {
-				return "", err
-			}
-		} else {
-			if fw, err = w.CreateFormField(key); err != nil {
-				return "", err
+		if json.Unmarshal([]byte(httpErr.Body), &resp) == nil && len(resp.Errors) > 0 {
+			errs := make(ContainerErrors, len(resp.Errors))
+			for id, msg := range resp.Errors {
+				errs[id] = errors.New(msg)
 			}
-		}
-		if _, err = io.Copy(fw, r); err != nil {
-			return "", err
+			return errs
 		}
 	}
+	return err
+}
 
-	// this must be closed or the request will be missing the terminating boundary
-	w.Close()
-
-	// Can't use http.PostForm because we need to change the content header
-	req, err := http.NewRequest("POST", url, &b)
-	if err != nil {
-		return "", err
-	}
-	// Set the content type, this will contain the boundary.
-	req.Header.Set("Content-Type", w.FormDataContentType())
+// RestartClient restarts a running client. The client container is stopped and started
+// again, keeping its environment and filesystem. RestartClient returns the IP address of
+// the client after the restart, which is usually unchanged. For clients started with
+// WithNoDefaultNetwork, the IP address is nil.
+//
+// To change the client parameters, use ReconfigureClient instead.
+func (sim *Simulation) RestartClient(testSuite SuiteID, test TestID, nodeid string) (net.IP, error) {
+	return sim.RestartClientContext(context.Background(), testSuite, test, nodeid)
+}
 
-	// Submit the request
-	resp, err := http.DefaultClient.Do(req)
+// RestartClientContext is like RestartClient, but the request can be cancelled using ctx.
+func (sim *Simulation) RestartClientContext(ctx context.Context, testSuite SuiteID, test TestID, nodeid string) (net.IP, error) {
+	// Restarting is not idempotent, so the request is not retried.
+	resp, err := sim.requestOnce(ctx, http.MethodPost, sim.endpoint("/testsuite/%d/test/%d/node/%s/restart", testSuite, test, nodeid))
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return "", err
+	resp = strings.TrimSpace(resp)
+	if resp == "" {
+		return nil, nil // no IP without the bridge network
 	}
-	if resp.StatusCode >= 200 && resp.StatusCode <= 300 {
-		return string(body), nil
+	ip := net.ParseIP(resp)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address returned: %q", resp)
 	}
-	return "", fmt.Errorf("request failed (%d): %v", resp.StatusCode, string(body))
+	return ip, nil
+}
+
+// ReconfigureClient restarts a running client with new client parameters. The params
+// are HIVE_* environment variables like the parameters used to start the client. They
+// replace the start parameters of the same name and apply to all later restarts. Like
+// RestartClient, the client keeps its filesystem, volumes and networks.
+//
+// Only clients built by hive can be reconfigured, not those started using WithImage.
+// Commands run in the container using Exec don't see the new parameters.
+func (sim *Simulation) ReconfigureClient(testSuite SuiteID, test TestID, nodeid string, params map[string]string) (net.IP, error) {
+	return sim.ReconfigureClientContext(context.Background(), testSuite, test, nodeid, params)
 }
 
-// wrapHttpErrorsPost wraps http.PostForm to convert responses that are not 200 OK into errors
-func wrapHTTPErrorsPost(url string, data url.Values) (string, error) {
-	resp, err := http.PostForm(url, data)
+// ReconfigureClientContext is like ReconfigureClient, but the request can be cancelled
+// using ctx.
+func (sim *Simulation) ReconfigureClientContext(ctx context.Context, testSuite SuiteID, test TestID, nodeid string, params map[string]string) (net.IP, error) {
+	if params == nil {
+		params = map[string]string{}
+	}
+	resp, err := sim.postJSON(ctx, sim.endpoint("/testsuite/%d/test/%d/node/%s/reconfigure", testSuite, test, nodeid), params)
+	if err != nil {
+		return nil, err
+	}
+	resp = strings.TrimSpace(resp)
+	if resp == "" {
+		return nil, nil // no IP without the bridge network
+	}
+	ip := net.ParseIP(resp)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address returned: %q", resp)
+	}
+	return ip, nil
+}
+
+// PauseClient suspends all processes of a running client. This can be used to simulate
+// a stalled peer. Pausing a client that is already paused is not an error.
+func (sim *Simulation) PauseClient(testSuite SuiteID, test TestID, nodeid string) error {
+	return sim.PauseClientContext(context.Background(), testSuite, test, nodeid)
+}
+
+// PauseClientContext is like PauseClient, but the request can be cancelled using ctx.
+func (sim *Simulation) PauseClientContext(ctx context.Context, testSuite SuiteID, test TestID, nodeid string) error {
+	_, err := sim.request(ctx, http.MethodPost, sim.endpoint("/testsuite/%d/test/%d/node/%s/pause", testSuite, test, nodeid))
+	return err
+}
+
+// UnpauseClient resumes a client that was suspended by PauseClient. Unpausing a client
+// that is not paused is not an error.
+func (sim *Simulation) UnpauseClient(testSuite SuiteID, test TestID, nodeid string) error {
+	return sim.UnpauseClientContext(context.Background(), testSuite, test, nodeid)
+}
+
+// UnpauseClientContext is like UnpauseClient, but the request can be cancelled using ctx.
+func (sim *Simulation) UnpauseClientContext(ctx context.Context, testSuite SuiteID, test TestID, nodeid string) error {
+	_, err := sim.request(ctx, http.MethodPost, sim.endpoint("/testsuite/%d/test/%d/node/%s/unpause", testSuite, test, nodeid))
+	return err
+}
+
+// SignalClient sends a signal to the main process of a running client, without stopping
+// it. This can be used to test configuration reloading on SIGHUP, for example. The signal
+// can be given as a name like "SIGHUP" or "HUP", or as a number.
+func (sim *Simulation) SignalClient(testSuite SuiteID, test TestID, nodeid, signal string) error {
+	return sim.SignalClientContext(context.Background(), testSuite, test, nodeid, signal)
+}
+
+// SignalClientContext is like SignalClient, but the request can be cancelled using ctx.
+func (sim *Simulation) SignalClientContext(ctx context.Context, testSuite SuiteID, test TestID, nodeid, signal string) error {
+	// Signals are not idempotent, so the request is not retried.
+	endpoint := sim.endpoint("/testsuite/%d/test/%d/node/%s/signal", testSuite, test, nodeid)
+	endpoint += "?" + url.Values{"signal": {signal}}.Encode()
+	_, err := sim.requestOnce(ctx, http.MethodPost, endpoint)
+	return err
+}
+
+// ClientEnodeURL returns the enode URL of a running client.
+func (sim *Simulation) ClientEnodeURL(testSuite SuiteID, test TestID, node string) (string, error) {
+	return sim.ClientEnodeURLContext(context.Background(), testSuite, test, node)
+}
+
+// ClientEnodeURLContext is like ClientEnodeURL, but the request can be cancelled using ctx.
+func (sim *Simulation) ClientEnodeURLContext(ctx context.Context, testSuite SuiteID, test TestID, node string) (string, error) {
+	body, err := sim.request(ctx, http.MethodGet, sim.endpoint("/testsuite/%d/test/%d/node/%s", testSuite, test, node))
 	if err != nil {
 		return "", err
 	}
+	res := strings.TrimRight(body, "\r\n")
+	if res == "" {
+		return "", ErrNoEnode
+	}
+	return res, nil
+}
+
+// ErrNoEnode is returned by ClientEnodeURL when the client does not report an enode URL.
+// This usually means the client's p2p server is not running yet.
+var ErrNoEnode = errors.New("client did not report an enode URL")
+
+// ClientEnode is like ClientEnodeURL, but returns the parsed node. The returned node
+// contains the ID, IP address, and TCP/UDP ports of the client.
+func (sim *Simulation) ClientEnode(testSuite SuiteID, test TestID, node string) (*enode.Node, error) {
+	return sim.ClientEnodeContext(context.Background(), testSuite, test, node)
+}
+
+// ClientEnodeContext is like ClientEnode, but the request can be cancelled using ctx.
+func (sim *Simulation) ClientEnodeContext(ctx context.Context, testSuite SuiteID, test TestID, node string) (*enode.Node, error) {
+	enodeURL, err := sim.ClientEnodeURLContext(ctx, testSuite, test, node)
+	if err != nil {
+		return nil, err
+	}
+	n, err := enode.ParseV4(enodeURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid enode URL %q: %v", enodeURL, err)
+	}
+	return n, nil
+}
+
+// ClientExec runs a command in a running client. The first element of cmd is the name of
+// a script in the /hive-bin directory of the client container. The command is executed
+// without a shell, so arguments containing spaces or quotes are passed to the script
+// exactly as given.
+func (sim *Simulation) ClientExec(testSuite SuiteID, test TestID, nodeid string, cmd []string) (*ExecInfo, error) {
+	return sim.ClientExecContext(context.Background(), testSuite, test, nodeid, cmd)
+}
+
+// ClientExecContext is like ClientExec, but the request can be cancelled using ctx.
+func (sim *Simulation) ClientExecContext(ctx context.Context, testSuite SuiteID, test TestID, nodeid string, cmd []string) (*ExecInfo, error) {
+	return sim.ClientExecWithOptionsContext(ctx, testSuite, test, nodeid, cmd)
+}
+
+// ClientLogs returns the output of a client container. The caller must close the returned
+// reader.
+func (sim *Simulation) ClientLogs(testSuite SuiteID, test TestID, nodeid string) (io.ReadCloser, error) {
+	return sim.ClientLogsWithOptions(testSuite, test, nodeid, LogsOptions{})
+}
+
+// ClientLogsWithOptions returns the output of a client container. In follow mode, new
+// output is streamed until the client exits or the returned reader is closed.
+func (sim *Simulation) ClientLogsWithOptions(testSuite SuiteID, test TestID, nodeid string, opt LogsOptions) (io.ReadCloser, error) {
+	return sim.ClientLogsWithOptionsContext(context.Background(), testSuite, test, nodeid, opt)
+}
+
+// ClientLogsWithOptionsContext is like ClientLogsWithOptions, but the request can be
+// cancelled using ctx. In follow mode, cancelling ctx also ends the stream.
+func (sim *Simulation) ClientLogsWithOptionsContext(ctx context.Context, testSuite SuiteID, test TestID, nodeid string, opt LogsOptions) (io.ReadCloser, error) {
+	query := make(url.Values)
+	if opt.Follow {
+		query.Set("follow", "1")
+	}
+	if !opt.Since.IsZero() {
+		query.Set("since", strconv.FormatInt(opt.Since.Unix(), 10))
+	}
+	endpoint := sim.endpoint("/testsuite/%d/test/%d/node/%s/logs?%s", testSuite, test, nodeid, query.Encode())
+	return sim.requestStream(ctx, http.MethodGet, endpoint)
+}
+
+// ClientInspect returns the low-level information about a client container, i.e. the
+// output of 'docker inspect'. Callers can unmarshal the fields they need.
+func (sim *Simulation) ClientInspect(testSuite SuiteID, test TestID, nodeid string) (json.RawMessage, error) {
+	return sim.ClientInspectContext(context.Background(), testSuite, test, nodeid)
+}
+
+// ClientInspectContext is like ClientInspect, but the request can be cancelled using ctx.
+func (sim *Simulation) ClientInspectContext(ctx context.Context, testSuite SuiteID, test TestID, nodeid string) (json.RawMessage, error) {
+	body, err := sim.request(ctx, http.MethodGet, sim.endpoint("/testsuite/%d/test/%d/node/%s/inspect", testSuite, test, nodeid))
+	if err != nil {
+		return nil, err
+	}
+	if !json.Valid([]byte(body)) {
+		return nil, fmt.Errorf("invalid JSON in inspect response")
+	}
+	return json.RawMessage(body), nil
+}
+
+// ClientIsAlive reports whether the process of a client is still running. If the client
+// has exited, e.g. because it crashed, exitCode is the exit code of the process. Clients
+// stopped by the simulation are not alive, and an error is returned for them.
+func (sim *Simulation) ClientIsAlive(testSuite SuiteID, test TestID, nodeid string) (alive bool, exitCode int, err error) {
+	return sim.ClientIsAliveContext(context.Background(), testSuite, test, nodeid)
+}
+
+// ClientIsAliveContext is like ClientIsAlive, but the request can be cancelled using ctx.
+func (sim *Simulation) ClientIsAliveContext(ctx context.Context, testSuite SuiteID, test TestID, nodeid string) (alive bool, exitCode int, err error) {
+	body, err := sim.request(ctx, http.MethodGet, sim.endpoint("/testsuite/%d/test/%d/node/%s/state", testSuite, test, nodeid))
+	if err != nil {
+		return false, 0, err
+	}
+	var state struct {
+		Running  bool `json:"running"`
+		ExitCode int  `json:"exitCode"`
+	}
+	if err := json.Unmarshal([]byte(body), &state); err != nil {
+		return false, 0, fmt.Errorf("invalid state response: %v", err)
+	}
+	if state.Running {
+		return true, 0, nil
+	}
+	return false, state.ExitCode, nil
+}
+
+// ClientStats returns the current resource usage of a client.
+func (sim *Simulation) ClientStats(testSuite SuiteID, test TestID, nodeid string) (ContainerStats, error) {
+	return sim.ClientStatsContext(context.Background(), testSuite, test, nodeid)
+}
+
+// ClientStatsContext is like ClientStats, but the request can be cancelled using ctx.
+func (sim *Simulation) ClientStatsContext(ctx context.Context, testSuite SuiteID, test TestID, nodeid string) (ContainerStats, error) {
+	var stats ContainerStats
+	body, err := sim.request(ctx, http.MethodGet, sim.endpoint("/testsuite/%d/test/%d/node/%s/stats", testSuite, test, nodeid))
+	if err != nil {
+		return stats, err
+	}
+	err = json.Unmarshal([]byte(body), &stats)
+	return stats, err
+}
+
+// ClientStatsStream samples the resource usage of a client and calls fn with each
+// sample. Samples are delivered at most once per interval. Docker produces about one
+// sample per second, so shorter intervals have no effect.
+//
+// ClientStatsStream blocks until the client exits or ctx is done. In the latter case,
+// the returned error wraps ctx.Err().
+func (sim *Simulation) ClientStatsStream(ctx context.Context, testSuite SuiteID, test TestID, nodeid string, interval time.Duration, fn func(ContainerStats)) error {
+	body, err := sim.requestStream(ctx, http.MethodGet, sim.endpoint("/testsuite/%d/test/%d/node/%s/stats?stream=1", testSuite, test, nodeid))
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	var last time.Time
+	dec := json.NewDecoder(body)
+	for {
+		var stats ContainerStats
+		if err := dec.Decode(&stats); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return requestError(ctx, err)
+		}
+		if now := time.Now(); now.Sub(last) >= interval {
+			last = now
+			fn(stats)
+		}
+	}
+}
+
+// CopyFileFromClient reads a file or directory from a client container. If containerPath
+// is a regular file, the returned reader yields its content. For directories, the reader
+// yields a TAR archive of the directory. The caller must close the returned reader.
+func (sim *Simulation) CopyFileFromClient(testSuite SuiteID, test TestID, nodeid, containerPath string) (io.ReadCloser, error) {
+	return sim.CopyFileFromClientContext(context.Background(), testSuite, test, nodeid, containerPath)
+}
+
+// CopyFileFromClientContext is like CopyFileFromClient, but the request can be cancelled
+// using ctx. Cancelling ctx also aborts reading from the returned reader.
+func (sim *Simulation) CopyFileFromClientContext(ctx context.Context, testSuite SuiteID, test TestID, nodeid, containerPath string) (io.ReadCloser, error) {
+	query := url.Values{"path": {containerPath}}
+	endpoint := sim.endpoint("/testsuite/%d/test/%d/node/%s/files?%s", testSuite, test, nodeid, query.Encode())
+	return sim.requestStream(ctx, http.MethodGet, endpoint)
+}
+
+// CopyFileToClient writes the content of r to a file in a running client container. The
+// file is created if it doesn't exist, along with any missing parent directories.
+func (sim *Simulation) CopyFileToClient(testSuite SuiteID, test TestID, nodeid, containerPath string, r io.Reader) error {
+	return sim.CopyFileToClientContext(context.Background(), testSuite, test, nodeid, containerPath, r)
+}
+
+// CopyFileToClientContext is like CopyFileToClient, but the request can be cancelled
+// using ctx.
+func (sim *Simulation) CopyFileToClientContext(ctx context.Context, testSuite SuiteID, test TestID, nodeid, containerPath string, r io.Reader) error {
+	query := url.Values{"path": {containerPath}}
+	endpoint := sim.endpoint("/testsuite/%d/test/%d/node/%s/files?%s", testSuite, test, nodeid, query.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, endpoint, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := sim.do(req)
+	if err != nil {
+		return requestError(ctx, err)
+	}
+	_, err = readResponse(resp)
+	return requestError(ctx, err)
+}
+
+// ErrExecTimeout is returned by the client exec methods when the command was killed
+// because it exceeded the timeout set by WithExecTimeout.
+var ErrExecTimeout = errors.New("command timed out")
+
+// ClientExecWithOptions runs a command in a running client with the given options.
+func (sim *Simulation) ClientExecWithOptions(testSuite SuiteID, test TestID, nodeid string, cmd []string, options ...ExecOption) (*ExecInfo, error) {
+	return sim.ClientExecWithOptionsContext(context.Background(), testSuite, test, nodeid, cmd, options...)
+}
+
+// ClientExecWithOptionsContext is like ClientExecWithOptions, but the request can be
+// cancelled using ctx.
+func (sim *Simulation) ClientExecWithOptionsContext(ctx context.Context, testSuite SuiteID, test TestID, nodeid string, cmd []string, options ...ExecOption) (*ExecInfo, error) {
+	return sim.exec(ctx, testSuite, test, nodeid, newExecRequest(cmd, options))
+}
+
+// exec runs a command and waits for its result.
+func (sim *Simulation) exec(ctx context.Context, testSuite SuiteID, test TestID, nodeid string, request *execRequest) (*ExecInfo, error) {
+	resp, err := sim.postExec(ctx, testSuite, test, nodeid, request)
+	if err != nil {
+		return nil, err
+	}
+	body, err := readResponse(resp)
+	if err != nil {
+		return nil, requestError(ctx, err)
+	}
+	var res ExecInfo
+	if err := json.Unmarshal([]byte(body), &res); err != nil {
+		return nil, err
+	}
+	if res.TimedOut {
+		return &res, ErrExecTimeout
+	}
+	return &res, nil
+}
+
+// ClientRunScript runs a script in a running client. Unlike ClientExec, the script doesn't
+// need to exist in the client container: hive writes it to a temporary file in the
+// container, runs it with the given arguments and deletes it afterwards. The script must
+// start with an interpreter line, e.g. "#!/bin/sh".
+func (sim *Simulation) ClientRunScript(testSuite SuiteID, test TestID, nodeid string, script []byte, args ...string) (*ExecInfo, error) {
+	return sim.ClientRunScriptContext(context.Background(), testSuite, test, nodeid, script, args...)
+}
+
+// ClientRunScriptContext is like ClientRunScript, but the request can be cancelled using
+// ctx.
+func (sim *Simulation) ClientRunScriptContext(ctx context.Context, testSuite SuiteID, test TestID, nodeid string, script []byte, args ...string) (*ExecInfo, error) {
+	if len(script) == 0 {
+		return nil, errors.New("empty script")
+	}
+	if args == nil {
+		args = []string{}
+	}
+	return sim.exec(ctx, testSuite, test, nodeid, &execRequest{Command: args, Script: script})
+}
+
+// ClientExecStream runs a command in a running client. Unlike ClientExec, the output of
+// the command is copied to stdout and stderr while it runs. When the command has exited,
+// its exit code is returned.
+func (sim *Simulation) ClientExecStream(ctx context.Context, testSuite SuiteID, test TestID, nodeid string, cmd []string, stdout, stderr io.Writer, options ...ExecOption) (int, error) {
+	request := newExecRequest(cmd, options)
+	request.Stream = true
+	resp, err := sim.postExec(ctx, testSuite, test, nodeid, request)
+	if err != nil {
+		return 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		_, err := readResponse(resp)
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var frame execFrame
+		if err := dec.Decode(&frame); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, requestError(ctx, err)
+		}
+		switch {
+		case frame.Error != "":
+			return 0, errors.New(frame.Error)
+		case frame.ExitCode != nil && frame.TimedOut:
+			return *frame.ExitCode, ErrExecTimeout
+		case frame.ExitCode != nil:
+			return *frame.ExitCode, nil
+		}
+		if _, err := io.WriteString(stdout, frame.Stdout); err != nil {
+			return 0, err
+		}
+		if _, err := io.WriteString(stderr, frame.Stderr); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// ClientExecCombined runs a command in a running client and returns its standard output
+// and standard error interleaved in the order they were produced, like they would appear
+// when running the command in a terminal.
+//
+// If the command exceeds the timeout set by WithExecTimeout, the output produced until
+// then is returned along with ErrExecTimeout.
+func (sim *Simulation) ClientExecCombined(ctx context.Context, testSuite SuiteID, test TestID, nodeid string, cmd []string, options ...ExecOption) (io.Reader, int, error) {
+	var output bytes.Buffer
+	exitCode, err := sim.ClientExecStream(ctx, testSuite, test, nodeid, cmd, &output, &output, options...)
+	if err != nil && err != ErrExecTimeout {
+		return nil, 0, err
+	}
+	return &output, exitCode, err
+}
+
+// ClientExecRaw runs a command in a running client and copies its standard output to
+// stdout without any decoding, so binary output is preserved exactly. The standard error
+// of the command is discarded. When the command has exited, its exit code is returned.
+//
+// If the command exceeds the timeout set by WithExecTimeout, the exit code is returned
+// along with ErrExecTimeout.
+func (sim *Simulation) ClientExecRaw(ctx context.Context, testSuite SuiteID, test TestID, nodeid string, cmd []string, stdout io.Writer, options ...ExecOption) (int, error) {
+	request := newExecRequest(cmd, options)
+	request.Raw = true
+	resp, err := sim.postExec(ctx, testSuite, test, nodeid, request)
+	if err != nil {
+		return 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		_, err := readResponse(resp)
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	// The trailers are available after reading the body.
+	if _, err := io.Copy(stdout, resp.Body); err != nil {
+		return 0, requestError(ctx, err)
+	}
+	if msg := resp.Trailer.Get(execErrorTrailer); msg != "" {
+		return 0, errors.New(msg)
+	}
+	exitCode, err := strconv.Atoi(resp.Trailer.Get(execExitCodeTrailer))
+	if err != nil {
+		return 0, errors.New("missing exit code in raw exec response")
+	}
+	if resp.Trailer.Get(execTimedOutTrailer) == "true" {
+		return exitCode, ErrExecTimeout
+	}
+	return exitCode, nil
+}
+
+// These trailers of raw exec responses contain the result of the command.
+const (
+	execExitCodeTrailer = "X-HIVE-EXIT-CODE"
+	execTimedOutTrailer = "X-HIVE-TIMED-OUT"
+	execErrorTrailer    = "X-HIVE-ERROR"
+)
+
+// ClientExecDetached starts a command in a running client without waiting for it to
+// exit, e.g. to run a load generator during the test. The returned exec ID can be used
+// with ClientExecStatus and ClientExecKill. The output of the command is discarded.
+//
+// Detached commands stop when the client container stops. They don't support the
+// WithStdin and WithExecTimeout options.
+func (sim *Simulation) ClientExecDetached(testSuite SuiteID, test TestID, nodeid string, cmd []string, options ...ExecOption) (string, error) {
+	return sim.ClientExecDetachedContext(context.Background(), testSuite, test, nodeid, cmd, options...)
+}
+
+// ClientExecDetachedContext is like ClientExecDetached, but the request can be cancelled
+// using ctx.
+func (sim *Simulation) ClientExecDetachedContext(ctx context.Context, testSuite SuiteID, test TestID, nodeid string, cmd []string, options ...ExecOption) (string, error) {
+	request := newExecRequest(cmd, options)
+	request.Detach = true
+	resp, err := sim.postExec(ctx, testSuite, test, nodeid, request)
+	if err != nil {
+		return "", err
+	}
+	body, err := readResponse(resp)
+	if err != nil {
+		return "", requestError(ctx, err)
+	}
+	var res struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal([]byte(body), &res); err != nil {
+		return "", err
+	}
+	return res.ID, nil
+}
+
+// ClientExecStatus reports whether a command started by ClientExecDetached is still
+// running. When it has exited, the exit code of the command is returned.
+func (sim *Simulation) ClientExecStatus(testSuite SuiteID, test TestID, nodeid, execID string) (running bool, exitCode int, err error) {
+	return sim.ClientExecStatusContext(context.Background(), testSuite, test, nodeid, execID)
+}
+
+// ClientExecStatusContext is like ClientExecStatus, but the request can be cancelled
+// using ctx.
+func (sim *Simulation) ClientExecStatusContext(ctx context.Context, testSuite SuiteID, test TestID, nodeid, execID string) (running bool, exitCode int, err error) {
+	body, err := sim.request(ctx, http.MethodGet, sim.execURL(testSuite, test, nodeid, execID))
+	if err != nil {
+		return false, 0, err
+	}
+	var status struct {
+		Running  bool `json:"running"`
+		ExitCode int  `json:"exitCode"`
+	}
+	if err := json.Unmarshal([]byte(body), &status); err != nil {
+		return false, 0, err
+	}
+	return status.Running, status.ExitCode, nil
+}
+
+// ClientExecKill kills a command started by ClientExecDetached. Killing a command which
+// has already exited is not an error.
+func (sim *Simulation) ClientExecKill(testSuite SuiteID, test TestID, nodeid, execID string) error {
+	return sim.ClientExecKillContext(context.Background(), testSuite, test, nodeid, execID)
+}
+
+// ClientExecKillContext is like ClientExecKill, but the request can be cancelled using
+// ctx.
+func (sim *Simulation) ClientExecKillContext(ctx context.Context, testSuite SuiteID, test TestID, nodeid, execID string) error {
+	_, err := sim.request(ctx, http.MethodDelete, sim.execURL(testSuite, test, nodeid, execID))
+	return err
+}
+
+func (sim *Simulation) execURL(testSuite SuiteID, test TestID, nodeid, execID string) string {
+	return sim.endpoint("/testsuite/%d/test/%d/node/%s/exec/%s", testSuite, test, nodeid, url.PathEscape(execID))
+}
+
+// execFrame is a frame of streamed command output.
+type execFrame struct {
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr"`
+	ExitCode *int   `json:"exitCode"`
+	TimedOut bool   `json:"timedOut"`
+	Error    string `json:"error"`
+}
+
+// postExec sends a client exec request.
+func (sim *Simulation) postExec(ctx context.Context, testSuite SuiteID, test TestID, nodeid string, request *execRequest) (*http.Response, error) {
+	if request.stdin != nil {
+		stdin, err := ioutil.ReadAll(request.stdin)
+		if err != nil {
+			return nil, fmt.Errorf("can't read stdin: %w", err)
+		}
+		request.Stdin = stdin
+	}
+	enc, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	p := sim.endpoint("/testsuite/%d/test/%d/node/%s/exec", testSuite, test, nodeid)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p, bytes.NewReader(enc))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("content-type", "application/json")
+	resp, err := sim.do(req)
+	return resp, requestError(ctx, err)
+}
+
+// CreateNetwork sends a request to the hive server to create a docker network by
+// the given name.
+//
+// Creating a network which already exists in the test suite fails with an *HTTPError
+// with status 409. Use CreateNetworkIfMissing to ignore this condition.
+func (sim *Simulation) CreateNetwork(testSuite SuiteID, networkName string) error {
+	return sim.CreateNetworkContext(context.Background(), testSuite, networkName)
+}
+
+// CreateNetworkContext is like CreateNetwork, but the request can be cancelled using ctx.
+func (sim *Simulation) CreateNetworkContext(ctx context.Context, testSuite SuiteID, networkName string) error {
+	return sim.CreateNetworkWithOptionsContext(ctx, testSuite, networkName, NetworkOptions{})
+}
+
+// CreateNetworkWithOptions is like CreateNetwork, but allows configuring the address
+// range and isolation of the network. Fields of opts which are left empty use docker
+// defaults.
+func (sim *Simulation) CreateNetworkWithOptions(testSuite SuiteID, networkName string, opts NetworkOptions) error {
+	return sim.CreateNetworkWithOptionsContext(context.Background(), testSuite, networkName, opts)
+}
+
+// CreateNetworkWithOptionsContext is like CreateNetworkWithOptions, but the request can be
+// cancelled using ctx.
+func (sim *Simulation) CreateNetworkWithOptionsContext(ctx context.Context, testSuite SuiteID, networkName string, opts NetworkOptions) error {
+	endpoint := sim.endpoint("/testsuite/%d/network/%s", testSuite, networkName)
+	query := make(url.Values)
+	if opts.Subnet != "" {
+		query.Set("subnet", opts.Subnet)
+	}
+	if opts.Gateway != "" {
+		query.Set("gateway", opts.Gateway)
+	}
+	if opts.Internal {
+		query.Set("internal", "true")
+	}
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+	_, err := sim.request(ctx, http.MethodPost, endpoint)
+	return err
+}
+
+// ListNetworks returns the names of all networks created in the given test suite.
+func (sim *Simulation) ListNetworks(testSuite SuiteID) ([]string, error) {
+	return sim.ListNetworksContext(context.Background(), testSuite)
+}
+
+// ListNetworksContext is like ListNetworks, but the request can be cancelled using ctx.
+func (sim *Simulation) ListNetworksContext(ctx context.Context, testSuite SuiteID) ([]string, error) {
+	body, err := sim.request(ctx, http.MethodGet, sim.endpoint("/testsuite/%d/network", testSuite))
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	if err := json.Unmarshal([]byte(body), &names); err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+// NetworkExists reports whether a network with the given name was created in the
+// test suite.
+func (sim *Simulation) NetworkExists(testSuite SuiteID, network string) (bool, error) {
+	return sim.NetworkExistsContext(context.Background(), testSuite, network)
+}
+
+// NetworkExistsContext is like NetworkExists, but the request can be cancelled using ctx.
+func (sim *Simulation) NetworkExistsContext(ctx context.Context, testSuite SuiteID, network string) (bool, error) {
+	names, err := sim.ListNetworksContext(ctx, testSuite)
+	if err != nil {
+		return false, err
+	}
+	for _, name := range names {
+		if name == network {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// CreateNetworkIfMissing is like CreateNetwork, but does not return an error when the
+// network already exists in the test suite.
+func (sim *Simulation) CreateNetworkIfMissing(testSuite SuiteID, networkName string) error {
+	return sim.CreateNetworkIfMissingContext(context.Background(), testSuite, networkName)
+}
+
+// CreateNetworkIfMissingContext is like CreateNetworkIfMissing, but the request can be
+// cancelled using ctx.
+func (sim *Simulation) CreateNetworkIfMissingContext(ctx context.Context, testSuite SuiteID, networkName string) error {
+	err := sim.CreateNetworkContext(ctx, testSuite, networkName)
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusConflict {
+		return nil
+	}
+	return err
+}
+
+// RemoveNetwork sends a request to the hive server to remove the given network.
+func (sim *Simulation) RemoveNetwork(testSuite SuiteID, network string) error {
+	return sim.RemoveNetworkContext(context.Background(), testSuite, network)
+}
+
+// RemoveNetworkContext is like RemoveNetwork, but the request can be cancelled using ctx.
+func (sim *Simulation) RemoveNetworkContext(ctx context.Context, testSuite SuiteID, network string) error {
+	endpoint := sim.endpoint("/testsuite/%d/network/%s", testSuite, network)
+	_, err := sim.request(ctx, http.MethodDelete, endpoint)
+	return err
+}
+
+// ConnectContainer sends a request to the hive server to connect the given
+// container to the given network.
+func (sim *Simulation) ConnectContainer(testSuite SuiteID, network, containerID string) error {
+	return sim.ConnectContainerContext(context.Background(), testSuite, network, containerID)
+}
+
+// ConnectContainerContext is like ConnectContainer, but the request can be cancelled
+// using ctx.
+func (sim *Simulation) ConnectContainerContext(ctx context.Context, testSuite SuiteID, network, containerID string) error {
+	return sim.ConnectContainerWithAliasesContext(ctx, testSuite, network, containerID)
+}
+
+// ConnectContainerWithAliases is like ConnectContainer, but also makes the container
+// reachable by the given host names on the network. The aliases are removed when the
+// container is disconnected from the network.
+func (sim *Simulation) ConnectContainerWithAliases(testSuite SuiteID, network, containerID string, aliases ...string) error {
+	return sim.ConnectContainerWithAliasesContext(context.Background(), testSuite, network, containerID, aliases...)
+}
+
+// ConnectContainerWithAliasesContext is like ConnectContainerWithAliases, but the request
+// can be cancelled using ctx.
+func (sim *Simulation) ConnectContainerWithAliasesContext(ctx context.Context, testSuite SuiteID, network, containerID string, aliases ...string) error {
+	endpoint := sim.endpoint("/testsuite/%d/network/%s/%s", testSuite, network, containerID)
+	if len(aliases) > 0 {
+		endpoint += "?" + url.Values{"alias": aliases}.Encode()
+	}
+	_, err := sim.request(ctx, http.MethodPost, endpoint)
+	return err
+}
+
+// ConnectContainers connects multiple containers to the given network. The requests are
+// sent concurrently. If some containers can't be connected, the others are still
+// connected and the error is a ContainerErrors value containing the failures.
+func (sim *Simulation) ConnectContainers(testSuite SuiteID, network string, containerIDs ...string) error {
+	return sim.ConnectContainersContext(context.Background(), testSuite, network, containerIDs...)
+}
+
+// ConnectContainersContext is like ConnectContainers, but the requests can be cancelled
+// using ctx.
+func (sim *Simulation) ConnectContainersContext(ctx context.Context, testSuite SuiteID, network string, containerIDs ...string) error {
+	var (
+		errs = make([]error, len(containerIDs))
+		work = make(chan int)
+		wg   sync.WaitGroup
+	)
+	workers := startClientsParallelism
+	if len(containerIDs) < workers {
+		workers = len(containerIDs)
+	}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				errs[i] = sim.ConnectContainerContext(ctx, testSuite, network, containerIDs[i])
+			}
+		}()
+	}
+	for i := range containerIDs {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
+	failed := make(ContainerErrors)
+	for i, err := range errs {
+		if err != nil {
+			failed[containerIDs[i]] = err
+		}
+	}
+	if len(failed) > 0 {
+		return failed
+	}
+	return nil
+}
+
+// DisconnectContainer sends a request to the hive server to disconnect the given
+// container from the given network.
+func (sim *Simulation) DisconnectContainer(testSuite SuiteID, network, containerID string) error {
+	return sim.DisconnectContainerContext(context.Background(), testSuite, network, containerID)
+}
+
+// DisconnectContainerContext is like DisconnectContainer, but the request can be
+// cancelled using ctx.
+func (sim *Simulation) DisconnectContainerContext(ctx context.Context, testSuite SuiteID, network, containerID string) error {
+	endpoint := sim.endpoint("/testsuite/%d/network/%s/%s", testSuite, network, containerID)
+	_, err := sim.request(ctx, http.MethodDelete, endpoint)
+	return err
+}
+
+// ShapeNetwork applies traffic shaping to all clients connected to the given network.
+// This can be used to simulate a wide area network. Shaping replaces any previous shaping
+// of the network. It does not apply to the simulator container and to clients connected
+// to the network after the call.
+//
+// Shaping is implemented with netem, which hive runs inside of the client containers.
+// The client images must have the 'tc' tool installed.
+func (sim *Simulation) ShapeNetwork(testSuite SuiteID, network string, opts ShapeOptions) error {
+	return sim.ShapeNetworkContext(context.Background(), testSuite, network, opts)
+}
+
+// ShapeNetworkContext is like ShapeNetwork, but the request can be cancelled using ctx.
+func (sim *Simulation) ShapeNetworkContext(ctx context.Context, testSuite SuiteID, network string, opts ShapeOptions) error {
+	query := make(url.Values)
+	if opts.Latency > 0 {
+		query.Set("latency", opts.Latency.String())
+	}
+	if opts.Jitter > 0 {
+		query.Set("jitter", opts.Jitter.String())
+	}
+	if opts.LossPercent > 0 {
+		query.Set("loss", strconv.FormatFloat(opts.LossPercent, 'f', -1, 64))
+	}
+	if opts.RateLimit > 0 {
+		query.Set("rate", strconv.FormatUint(opts.RateLimit, 10))
+	}
+	endpoint := sim.endpoint("/testsuite/%d/network/%s/shaping", testSuite, network)
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+	_, err := sim.request(ctx, http.MethodPost, endpoint)
+	return err
+}
+
+// ClearNetworkShaping removes the traffic shaping applied by ShapeNetwork from all
+// clients connected to the given network.
+func (sim *Simulation) ClearNetworkShaping(testSuite SuiteID, network string) error {
+	return sim.ClearNetworkShapingContext(context.Background(), testSuite, network)
+}
+
+// ClearNetworkShapingContext is like ClearNetworkShaping, but the request can be
+// cancelled using ctx.
+func (sim *Simulation) ClearNetworkShapingContext(ctx context.Context, testSuite SuiteID, network string) error {
+	_, err := sim.request(ctx, http.MethodDelete, sim.endpoint("/testsuite/%d/network/%s/shaping", testSuite, network))
+	return err
+}
+
+// ErrNotAttached is returned by ContainerIP when the container is not connected to the
+// network.
+var ErrNotAttached = errors.New("container is not attached to network")
+
+// ContainerIP returns the IP address of a container on the given network. If the
+// container ID is "simulation", it returns the IP address of the simulator container.
+//
+// If the container is not connected to the network, the returned error wraps
+// ErrNotAttached.
+func (sim *Simulation) ContainerIP(testSuite SuiteID, network, containerID string) (net.IP, error) {
+	return sim.ContainerIPContext(context.Background(), testSuite, network, containerID)
+}
+
+// ContainerIPContext is like ContainerIP, but the request can be cancelled using ctx.
+func (sim *Simulation) ContainerIPContext(ctx context.Context, testSuite SuiteID, network, containerID string) (net.IP, error) {
+	resp, err := sim.request(ctx, http.MethodGet, sim.endpoint("/testsuite/%d/network/%s/%s", testSuite, network, containerID))
+	if err != nil {
+		var httpErr *HTTPError
+		if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("%w (container %s, network %s)", ErrNotAttached, containerID, network)
+		}
+		return nil, err
+	}
+	ip := net.ParseIP(strings.TrimSpace(resp))
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address %q in response", resp)
+	}
+	return ip, nil
+}
+
+// NetworkIPs returns the IP addresses of all containers on the given network, keyed by
+// container ID. The simulation container is included with ID "simulation" if it is
+// connected to the network.
+func (sim *Simulation) NetworkIPs(testSuite SuiteID, network string) (map[string]net.IP, error) {
+	return sim.NetworkIPsContext(context.Background(), testSuite, network)
+}
+
+// NetworkIPsContext is like NetworkIPs, but the request can be cancelled using ctx.
+func (sim *Simulation) NetworkIPsContext(ctx context.Context, testSuite SuiteID, network string) (map[string]net.IP, error) {
+	body, err := sim.request(ctx, http.MethodGet, sim.endpoint("/testsuite/%d/network/%s", testSuite, network))
+	if err != nil {
+		return nil, err
+	}
+	var ips map[string]net.IP
+	if err := json.Unmarshal([]byte(body), &ips); err != nil {
+		return nil, err
+	}
+	return ips, nil
+}
+
+// ContainerNetworkIP returns the IP address of a container on the given network. If the
+// container ID is "simulation", it returns the IP address of the simulator container.
+//
+// Deprecated: use ContainerIP.
+func (sim *Simulation) ContainerNetworkIP(testSuite SuiteID, network, containerID string) (string, error) {
+	return sim.ContainerNetworkIPContext(context.Background(), testSuite, network, containerID)
+}
+
+// ContainerNetworkIPContext is like ContainerNetworkIP, but the request can be cancelled
+// using ctx.
+//
+// Deprecated: use ContainerIPContext.
+func (sim *Simulation) ContainerNetworkIPContext(ctx context.Context, testSuite SuiteID, network, containerID string) (string, error) {
+	ip, err := sim.ContainerIPContext(ctx, testSuite, network, containerID)
+	if err != nil {
+		return "", err
+	}
+	return ip.String(), nil
+}
+
+func (setup *clientSetup) postWithFiles(ctx context.Context, do func(*http.Request) (*http.Response, error), url string) (string, http.Header, error) {
+	var err error
+
+	// All opened files are closed when the request is done, including on errors.
+	var closers []io.Closer
+	defer func() {
+		for _, c := range closers {
+			c.Close()
+		}
+	}()
+
+	// make a dictionary of readers
+	formValues := make(map[string]io.Reader)
+	for key, s := range setup.parameters {
+		formValues[key] = strings.NewReader(s)
+	}
+	for key, s := range setup.labels {
+		formValues[labelFieldPrefix+key] = strings.NewReader(s)
+	}
+	for key, s := range setup.buildArgs {
+		formValues[buildArgFieldPrefix+key] = strings.NewReader(s)
+	}
+	if setup.image != "" {
+		formValues[imageField] = strings.NewReader(setup.image)
+	}
+	for _, name := range setup.networks {
+		formValues[networkFieldPrefix+name] = strings.NewReader(name)
+	}
+	if setup.noDefaultNetwork {
+		formValues[noDefaultNetworkField] = strings.NewReader("true")
+	}
+	if setup.privileged {
+		formValues[privilegedField] = strings.NewReader("true")
+	}
+	for _, c := range setup.capabilities {
+		formValues[capabilityFieldPrefix+c] = strings.NewReader(c)
+	}
+	for name, limits := range setup.ulimits {
+		formValues[ulimitFieldPrefix+name] = strings.NewReader(limits)
+	}
+	for target, volume := range setup.volumes {
+		formValues[volumeFieldPrefix+target] = strings.NewReader(volume)
+	}
+	if setup.memoryLimit > 0 {
+		formValues[memoryField] = strings.NewReader(strconv.FormatInt(setup.memoryLimit, 10))
+	}
+	if setup.startTimeout > 0 {
+		formValues[startTimeoutField] = strings.NewReader(setup.startTimeout.String())
+	}
+	if setup.cpuLimit > 0 {
+		formValues[cpusField] = strings.NewReader(strconv.FormatFloat(setup.cpuLimit, 'f', -1, 64))
+	}
+	for i, cmd := range setup.startup {
+		enc, err := json.Marshal(cmd)
+		if err != nil {
+			return "", nil, err
+		}
+		formValues[startupFieldPrefix+strconv.Itoa(i)] = bytes.NewReader(enc)
+	}
+	for i, id := range setup.uploads {
+		formValues[uploadFieldPrefix+strconv.Itoa(i)] = strings.NewReader(id)
+	}
+	for key, src := range setup.files {
+		filereader, err := src()
+		if err != nil {
+			// For static files, err is an *os.PathError containing the source path.
+			return "", nil, fmt.Errorf("init file %q: %w", key, err)
+		}
+		closers = append(closers, filereader)
+		formValues[key] = filereader
+	}
+
+	archives := make([]io.Reader, len(setup.archives))
+	for i, archive := range setup.archives {
+		r := archive.src()
+		closers = append(closers, r)
+		archives[i] = r
+	}
+
+	// The body is written while the request is sent, so files are streamed to hive
+	// without holding them in memory. The writer is stopped before the files are closed.
+	pr, pw := io.Pipe()
+	var (
+		dst      io.Writer = pw
+		progress *progressWriter
+	)
+	if setup.uploadProgress != nil {
+		progress = &progressWriter{w: pw, fn: setup.uploadProgress, report: time.Now()}
+		dst = progress
+	}
+	w := multipart.NewWriter(dst)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		err := setup.writeForm(w, formValues, archives)
+		if err == nil && progress != nil {
+			progress.fn(progress.n)
+		}
+		pw.CloseWithError(err)
+	}()
+	defer func() {
+		pr.Close()
+		<-done
+	}()
+
+	// Can't use http.PostForm because we need to change the content header
+	req, err := http.NewRequestWithContext(ctx, "POST", url, pr)
+	if err != nil {
+		return "", nil, err
+	}
+	// Set the content type, this will contain the boundary.
+	req.Header.Set("Content-Type", w.FormDataContentType())
+
+	// Submit the request
+	resp, err := do(req)
+	if err != nil {
+		return "", nil, requestError(ctx, err)
+	}
+	body, err := readResponse(resp)
+	return body, resp.Header, err
+}
+
+// writeForm writes the multipart body of a client start request.
+func (setup *clientSetup) writeForm(w *multipart.Writer, formValues map[string]io.Reader, archives []io.Reader) error {
+	// send them, in sorted order to keep the request reproducible
+	keys := make([]string, 0, len(formValues))
+	for key := range formValues {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		var (
+			fw  io.Writer
+			err error
+		)
+		if _, ok := setup.files[key]; ok {
+			fw, err = w.CreateFormFile(key, filepath.Base(key))
+		} else {
+			fw, err = w.CreateFormField(key)
+		}
+		if err != nil {
+			return err
+		}
+		if _, err = io.Copy(fw, formValues[key]); err != nil {
+			return err
+		}
+	}
+
+	for i, r := range archives {
+		name := fmt.Sprintf("archive-%d", i)
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, name, name))
+		header.Set("Content-Type", "application/octet-stream")
+		header.Set(fileTypeHeader, setup.archives[i].fileType)
+		fw, err := w.CreatePart(header)
+		if err != nil {
+			return err
+		}
+		if !setup.tarChecksum {
+			if _, err = io.Copy(fw, r); err != nil {
+				return err
+			}
+			continue
+		}
+		// The digest is sent after the archive, so it can be computed while streaming.
+		h := sha256.New()
+		if _, err = io.Copy(io.MultiWriter(fw, h), r); err != nil {
+			return err
+		}
+		digest := hex.EncodeToString(h.Sum(nil))
+		if err := w.WriteField(checksumFieldPrefix+name, digest); err != nil {
+			return err
+		}
+		if setup.tarChecksumFn != nil {
+			setup.tarChecksumFn(i, digest)
+		}
+	}
+
+	// this must be closed or the request will be missing the terminating boundary
+	return w.Close()
+}
+
+// postJSON sends a POST request with the JSON encoding of data as the body and returns
+// the response body. Responses that are not 200 OK are converted into errors.
+func (sim *Simulation) postJSON(ctx context.Context, url string, data interface{}) (string, error) {
+	enc, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(enc))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := sim.do(req)
+	if err != nil {
+		return "", requestError(ctx, err)
+	}
+	body, err := readResponse(resp)
+	return body, requestError(ctx, err)
+}
+
+// HTTPError is returned by API calls when hive responds with a non-2xx status code.
+type HTTPError struct {
+	StatusCode int    // HTTP status code of the response
+	Body       string // response body, usually the error message
+	URL        string // request URL
+}
+
+func (err *HTTPError) Error() string {
+	return fmt.Sprintf("request failed (%d): %v", err.StatusCode, err.Body)
+}
+
+// readResponse reads and closes the body of an API response. Responses with a non-2xx
+// status code are converted into an *HTTPError.
+func readResponse(resp *http.Response) (string, error) {
+	defer resp.Body.Close()
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return "", err
 	}
-	if resp.StatusCode >= 200 && resp.StatusCode <= 300 {
-		return string(body), nil
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", &HTTPError{StatusCode: resp.StatusCode, Body: string(body), URL: resp.Request.URL.String()}
 	}
-	return "", fmt.Errorf("request failed (%d): %v", resp.StatusCode, string(body))
+	return string(body), nil
+}
+
+// request performs an API request without a request body and returns the response body.
+// Responses with a non-2xx status code are returned as *HTTPError.
+//
+// GET and POST requests are retried according to the retry policy. Repeating the
+// body-less POST requests sent through this method has no additional effect:
+//
+//   - pausing, unpausing and network shaping set the state of a container
+//   - TestOutputDir returns the existing directory of the test
+//   - creating or connecting a network fails instead of creating a duplicate
+//
+// Non-idempotent POST requests, e.g. RestartClient, must use requestOnce. DELETE
+// requests tear down resources and are attempted once.
+func (sim *Simulation) request(ctx context.Context, method, url string) (body string, err error) {
+	if method == http.MethodDelete {
+		return sim.requestOnce(ctx, method, url)
+	}
+	err = sim.withRetry(ctx, func() (err error) {
+		body, err = sim.requestOnce(ctx, method, url)
+		return err
+	})
+	return body, err
+}
+
+// requestStream performs an API request without a request body and returns the response
+// body for streaming. Responses with a non-2xx status code are returned as *HTTPError.
+func (sim *Simulation) requestStream(ctx context.Context, method, url string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := sim.do(req)
+	if err != nil {
+		return nil, requestError(ctx, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		_, err := readResponse(resp)
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// requestOnce performs a single attempt of an API request.
+func (sim *Simulation) requestOnce(ctx context.Context, method, url string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := sim.do(req)
+	if err != nil {
+		return "", requestError(ctx, err)
+	}
+	body, err := readResponse(resp)
+	return body, requestError(ctx, err)
+}
+
+// requestError ensures that the error of a failed request wraps ctx.Err() when the
+// request was aborted because the context was cancelled or its deadline was exceeded.
+// This allows callers to tell cancellation apart from transport failures.
+func requestError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil && !errors.Is(err, ctxErr) {
+		return fmt.Errorf("%v: %w", err, ctxErr)
+	}
+	return err
 }
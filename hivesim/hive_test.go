@@ -1,13 +1,34 @@
 package hivesim
 
 import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"mime/multipart"
+	"net"
+	"net/http"
 	"net/http/httptest"
+	"net/textproto"
+	"net/url"
 	"os"
+	"path/filepath"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/davecgh/go-spew/spew"
 	"github.com/ethereum/hive/internal/fakes"
@@ -29,12 +50,12 @@ func TestClientTypes(t *testing.T) {
 		{
 			Name:    "client-1",
 			Version: "client-1-version",
-			Meta:    ClientMetadata{Roles: []string{"eth1"}},
+			Meta:    ClientMetadata{Roles: []string{"eth1"}, Info: map[string]string{"commit": "abc123"}},
 		},
 		{
 			Name:    "client-2",
 			Version: "client-2-version",
-			Meta:    ClientMetadata{Roles: []string{"beacon"}},
+			Meta:    ClientMetadata{Roles: []string{"beacon"}, Ports: []int{4000, 5052}},
 		},
 	}
 	if !reflect.DeepEqual(ctypes, wantClients) {
@@ -42,6 +63,151 @@ func TestClientTypes(t *testing.T) {
 	}
 }
 
+// This test checks ClientVersion and ClientMetadata.
+func TestClientMetadata(t *testing.T) {
+	tm, srv := newFakeAPI(nil)
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	version, err := sim.ClientVersion("client-2")
+	if err != nil {
+		t.Fatal("can't get client version:", err)
+	}
+	if version != "client-2-version" {
+		t.Fatalf("wrong version %q", version)
+	}
+	meta, err := sim.ClientMetadata("client-1")
+	if err != nil {
+		t.Fatal("can't get client metadata:", err)
+	}
+	want := map[string]string{"version": "client-1-version", "commit": "abc123"}
+	if !reflect.DeepEqual(meta, want) {
+		t.Fatalf("wrong metadata %v", meta)
+	}
+	if _, err := sim.ClientVersion("client-3"); !errors.Is(err, ErrUnknownClient) {
+		t.Fatalf("wrong error for unknown client: %v", err)
+	}
+}
+
+// This test checks that the ports declared by clients are reported.
+func TestClientPorts(t *testing.T) {
+	tm, srv := newFakeAPI(nil)
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	ports, err := sim.ClientPorts("client-2")
+	if err != nil {
+		t.Fatal("can't get client ports:", err)
+	}
+	if !reflect.DeepEqual(ports, []int{4000, 5052}) {
+		t.Fatalf("wrong ports %v", ports)
+	}
+	ports, err = sim.ClientPorts("client-1")
+	if err != nil {
+		t.Fatal("can't get client ports:", err)
+	}
+	if len(ports) != 0 {
+		t.Fatalf("wrong ports %v for client without declared ports", ports)
+	}
+	if _, err := sim.ClientPorts("client-3"); !errors.Is(err, ErrUnknownClient) {
+		t.Fatalf("wrong error for unknown client: %v", err)
+	}
+}
+
+// This test checks fetching the definition of a single client type.
+func TestClientDefinition(t *testing.T) {
+	tm, srv := newFakeAPI(nil)
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	def, err := sim.ClientDefinition("client-1")
+	if err != nil {
+		t.Fatal("can't get client definition:", err)
+	}
+	if def.Name != "client-1" || def.Version != "client-1-version" || def.Meta.Info["commit"] != "abc123" {
+		t.Fatalf("wrong definition %+v", def)
+	}
+	if _, err := sim.ClientDefinition("client-3"); !errors.Is(err, ErrUnknownClient) {
+		t.Fatalf("wrong error for unknown client: %v", err)
+	}
+}
+
+// This checks client type filtering.
+func TestClientTypesWithRole(t *testing.T) {
+	tm, srv := newFakeAPI(nil)
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	ctypes, err := sim.ClientTypesWithRole("beacon")
+	if err != nil {
+		t.Fatal("can't get client types:", err)
+	}
+	if len(ctypes) != 1 || ctypes[0].Name != "client-2" {
+		t.Fatalf("wrong client types for role beacon: %s", spew.Sdump(ctypes))
+	}
+	ctypes, err = sim.ClientTypesWithRole("unknown")
+	if err != nil {
+		t.Fatal("can't get client types:", err)
+	}
+	if len(ctypes) != 0 {
+		t.Fatalf("wrong client types for unknown role: %s", spew.Sdump(ctypes))
+	}
+	ctypes, err = sim.ClientTypesMatching(func(def *ClientDefinition) bool {
+		return strings.HasSuffix(def.Name, "-1")
+	})
+	if err != nil {
+		t.Fatal("can't get client types:", err)
+	}
+	if len(ctypes) != 1 || ctypes[0].Name != "client-1" {
+		t.Fatalf("wrong matching client types: %s", spew.Sdump(ctypes))
+	}
+}
+
+// This checks that ClientTypes caches the client list.
+func TestClientTypesCache(t *testing.T) {
+	tm, srv := newFakeAPI(nil)
+	defer srv.Close()
+	defer tm.Terminate()
+
+	var requests int
+	sim := NewAt(srv.URL)
+	sim.SetHTTPClient(&http.Client{
+		Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			requests++
+			return http.DefaultTransport.RoundTrip(req)
+		}),
+	})
+	for i := 0; i < 3; i++ {
+		ctypes, err := sim.ClientTypes()
+		if err != nil {
+			t.Fatal("can't get client types:", err)
+		}
+		if len(ctypes) != 2 {
+			t.Fatalf("wrong number of client types: %d", len(ctypes))
+		}
+		// Modifying the result must not affect the cache.
+		ctypes[0].Name = "modified"
+	}
+	if requests != 1 {
+		t.Fatalf("%d requests sent, want 1", requests)
+	}
+
+	ctypes, err := sim.ClientTypesRefresh()
+	if err != nil {
+		t.Fatal("can't refresh client types:", err)
+	}
+	if requests != 2 {
+		t.Fatalf("%d requests sent after refresh, want 2", requests)
+	}
+	if ctypes[0].Name != "client-1" {
+		t.Fatalf("wrong client name %q", ctypes[0].Name)
+	}
+}
+
 // This checks that the simulator replaces the IP in enode.sh output with the container IP.
 func TestEnodeReplaceIP(t *testing.T) {
 	// Set up the backend to return enode:// URL containing the
@@ -129,6 +295,113 @@ func TestStartClientStartOptions(t *testing.T) {
 		}
 	})
 
+	t.Run("labels", func(t *testing.T) {
+		_, _, err = sim.StartClientWithOptions(suiteID, testID, "client-1",
+			WithLabels(map[string]string{"hive.scenario": "sync", "hive.commit": "abc"}),
+			WithLabels(map[string]string{"hive.commit": "def"}))
+		if err != nil {
+			t.Fatalf("failed to start client: %v", err)
+		}
+		want := map[string]string{"hive.scenario": "sync", "hive.commit": "def"}
+		if !reflect.DeepEqual(lastOptions.Labels, want) {
+			t.Fatalf("wrong labels %v, want %v", lastOptions.Labels, want)
+		}
+	})
+
+	t.Run("privileged", func(t *testing.T) {
+		_, _, err = sim.StartClientWithOptions(suiteID, testID, "client-1")
+		if err != nil {
+			t.Fatalf("failed to start client: %v", err)
+		}
+		if lastOptions.Privileged {
+			t.Fatal("container is privileged by default")
+		}
+		_, _, err = sim.StartClientWithOptions(suiteID, testID, "client-1", WithPrivileged())
+		if err != nil {
+			t.Fatalf("failed to start client: %v", err)
+		}
+		if !lastOptions.Privileged {
+			t.Fatal("WithPrivileged did not set privileged mode")
+		}
+	})
+
+	t.Run("capabilities", func(t *testing.T) {
+		_, _, err = sim.StartClientWithOptions(suiteID, testID, "client-1",
+			WithCapabilities("SYS_TIME", "NET_ADMIN"), WithCapabilities("NET_ADMIN"))
+		if err != nil {
+			t.Fatalf("failed to start client: %v", err)
+		}
+		want := []string{"NET_ADMIN", "SYS_TIME"}
+		if !reflect.DeepEqual(lastOptions.CapAdd, want) {
+			t.Fatalf("wrong capabilities %q, want %q", lastOptions.CapAdd, want)
+		}
+		_, _, err = sim.StartClientWithOptions(suiteID, testID, "client-1", WithCapabilities("net_admin"))
+		if err == nil || !strings.Contains(err.Error(), `invalid capability "net_admin"`) {
+			t.Fatalf("wrong error for invalid capability: %v", err)
+		}
+	})
+
+	t.Run("resource_limits", func(t *testing.T) {
+		_, _, err = sim.StartClientWithOptions(suiteID, testID, "client-1",
+			WithMemoryLimit(512<<20), WithCPULimit(1.5))
+		if err != nil {
+			t.Fatalf("failed to start client: %v", err)
+		}
+		if lastOptions.Memory != 512<<20 {
+			t.Fatalf("wrong memory limit %d", lastOptions.Memory)
+		}
+		if lastOptions.NanoCPUs != 1.5e9 {
+			t.Fatalf("wrong CPU limit %d", lastOptions.NanoCPUs)
+		}
+		_, _, err = sim.StartClientWithOptions(suiteID, testID, "client-1", WithCPULimit(0))
+		if err == nil {
+			t.Fatal("expected error for zero CPU limit")
+		}
+	})
+
+	t.Run("ulimits", func(t *testing.T) {
+		_, _, err = sim.StartClientWithOptions(suiteID, testID, "client-1",
+			WithUlimit("nproc", 1024, 2048), WithUlimit("nofile", 1024, 1024), WithUlimit("nofile", 65536, 65536))
+		if err != nil {
+			t.Fatalf("failed to start client: %v", err)
+		}
+		want := []libhive.Ulimit{{Name: "nofile", Soft: 65536, Hard: 65536}, {Name: "nproc", Soft: 1024, Hard: 2048}}
+		if !reflect.DeepEqual(lastOptions.Ulimits, want) {
+			t.Fatalf("wrong ulimits %+v", lastOptions.Ulimits)
+		}
+		_, _, err = sim.StartClientWithOptions(suiteID, testID, "client-1", WithUlimit("nofile", 2, 1))
+		if err == nil {
+			t.Fatal("expected error for soft limit above hard limit")
+		}
+		_, _, err = sim.StartClientWithOptions(suiteID, testID, "client-1", WithUlimit("NOFILE", 1, 1))
+		if err == nil || !strings.Contains(err.Error(), `invalid ulimit name "NOFILE"`) {
+			t.Fatalf("wrong error for invalid ulimit name: %v", err)
+		}
+	})
+
+	t.Run("volumes", func(t *testing.T) {
+		_, _, err = sim.StartClientWithOptions(suiteID, testID, "client-1",
+			WithVolume("chaindata", "/data/", true), WithVolume("scratch", "/tmp/scratch", false))
+		if err != nil {
+			t.Fatalf("failed to start client: %v", err)
+		}
+		want := []libhive.Mount{
+			{Volume: "chaindata", Target: "/data", ReadOnly: true},
+			{Volume: "scratch", Target: "/tmp/scratch"},
+		}
+		if !reflect.DeepEqual(lastOptions.Mounts, want) {
+			t.Fatalf("wrong mounts %+v", lastOptions.Mounts)
+		}
+		_, _, err = sim.StartClientWithOptions(suiteID, testID, "client-1", WithVolume("chaindata", "data", false))
+		if err == nil {
+			t.Fatal("expected error for relative mount path")
+		}
+		_, _, err = sim.StartClientWithOptions(suiteID, testID, "client-1", WithVolume("-bad", "/data", false))
+		if err == nil || !strings.Contains(err.Error(), `invalid volume name "-bad"`) {
+			t.Fatalf("wrong error for invalid volume name: %v", err)
+		}
+	})
+
 	t.Run("params_options", func(t *testing.T) {
 		// Params with overrides
 		_, _, err = sim.StartClientWithOptions(suiteID, testID, "client-1",
@@ -211,16 +484,78 @@ func TestStartClientStartOptions(t *testing.T) {
 				t.Fatalf("expected 6 bytes for '/data/bar', got %d", got.Size)
 			}
 		})
+
+		t.Run("reader", func(t *testing.T) {
+			r := &closeTracker{Reader: strings.NewReader("streamed")}
+			_, _, err = sim.StartClientWithOptions(suiteID, testID, "client-1", WithFileReader("/data/stream", r))
+			if err != nil {
+				t.Fatalf("failed to start client: %v", err)
+			}
+			got, ok := lastOptions.Files["/data/stream"]
+			if !ok {
+				t.Fatal("missing /data/stream")
+			}
+			if got.Size != 8 {
+				t.Fatalf("expected 8 bytes for '/data/stream', got %d", got.Size)
+			}
+			if !r.closed {
+				t.Fatal("reader was not closed")
+			}
+		})
+
+		t.Run("tar", func(t *testing.T) {
+			src := func() io.ReadCloser { return ioutil.NopCloser(strings.NewReader("tar data")) }
+			_, _, err = sim.StartClientWithOptions(suiteID, testID, "client-1", WithTAR(src), WithGzipTAR(src))
+			if err != nil {
+				t.Fatalf("failed to start client: %v", err)
+			}
+			for name, ftype := range map[string]string{"archive-0": "TAR", "archive-1": "TAR_GZ"} {
+				got, ok := lastOptions.Files[name]
+				if !ok {
+					t.Fatalf("missing %s", name)
+				}
+				if h := got.Header.Get("X-HIVE-FILETYPE"); h != ftype {
+					t.Fatalf("wrong file type %q for %s, want %q", h, name, ftype)
+				}
+			}
+		})
+
+		t.Run("bytes", func(t *testing.T) {
+			// In-memory file overriding a static file.
+			_, _, err = sim.StartClientWithOptions(suiteID, testID, "client-1",
+				WithStaticFiles(map[string]string{"/genesis.json": file1.Name()}),
+				WithBytes("/genesis.json", []byte(`{"config":{}}`)))
+			if err != nil {
+				t.Fatalf("failed to start client: %v", err)
+			}
+			got, ok := lastOptions.Files["/genesis.json"]
+			if !ok {
+				t.Fatal("missing /genesis.json")
+			}
+			if got.Size != 13 {
+				t.Fatalf("expected 13 bytes for '/genesis.json', got %d", got.Size)
+			}
+		})
 	})
 }
 
+type closeTracker struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeTracker) Close() error {
+	c.closed = true
+	return nil
+}
+
 // This checks that the simulator can run a program
 func TestRunProgram(t *testing.T) {
 	// Set up the backend to return program execution. Simple debug program here.
 	hooks := &fakes.BackendHooks{
-		RunProgram: func(containerID string, cmd []string) (*libhive.ExecInfo, error) {
+		RunProgram: func(containerID string, opt libhive.ExecOptions) (*libhive.ExecInfo, error) {
 			return &libhive.ExecInfo{
-				Stdout:   "out: " + cmd[0],
+				Stdout:   "out: " + opt.Cmd[0],
 				Stderr:   "error output",
 				ExitCode: 42,
 			}, nil
@@ -263,9 +598,16 @@ func TestRunProgram(t *testing.T) {
 	}
 }
 
-// This test checks for some common errors returned by StartClient.
-func TestStartClientErrors(t *testing.T) {
-	tm, srv := newFakeAPI(nil)
+// This checks that command arguments are passed to the program verbatim.
+func TestRunProgramArgs(t *testing.T) {
+	var gotCmd []string
+	hooks := &fakes.BackendHooks{
+		RunProgram: func(containerID string, opt libhive.ExecOptions) (*libhive.ExecInfo, error) {
+			gotCmd = opt.Cmd
+			return &libhive.ExecInfo{}, nil
+		},
+	}
+	tm, srv := newFakeAPI(hooks)
 	defer srv.Close()
 	defer tm.Terminate()
 
@@ -278,33 +620,3593 @@ func TestStartClientErrors(t *testing.T) {
 	if err != nil {
 		t.Fatal("can't start test:", err)
 	}
+	clientID, _, err := sim.StartClientWithOptions(suiteID, testID, "client-1")
+	if err != nil {
+		t.Fatal("can't start client:", err)
+	}
 
-	// Need CLIENT to start the client.
-	params := map[string]string{}
-	clientID, _, err := sim.StartClient(suiteID, testID, params, nil)
-	if err == nil {
-		t.Fatalf("wanted error from GetNode without CLIENT parameter, got container ID %v", clientID)
+	args := []string{"send", `{"jsonrpc": "2.0", "method": "eth_chainId"}`, "it's", `"quoted" \ arg`, ""}
+	if _, err := sim.ClientExec(suiteID, testID, clientID, args); err != nil {
+		t.Fatal("failed to run program:", err)
 	}
-	if !strings.Contains(err.Error(), "missing 'CLIENT'") {
-		t.Fatalf("wrong error for GetNode without CLIENT parameter: %q", err.Error())
+	want := append([]string{"/hive-bin/send"}, args[1:]...)
+	if !reflect.DeepEqual(gotCmd, want) {
+		t.Fatalf("wrong command %q\nwant %q", gotCmd, want)
 	}
+}
 
-	// Unknown CLIENT.
-	params = map[string]string{"CLIENT": "unknown"}
-	clientID, _, err = sim.StartClient(suiteID, testID, params, nil)
-	if err == nil {
-		t.Fatalf("wanted error for unknown CLIENT parameter, got container ID %v", clientID)
+// This checks that ClientRunScript uploads the script, runs it and removes it.
+func TestClientRunScript(t *testing.T) {
+	var (
+		uploaded = make(map[string][]byte)
+		cmds     [][]string
+	)
+	hooks := &fakes.BackendHooks{
+		UploadArchive: func(containerID, dir string, archive io.Reader) error {
+			tr := tar.NewReader(archive)
+			for {
+				header, err := tr.Next()
+				if err == io.EOF {
+					return nil
+				} else if err != nil {
+					return err
+				}
+				if header.Mode&0111 == 0 {
+					return fmt.Errorf("%s is not executable", header.Name)
+				}
+				uploaded["/"+header.Name], _ = ioutil.ReadAll(tr)
+			}
+		},
+		RunProgram: func(containerID string, opt libhive.ExecOptions) (*libhive.ExecInfo, error) {
+			cmds = append(cmds, opt.Cmd)
+			return &libhive.ExecInfo{Stdout: "script output", ExitCode: 3}, nil
+		},
 	}
-	if !strings.Contains(err.Error(), "unknown 'CLIENT'") {
-		t.Fatalf("wrong error for GetNode with unknown CLIENT parameter: %q", err.Error())
+	tm, srv := newFakeAPI(hooks)
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	testID, err := sim.StartTest(suiteID, "test", "")
+	if err != nil {
+		t.Fatal("can't start test:", err)
+	}
+	clientID, _, err := sim.StartClientWithOptions(suiteID, testID, "client-1")
+	if err != nil {
+		t.Fatal("can't start client:", err)
+	}
+
+	script := []byte("#!/bin/sh\necho \"$1\" | grep -q 'a b'\n")
+	res, err := sim.ClientRunScript(suiteID, testID, clientID, script, "a b", `"c"`)
+	if err != nil {
+		t.Fatal("failed to run script:", err)
+	}
+	if res.Stdout != "script output" || res.ExitCode != 3 {
+		t.Fatalf("wrong result %+v", res)
+	}
+	if len(uploaded) != 1 || len(cmds) != 2 {
+		t.Fatalf("wrong uploads %d or commands %q", len(uploaded), cmds)
+	}
+	file := cmds[0][0]
+	if !bytes.Equal(uploaded[file], script) {
+		t.Fatalf("script not uploaded to %s", file)
+	}
+	if want := []string{file, "a b", `"c"`}; !reflect.DeepEqual(cmds[0], want) {
+		t.Fatalf("wrong command %q\nwant %q", cmds[0], want)
+	}
+	if want := []string{"rm", "-f", file}; !reflect.DeepEqual(cmds[1], want) {
+		t.Fatalf("script not removed, command %q", cmds[1])
+	}
+}
+
+// This checks that input can be sent to a program.
+func TestRunProgramStdin(t *testing.T) {
+	hooks := &fakes.BackendHooks{
+		RunProgram: func(containerID string, opt libhive.ExecOptions) (*libhive.ExecInfo, error) {
+			info := &libhive.ExecInfo{Stdout: "no input"}
+			if opt.Stdin != nil {
+				input, _ := ioutil.ReadAll(opt.Stdin)
+				info.Stdout = "input: " + string(input)
+			}
+			return info, nil
+		},
+	}
+	tm, srv := newFakeAPI(hooks)
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	testID, err := sim.StartTest(suiteID, "test", "")
+	if err != nil {
+		t.Fatal("can't start test:", err)
+	}
+	clientID, _, err := sim.StartClientWithOptions(suiteID, testID, "client-1")
+	if err != nil {
+		t.Fatal("can't start client:", err)
+	}
+
+	res, err := sim.ClientExecWithOptions(suiteID, testID, clientID, []string{"cat"}, WithStdin(strings.NewReader("{}")))
+	if err != nil {
+		t.Fatal("failed to run program:", err)
+	}
+	if want := "input: {}"; res.Stdout != want {
+		t.Fatalf("wrong std out %q\nwant %q", res.Stdout, want)
+	}
+	res, err = sim.ClientExecWithOptions(suiteID, testID, clientID, []string{"cat"}, WithStdin(nil))
+	if err != nil {
+		t.Fatal("failed to run program:", err)
+	}
+	if want := "no input"; res.Stdout != want {
+		t.Fatalf("wrong std out %q\nwant %q", res.Stdout, want)
 	}
 }
 
+// This checks that a program exceeding its timeout is reported.
+func TestRunProgramTimeout(t *testing.T) {
+	var gotTimeout time.Duration
+	hooks := &fakes.BackendHooks{
+		RunProgram: func(containerID string, opt libhive.ExecOptions) (*libhive.ExecInfo, error) {
+			gotTimeout = opt.Timeout
+			return &libhive.ExecInfo{Stdout: "partial", ExitCode: 137}, libhive.ErrExecTimeout
+		},
+	}
+	tm, srv := newFakeAPI(hooks)
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	testID, err := sim.StartTest(suiteID, "test", "")
+	if err != nil {
+		t.Fatal("can't start test:", err)
+	}
+	clientID, _, err := sim.StartClientWithOptions(suiteID, testID, "client-1")
+	if err != nil {
+		t.Fatal("can't start client:", err)
+	}
+
+	res, err := sim.ClientExecWithOptions(suiteID, testID, clientID, []string{"sleep"}, WithExecTimeout(3*time.Second))
+	if err != ErrExecTimeout {
+		t.Fatalf("wrong error %v", err)
+	}
+	if gotTimeout != 3*time.Second {
+		t.Fatalf("wrong timeout %v sent to backend", gotTimeout)
+	}
+	if res == nil || res.Stdout != "partial" || res.ExitCode != 137 {
+		t.Fatalf("wrong result %+v", res)
+	}
+
+	var stdout strings.Builder
+	code, err := sim.ClientExecStream(context.Background(), suiteID, testID, clientID, []string{"sleep"}, &stdout, ioutil.Discard, WithExecTimeout(time.Second))
+	if err != ErrExecTimeout {
+		t.Fatalf("wrong error from stream %v", err)
+	}
+	if stdout.String() != "partial" || code != 137 {
+		t.Fatalf("wrong stream result %q, exit code %d", stdout.String(), code)
+	}
+}
+
+// This checks that the working directory of a program is sent to the backend.
+func TestRunProgramWorkDir(t *testing.T) {
+	var gotDir string
+	hooks := &fakes.BackendHooks{
+		RunProgram: func(containerID string, opt libhive.ExecOptions) (*libhive.ExecInfo, error) {
+			gotDir = opt.WorkDir
+			return &libhive.ExecInfo{}, nil
+		},
+	}
+	tm, srv := newFakeAPI(hooks)
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	testID, err := sim.StartTest(suiteID, "test", "")
+	if err != nil {
+		t.Fatal("can't start test:", err)
+	}
+	clientID, _, err := sim.StartClientWithOptions(suiteID, testID, "client-1")
+	if err != nil {
+		t.Fatal("can't start client:", err)
+	}
+
+	if _, err := sim.ClientExecWithOptions(suiteID, testID, clientID, []string{"ls"}, WithWorkDir("/data")); err != nil {
+		t.Fatal("failed to run program:", err)
+	}
+	if gotDir != "/data" {
+		t.Fatalf("wrong working directory %q sent to backend", gotDir)
+	}
+	_, err = sim.ClientExecWithOptions(suiteID, testID, clientID, []string{"ls"}, WithWorkDir("data"))
+	if err == nil || !strings.Contains(err.Error(), "not an absolute path") {
+		t.Fatalf("wrong error for relative working directory: %v", err)
+	}
+}
+
+// This checks that environment variables are sent for a single program only.
+func TestRunProgramEnv(t *testing.T) {
+	var gotEnv []map[string]string
+	hooks := &fakes.BackendHooks{
+		RunProgram: func(containerID string, opt libhive.ExecOptions) (*libhive.ExecInfo, error) {
+			gotEnv = append(gotEnv, opt.Env)
+			return &libhive.ExecInfo{}, nil
+		},
+	}
+	tm, srv := newFakeAPI(hooks)
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	testID, err := sim.StartTest(suiteID, "test", "")
+	if err != nil {
+		t.Fatal("can't start test:", err)
+	}
+	clientID, _, err := sim.StartClientWithOptions(suiteID, testID, "client-1")
+	if err != nil {
+		t.Fatal("can't start client:", err)
+	}
+
+	_, err = sim.ClientExecWithOptions(suiteID, testID, clientID, []string{"ls"},
+		WithExecEnv(map[string]string{"LOG_LEVEL": "3", "RPC": "a"}), WithExecEnv(map[string]string{"RPC": "b"}))
+	if err != nil {
+		t.Fatal("failed to run program:", err)
+	}
+	if _, err := sim.ClientExecWithOptions(suiteID, testID, clientID, []string{"ls"}); err != nil {
+		t.Fatal("failed to run program:", err)
+	}
+	want := []map[string]string{{"LOG_LEVEL": "3", "RPC": "b"}, nil}
+	if !reflect.DeepEqual(gotEnv, want) {
+		t.Fatalf("wrong environment sent to backend: %v", gotEnv)
+	}
+	_, err = sim.ClientExecWithOptions(suiteID, testID, clientID, []string{"ls"}, WithExecEnv(map[string]string{"A=B": "1"}))
+	if err == nil || !strings.Contains(err.Error(), "invalid environment variable name") {
+		t.Fatalf("wrong error for invalid variable name: %v", err)
+	}
+}
+
+// This test checks that the user and group of commands are sent to the backend.
+func TestRunProgramUser(t *testing.T) {
+	var gotUsers []string
+	hooks := &fakes.BackendHooks{
+		RunProgram: func(containerID string, opt libhive.ExecOptions) (*libhive.ExecInfo, error) {
+			gotUsers = append(gotUsers, opt.User)
+			return &libhive.ExecInfo{}, nil
+		},
+	}
+	tm, srv := newFakeAPI(hooks)
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	testID, err := sim.StartTest(suiteID, "test", "")
+	if err != nil {
+		t.Fatal("can't start test:", err)
+	}
+	clientID, _, err := sim.StartClientWithOptions(suiteID, testID, "client-1")
+	if err != nil {
+		t.Fatal("can't start client:", err)
+	}
+
+	for _, opts := range [][]ExecOption{
+		nil,
+		{WithExecUser("geth")},
+		{WithExecUser("1000"), WithExecGroup("fixtures")},
+	} {
+		if _, err := sim.ClientExecWithOptions(suiteID, testID, clientID, []string{"ls"}, opts...); err != nil {
+			t.Fatal("failed to run program:", err)
+		}
+	}
+	want := []string{"", "geth", "1000:fixtures"}
+	if !reflect.DeepEqual(gotUsers, want) {
+		t.Fatalf("wrong users sent to backend: %q", gotUsers)
+	}
+
+	_, err = sim.ClientExecWithOptions(suiteID, testID, clientID, []string{"ls"}, WithExecGroup("fixtures"))
+	if err == nil || !strings.Contains(err.Error(), "group requires user") {
+		t.Fatalf("wrong error for group without user: %v", err)
+	}
+}
+
+// This checks that the output of a program can be streamed.
+func TestRunProgramStream(t *testing.T) {
+	hooks := &fakes.BackendHooks{
+		RunProgram: func(containerID string, opt libhive.ExecOptions) (*libhive.ExecInfo, error) {
+			return &libhive.ExecInfo{Stdout: "line 1\nline 2\n", Stderr: "warning\n", ExitCode: 3}, nil
+		},
+	}
+	tm, srv := newFakeAPI(hooks)
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	testID, err := sim.StartTest(suiteID, "test", "")
+	if err != nil {
+		t.Fatal("can't start test:", err)
+	}
+	clientID, _, err := sim.StartClientWithOptions(suiteID, testID, "client-1")
+	if err != nil {
+		t.Fatal("can't start client:", err)
+	}
+
+	var stdout, stderr strings.Builder
+	code, err := sim.ClientExecStream(context.Background(), suiteID, testID, clientID, []string{"echo"}, &stdout, &stderr)
+	if err != nil {
+		t.Fatal("failed to run program:", err)
+	}
+	if want := "line 1\nline 2\n"; stdout.String() != want {
+		t.Fatalf("wrong std out %q\nwant %q", stdout.String(), want)
+	}
+	if want := "warning\n"; stderr.String() != want {
+		t.Fatalf("wrong std err %q\nwant %q", stderr.String(), want)
+	}
+	if code != 3 {
+		t.Fatalf("wrong exit code %d", code)
+	}
+}
+
+// This checks that client logs can be retrieved.
+func TestClientLogs(t *testing.T) {
+	var gotOptions libhive.LogsOptions
+	hooks := &fakes.BackendHooks{
+		ContainerLogs: func(containerID string, opt libhive.LogsOptions) (string, error) {
+			gotOptions = opt
+			return "INFO Starting node\n", nil
+		},
+	}
+	tm, srv := newFakeAPI(hooks)
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	testID, err := sim.StartTest(suiteID, "test", "")
+	if err != nil {
+		t.Fatal("can't start test:", err)
+	}
+	clientID, _, err := sim.StartClientWithOptions(suiteID, testID, "client-1")
+	if err != nil {
+		t.Fatal("can't start client:", err)
+	}
+
+	since := time.Unix(1600000000, 0)
+	logs, err := sim.ClientLogsWithOptions(suiteID, testID, clientID, LogsOptions{Follow: true, Since: since})
+	if err != nil {
+		t.Fatal("can't get logs:", err)
+	}
+	defer logs.Close()
+	output, err := ioutil.ReadAll(logs)
+	if err != nil {
+		t.Fatal("can't read logs:", err)
+	}
+	if want := "INFO Starting node\n"; string(output) != want {
+		t.Fatalf("wrong logs %q\nwant %q", output, want)
+	}
+	if !gotOptions.Follow || !gotOptions.Since.Equal(since) {
+		t.Fatalf("wrong options %+v", gotOptions)
+	}
+
+	// Unknown node.
+	if _, err := sim.ClientLogs(suiteID, testID, "unknown"); err == nil {
+		t.Fatal("expected error for unknown node")
+	}
+}
+
+// This checks that StartClients starts clients in order and reports failures.
+func TestStartClients(t *testing.T) {
+	tm, srv := newFakeAPI(nil)
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	testID, err := sim.StartTest(suiteID, "test", "")
+	if err != nil {
+		t.Fatal("can't start test:", err)
+	}
+
+	specs := make([]ClientStartSpec, 20)
+	for i := range specs {
+		specs[i] = ClientStartSpec{Type: "client-1", Options: []StartOption{Params{"HIVE_NODE": "x"}}}
+	}
+	specs[3].Type = "unknown"
+	specs[17].Type = "unknown"
+	clients, err := sim.StartClients(suiteID, testID, specs)
+	startErr, ok := err.(*StartClientsError)
+	if !ok {
+		t.Fatalf("wrong error type %T: %v", err, err)
+	}
+	if len(startErr.Errors) != 2 || startErr.Errors[3] == nil || startErr.Errors[17] == nil {
+		t.Fatalf("wrong failed specs: %v", err)
+	}
+	if len(clients) != len(specs) {
+		t.Fatalf("wrong number of clients %d", len(clients))
+	}
+	seen := make(map[string]bool)
+	for i, c := range clients {
+		if i == 3 || i == 17 {
+			continue
+		}
+		if c.Container == "" || c.IP == nil || seen[c.Container] {
+			t.Fatalf("invalid client %d: %+v", i, c)
+		}
+		seen[c.Container] = true
+	}
+}
+
+// This checks that StartClients stops started clients when the context is cancelled.
+func TestStartClientsCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		mu      sync.Mutex
+		deleted []string
+	)
+	tm, srv := newFakeAPI(&fakes.BackendHooks{
+		DeleteContainer: func(containerID string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			deleted = append(deleted, containerID)
+			return nil
+		},
+	})
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	testID, err := sim.StartTest(suiteID, "test", "")
+	if err != nil {
+		t.Fatal("can't start test:", err)
+	}
+
+	// Cancel the context when the first client has started.
+	sim.SetHTTPClient(&http.Client{
+		Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			resp, err := http.DefaultTransport.RoundTrip(req)
+			if err != nil || req.Method != http.MethodPost || !strings.HasSuffix(req.URL.Path, "/node") {
+				return resp, err
+			}
+			body, err := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+			cancel()
+			return resp, err
+		}),
+	})
+	specs := []ClientStartSpec{{Type: "client-1"}, {Type: "client-1"}, {Type: "client-1"}}
+	clients, err := sim.StartClientsContext(ctx, suiteID, testID, specs)
+	if err != context.Canceled {
+		t.Fatalf("wrong error: %v", err)
+	}
+	if clients != nil {
+		t.Fatalf("clients returned after cancellation: %v", clients)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(deleted) == 0 {
+		t.Fatal("no clients were stopped")
+	}
+}
+
+// This checks that StartClientsContext stops clients with an invalid start response
+// when the context is cancelled.
+func TestStartClientsCancelInvalidResponse(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		mu      sync.Mutex
+		deleted []string
+	)
+	tm, srv := newFakeAPI(&fakes.BackendHooks{
+		DeleteContainer: func(containerID string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			deleted = append(deleted, containerID)
+			return nil
+		},
+	})
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	testID, err := sim.StartTest(suiteID, "test", "")
+	if err != nil {
+		t.Fatal("can't start test:", err)
+	}
+
+	// Replace the IP in the start response and cancel the context.
+	var started string
+	sim.SetHTTPClient(&http.Client{
+		Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			resp, err := http.DefaultTransport.RoundTrip(req)
+			if err != nil || req.Method != http.MethodPost || !strings.HasSuffix(req.URL.Path, "/node") {
+				return resp, err
+			}
+			body, err := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			started = strings.Split(string(body), "@")[0]
+			resp.Body = ioutil.NopCloser(strings.NewReader(started + "@bogus"))
+			cancel()
+			return resp, err
+		}),
+	})
+	specs := []ClientStartSpec{{Type: "client-1"}}
+	if _, err := sim.StartClientsContext(ctx, suiteID, testID, specs); err != context.Canceled {
+		t.Fatalf("wrong error: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(deleted) != 1 || deleted[0] != started {
+		t.Fatalf("wrong clients stopped %v, want %s", deleted, started)
+	}
+}
+
+// This checks that Nodes lists the running clients of a test.
+func TestNodes(t *testing.T) {
+	tm, srv := newFakeAPI(nil)
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	testID, err := sim.StartTest(suiteID, "test", "")
+	if err != nil {
+		t.Fatal("can't start test:", err)
+	}
+	id1, ip1, err := sim.StartClientWithOptions(suiteID, testID, "client-1")
+	if err != nil {
+		t.Fatal("can't start client:", err)
+	}
+	id2, _, err := sim.StartClientWithOptions(suiteID, testID, "client-2")
+	if err != nil {
+		t.Fatal("can't start client:", err)
+	}
+	if err := sim.StopClient(suiteID, testID, id2); err != nil {
+		t.Fatal("can't stop client:", err)
+	}
+
+	nodes, err := sim.Nodes(suiteID, testID)
+	if err != nil {
+		t.Fatal("can't list nodes:", err)
+	}
+	want := []NodeInfo{{ID: id1, Type: "client-1", IP: ip1}}
+	if len(nodes) != 1 || nodes[0].ID != want[0].ID || nodes[0].Type != want[0].Type || !nodes[0].IP.Equal(ip1) {
+		t.Fatalf("wrong nodes %+v\nwant %+v", nodes, want)
+	}
+}
+
+// This checks that StopAllClients stops all clients and reports failures.
+func TestStopAllClients(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		stubborn string
+		deleted  = make(map[string]bool)
+	)
+	tm, srv := newFakeAPI(&fakes.BackendHooks{
+		DeleteContainer: func(containerID string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			if containerID == stubborn {
+				return errors.New("container is stuck")
+			}
+			deleted[containerID] = true
+			return nil
+		},
+	})
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	testID, err := sim.StartTest(suiteID, "test", "")
+	if err != nil {
+		t.Fatal("can't start test:", err)
+	}
+	var ids []string
+	for i := 0; i < 3; i++ {
+		id, _, err := sim.StartClientWithOptions(suiteID, testID, "client-1")
+		if err != nil {
+			t.Fatal("can't start client:", err)
+		}
+		ids = append(ids, id)
+	}
+	mu.Lock()
+	stubborn = ids[1]
+	mu.Unlock()
+
+	err = sim.StopAllClients(suiteID, testID)
+	errs, ok := err.(ContainerErrors)
+	if !ok {
+		t.Fatalf("wrong error type %T: %v", err, err)
+	}
+	if len(errs) != 1 || errs[ids[1]] == nil {
+		t.Fatalf("wrong errors: %v", errs)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !deleted[ids[0]] || !deleted[ids[2]] {
+		t.Fatalf("not all clients were stopped: %v", deleted)
+	}
+}
+
+// This checks that RestartClient returns the new IP of the client.
+func TestRestartClient(t *testing.T) {
+	var restarted string
+	hooks := &fakes.BackendHooks{
+		RestartContainer: func(containerID string, opt libhive.ContainerOptions) (*libhive.ContainerInfo, error) {
+			restarted = containerID
+			return &libhive.ContainerInfo{IP: "192.0.2.99"}, nil
+		},
+	}
+	tm, srv := newFakeAPI(hooks)
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	testID, err := sim.StartTest(suiteID, "test", "")
+	if err != nil {
+		t.Fatal("can't start test:", err)
+	}
+	clientID, _, err := sim.StartClientWithOptions(suiteID, testID, "client-1")
+	if err != nil {
+		t.Fatal("can't start client:", err)
+	}
+
+	ip, err := sim.RestartClient(suiteID, testID, clientID)
+	if err != nil {
+		t.Fatal("restart failed:", err)
+	}
+	if restarted != clientID {
+		t.Fatalf("wrong container restarted: %q", restarted)
+	}
+	if !ip.Equal(net.IP{192, 0, 2, 99}) {
+		t.Fatalf("wrong IP returned: %v", ip)
+	}
+
+	// Stopped clients can't be restarted.
+	if err := sim.StopClient(suiteID, testID, clientID); err != nil {
+		t.Fatal("stop failed:", err)
+	}
+	if _, err := sim.RestartClient(suiteID, testID, clientID); err == nil {
+		t.Fatal("expected error restarting stopped client")
+	}
+}
+
+// This checks that ReconfigureClient writes the client parameters to the environment
+// file of the container before restarting it.
+func TestReconfigureClient(t *testing.T) {
+	var (
+		envFile  string
+		files    = make(map[string]string)
+		restarts int
+	)
+	hooks := &fakes.BackendHooks{
+		CreateContainer: func(image string, opt libhive.ContainerOptions) (string, error) {
+			envFile = opt.EnvFile
+			return "container-1", nil
+		},
+		UploadArchive: func(containerID, dir string, archive io.Reader) error {
+			tr := tar.NewReader(archive)
+			header, err := tr.Next()
+			if err != nil {
+				return err
+			}
+			content, err := ioutil.ReadAll(tr)
+			files[dir+header.Name] = string(content)
+			return err
+		},
+		RestartContainer: func(containerID string, opt libhive.ContainerOptions) (*libhive.ContainerInfo, error) {
+			restarts++
+			return &libhive.ContainerInfo{IP: "192.0.2.99"}, nil
+		},
+	}
+	tm, srv := newFakeAPI(hooks)
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	testID, err := sim.StartTest(suiteID, "test", "")
+	if err != nil {
+		t.Fatal("can't start test:", err)
+	}
+	clientID, _, err := sim.StartClientWithOptions(suiteID, testID, "client-1")
+	if err != nil {
+		t.Fatal("can't start client:", err)
+	}
+	if envFile == "" {
+		t.Fatal("client created without environment file")
+	}
+
+	ip, err := sim.ReconfigureClient(suiteID, testID, clientID, map[string]string{"HIVE_NETWORK_ID": "7", "HIVE_NAME": "it's"})
+	if err != nil {
+		t.Fatal("reconfigure failed:", err)
+	}
+	if !ip.Equal(net.IP{192, 0, 2, 99}) {
+		t.Fatalf("wrong IP returned: %v", ip)
+	}
+	want := "HIVE_NAME='it'\\''s'\nHIVE_NETWORK_ID='7'\n"
+	if got := files[envFile]; got != want {
+		t.Fatalf("wrong environment file %q: %q", envFile, got)
+	}
+
+	// Parameters of earlier calls are kept.
+	if _, err := sim.ReconfigureClient(suiteID, testID, clientID, map[string]string{"HIVE_NETWORK_ID": "8"}); err != nil {
+		t.Fatal("reconfigure failed:", err)
+	}
+	want = "HIVE_NAME='it'\\''s'\nHIVE_NETWORK_ID='8'\n"
+	if got := files[envFile]; got != want {
+		t.Fatalf("wrong environment file %q: %q", envFile, got)
+	}
+	if restarts != 2 {
+		t.Fatalf("client restarted %d times, want 2", restarts)
+	}
+
+	// Parameters must be HIVE_* variables.
+	_, err = sim.ReconfigureClient(suiteID, testID, clientID, map[string]string{"PATH": "/"})
+	if httpErr, ok := err.(*HTTPError); !ok || httpErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("wrong error for invalid parameter: %v", err)
+	}
+	if restarts != 2 {
+		t.Fatal("client restarted with invalid parameter")
+	}
+}
+
+// This checks that a failed restart keeps the client running, and that other requests
+// are not blocked while a client restarts.
+func TestRestartClientNotStopped(t *testing.T) {
+	var (
+		entered = make(chan struct{})
+		release = make(chan struct{})
+	)
+	hooks := &fakes.BackendHooks{
+		RestartContainer: func(containerID string, opt libhive.ContainerOptions) (*libhive.ContainerInfo, error) {
+			close(entered)
+			<-release
+			return nil, fmt.Errorf("%w: timeout", libhive.ErrContainerNotStopped)
+		},
+	}
+	tm, srv := newFakeAPI(hooks)
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	testID, err := sim.StartTest(suiteID, "test", "")
+	if err != nil {
+		t.Fatal("can't start test:", err)
+	}
+	clientID, _, err := sim.StartClientWithOptions(suiteID, testID, "client-1")
+	if err != nil {
+		t.Fatal("can't start client:", err)
+	}
+
+	restartErr := make(chan error, 1)
+	go func() {
+		_, err := sim.RestartClient(suiteID, testID, clientID)
+		restartErr <- err
+	}()
+	<-entered
+
+	// Requests for the test work while the client restarts.
+	if _, err := sim.Nodes(suiteID, testID); err != nil {
+		t.Fatal("can't list clients during restart:", err)
+	}
+	if _, err := sim.RestartClient(suiteID, testID, clientID); err == nil {
+		t.Fatal("expected error for concurrent restart")
+	}
+	close(release)
+	if err := <-restartErr; err == nil {
+		t.Fatal("expected restart error")
+	}
+
+	// The client wasn't stopped, so it can still be used.
+	alive, _, err := sim.ClientIsAlive(suiteID, testID, clientID)
+	if err != nil || !alive {
+		t.Fatalf("client not alive after failed restart: alive=%v err=%v", alive, err)
+	}
+	if err := sim.StopClient(suiteID, testID, clientID); err != nil {
+		t.Fatal("stop failed:", err)
+	}
+}
+
+// This checks that ClientInspect returns the backend output.
+func TestClientInspect(t *testing.T) {
+	tm, srv := newFakeAPI(nil)
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	testID, err := sim.StartTest(suiteID, "test", "")
+	if err != nil {
+		t.Fatal("can't start test:", err)
+	}
+	clientID, _, err := sim.StartClientWithOptions(suiteID, testID, "client-1")
+	if err != nil {
+		t.Fatal("can't start client:", err)
+	}
+
+	info, err := sim.ClientInspect(suiteID, testID, clientID)
+	if err != nil {
+		t.Fatal("can't inspect client:", err)
+	}
+	var container struct{ Id string }
+	if err := json.Unmarshal(info, &container); err != nil {
+		t.Fatal("can't decode inspect output:", err)
+	}
+	if container.Id != clientID {
+		t.Fatalf("wrong container ID %q", container.Id)
+	}
+}
+
+// This checks that client resource usage can be retrieved.
+func TestClientStats(t *testing.T) {
+	hooks := &fakes.BackendHooks{
+		ContainerStats: func(containerID string) ([]*libhive.ContainerStats, error) {
+			return []*libhive.ContainerStats{
+				{CPUPercent: 50, MemoryUsage: 100, MemoryLimit: 1000},
+				{CPUPercent: 150, MemoryUsage: 200, MemoryLimit: 1000},
+				{CPUPercent: 75, MemoryUsage: 300, MemoryLimit: 1000, NetworkRxBytes: 10},
+			}, nil
+		},
+	}
+	tm, srv := newFakeAPI(hooks)
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	testID, err := sim.StartTest(suiteID, "test", "")
+	if err != nil {
+		t.Fatal("can't start test:", err)
+	}
+	clientID, _, err := sim.StartClientWithOptions(suiteID, testID, "client-1")
+	if err != nil {
+		t.Fatal("can't start client:", err)
+	}
+
+	stats, err := sim.ClientStats(suiteID, testID, clientID)
+	if err != nil {
+		t.Fatal("can't get stats:", err)
+	}
+	if stats.CPUPercent != 50 || stats.MemoryUsage != 100 || stats.MemoryLimit != 1000 {
+		t.Fatalf("wrong stats %+v", stats)
+	}
+
+	var samples []ContainerStats
+	err = sim.ClientStatsStream(context.Background(), suiteID, testID, clientID, 0, func(s ContainerStats) {
+		samples = append(samples, s)
+	})
+	if err != nil {
+		t.Fatal("stats stream failed:", err)
+	}
+	if len(samples) != 3 || samples[2].NetworkRxBytes != 10 {
+		t.Fatalf("wrong samples %+v", samples)
+	}
+}
+
+// This checks that files can be read from a client container.
+func TestCopyFileFromClient(t *testing.T) {
+	hooks := &fakes.BackendHooks{
+		DownloadFiles: func(containerID, path string, w io.Writer) error {
+			tw := tar.NewWriter(w)
+			switch path {
+			case "/nodekey":
+				tw.WriteHeader(&tar.Header{Name: "nodekey", Typeflag: tar.TypeReg, Mode: 0600, Size: 3})
+				tw.Write([]byte("key"))
+			case "/data":
+				tw.WriteHeader(&tar.Header{Name: "data/", Typeflag: tar.TypeDir, Mode: 0755})
+				tw.WriteHeader(&tar.Header{Name: "data/a", Typeflag: tar.TypeReg, Mode: 0644, Size: 1})
+				tw.Write([]byte("a"))
+			default:
+				return errors.New("no such file")
+			}
+			return tw.Close()
+		},
+	}
+	tm, srv := newFakeAPI(hooks)
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	testID, err := sim.StartTest(suiteID, "test", "")
+	if err != nil {
+		t.Fatal("can't start test:", err)
+	}
+	clientID, _, err := sim.StartClientWithOptions(suiteID, testID, "client-1")
+	if err != nil {
+		t.Fatal("can't start client:", err)
+	}
+
+	// Regular file.
+	r, err := sim.CopyFileFromClient(suiteID, testID, clientID, "/nodekey")
+	if err != nil {
+		t.Fatal("can't copy file:", err)
+	}
+	content, err := ioutil.ReadAll(r)
+	r.Close()
+	if err != nil || string(content) != "key" {
+		t.Fatalf("wrong file content %q (err %v)", content, err)
+	}
+
+	// Directory.
+	r, err = sim.CopyFileFromClient(suiteID, testID, clientID, "/data")
+	if err != nil {
+		t.Fatal("can't copy directory:", err)
+	}
+	defer r.Close()
+	var names []string
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal("can't read archive:", err)
+		}
+		names = append(names, header.Name)
+	}
+	if want := []string{"data/", "data/a"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("wrong archive entries %q, want %q", names, want)
+	}
+
+	// Missing file.
+	_, err = sim.CopyFileFromClient(suiteID, testID, clientID, "/missing")
+	if httpErr, ok := err.(*HTTPError); !ok || httpErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("wrong error for missing file: %v", err)
+	}
+
+	// Cancelled request.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = sim.CopyFileFromClientContext(ctx, suiteID, testID, clientID, "/nodekey")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("wrong error for cancelled request: %v", err)
+	}
+}
+
+// This checks that files can be written to a client container.
+func TestCopyFileToClient(t *testing.T) {
+	var gotDir string
+	var gotHeader *tar.Header
+	var gotContent []byte
+	hooks := &fakes.BackendHooks{
+		UploadArchive: func(containerID, dir string, archive io.Reader) error {
+			tr := tar.NewReader(archive)
+			header, err := tr.Next()
+			if err != nil {
+				return err
+			}
+			gotDir, gotHeader = dir, header
+			gotContent, err = ioutil.ReadAll(tr)
+			return err
+		},
+	}
+	tm, srv := newFakeAPI(hooks)
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	testID, err := sim.StartTest(suiteID, "test", "")
+	if err != nil {
+		t.Fatal("can't start test:", err)
+	}
+	clientID, _, err := sim.StartClientWithOptions(suiteID, testID, "client-1")
+	if err != nil {
+		t.Fatal("can't start client:", err)
+	}
+
+	err = sim.CopyFileToClient(suiteID, testID, clientID, "/config/client.toml", strings.NewReader("[Eth]"))
+	if err != nil {
+		t.Fatal("can't copy file:", err)
+	}
+	if gotDir != "/" || gotHeader.Name != "config/client.toml" || string(gotContent) != "[Eth]" {
+		t.Fatalf("wrong upload: dir %q, name %q, content %q", gotDir, gotHeader.Name, gotContent)
+	}
+	if gotHeader.Mode != 0644 {
+		t.Fatalf("wrong file mode %o", gotHeader.Mode)
+	}
+
+	// Relative paths are rejected.
+	err = sim.CopyFileToClient(suiteID, testID, clientID, "client.toml", strings.NewReader(""))
+	if httpErr, ok := err.(*HTTPError); !ok || httpErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("wrong error for relative path: %v", err)
+	}
+
+	// Cancelled request.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = sim.CopyFileToClientContext(ctx, suiteID, testID, clientID, "/config/client.toml", strings.NewReader(""))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("wrong error for cancelled request: %v", err)
+	}
+}
+
+// This checks that PauseClient and UnpauseClient reach the backend.
+func TestPauseClient(t *testing.T) {
+	var calls []string
+	hooks := &fakes.BackendHooks{
+		PauseContainer: func(containerID string) error {
+			calls = append(calls, "pause "+containerID)
+			return nil
+		},
+		UnpauseContainer: func(containerID string) error {
+			calls = append(calls, "unpause "+containerID)
+			return nil
+		},
+	}
+	tm, srv := newFakeAPI(hooks)
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	testID, err := sim.StartTest(suiteID, "test", "")
+	if err != nil {
+		t.Fatal("can't start test:", err)
+	}
+	clientID, _, err := sim.StartClientWithOptions(suiteID, testID, "client-1")
+	if err != nil {
+		t.Fatal("can't start client:", err)
+	}
+
+	if err := sim.PauseClient(suiteID, testID, clientID); err != nil {
+		t.Fatal("pause failed:", err)
+	}
+	if err := sim.UnpauseClient(suiteID, testID, clientID); err != nil {
+		t.Fatal("unpause failed:", err)
+	}
+	want := []string{"pause " + clientID, "unpause " + clientID}
+	if !reflect.DeepEqual(calls, want) {
+		t.Fatalf("wrong backend calls %q\nwant %q", calls, want)
+	}
+	if err := sim.PauseClient(suiteID, testID, "unknown"); err == nil {
+		t.Fatal("expected error for unknown node")
+	}
+}
+
+// This checks that signals are delivered to the client container.
+func TestSignalClient(t *testing.T) {
+	var signals []int
+	hooks := &fakes.BackendHooks{
+		SignalContainer: func(containerID string, signal int) error {
+			signals = append(signals, signal)
+			return nil
+		},
+	}
+	tm, srv := newFakeAPI(hooks)
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	testID, err := sim.StartTest(suiteID, "test", "")
+	if err != nil {
+		t.Fatal("can't start test:", err)
+	}
+	clientID, _, err := sim.StartClientWithOptions(suiteID, testID, "client-1")
+	if err != nil {
+		t.Fatal("can't start client:", err)
+	}
+
+	for _, sig := range []string{"SIGHUP", "usr1", "12"} {
+		if err := sim.SignalClient(suiteID, testID, clientID, sig); err != nil {
+			t.Fatalf("signal %s failed: %v", sig, err)
+		}
+	}
+	if want := []int{1, 10, 12}; !reflect.DeepEqual(signals, want) {
+		t.Fatalf("wrong signals %v, want %v", signals, want)
+	}
+	if err := sim.SignalClient(suiteID, testID, clientID, "SIGFOO"); err == nil {
+		t.Fatal("expected error for unknown signal")
+	}
+	if err := sim.SignalClient(suiteID, testID, "unknown", "SIGHUP"); err == nil {
+		t.Fatal("expected error for unknown node")
+	}
+}
+
+// This checks that parameters are merged in option order and sent in a stable order.
+func TestStartClientParamsOrder(t *testing.T) {
+	var fields [][]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mr, err := r.MultipartReader()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var names []string
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			value, _ := ioutil.ReadAll(part)
+			names = append(names, part.FormName()+"="+string(value))
+		}
+		fields = append(fields, names)
+		io.WriteString(w, "id@192.0.2.1@00:80:41:ae:fd:7e")
+	}))
+	defer srv.Close()
+
+	sim := NewAt(srv.URL)
+	for i := 0; i < 10; i++ {
+		_, _, err := sim.StartClientWithOptions(1, 1, "client-1",
+			Params{"HIVE_A": "1", "HIVE_B": "1", "HIVE_C": "1"},
+			Bundle(Params{"HIVE_B": "2"}, Params{"HIVE_C": "2"}),
+			Params{"HIVE_C": "3"},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{"CLIENT=client-1", "HIVE_A=1", "HIVE_B=2", "HIVE_C=3"}
+	for _, f := range fields {
+		if !reflect.DeepEqual(f, want) {
+			t.Fatalf("wrong form fields %q, want %q", f, want)
+		}
+	}
+}
+
+// This checks that a start response without a valid IP address is reported as an error.
+func TestStartClientMissingIP(t *testing.T) {
+	tests := []struct {
+		response string
+		wantErr  string
+	}{
+		{"containerid", `no IP address in "containerid"`},
+		{"containerid@not-an-ip@00:80:41:ae:fd:7e", `invalid IP address in "containerid@not-an-ip@00:80:41:ae:fd:7e"`},
+	}
+	for _, test := range tests {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, test.response)
+		}))
+		sim := NewAt(srv.URL)
+		id, ip, err := sim.StartClientWithOptions(1, 1, "client-1")
+		srv.Close()
+		if err == nil {
+			t.Fatalf("expected error for response %q, got IP %v", test.response, ip)
+		}
+		if id != "containerid" {
+			t.Fatalf("wrong container ID %q", id)
+		}
+		if !strings.Contains(err.Error(), test.wantErr) {
+			t.Fatalf("wrong error: %v", err)
+		}
+	}
+}
+
+// This test checks that WithNetworks connects the client before it is started.
+func TestStartClientWithNetworks(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		events  []string
+		deleted []string
+	)
+	tm, srv := newFakeAPI(&fakes.BackendHooks{
+		CreateNetwork: func(name string, opt libhive.NetworkOptions) (string, error) {
+			// Strip the prefix added by hive to get stable IDs.
+			return "net-" + name[strings.LastIndex(name, "_")+1:], nil
+		},
+		ConnectContainer: func(containerID, networkID string, aliases []string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, "connect "+networkID)
+			return nil
+		},
+		StartContainer: func(containerID string, opt libhive.ContainerOptions) (*libhive.ContainerInfo, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, "start")
+			return &libhive.ContainerInfo{ID: containerID, IP: "192.0.2.1"}, nil
+		},
+		DeleteContainer: func(containerID string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			deleted = append(deleted, containerID)
+			return nil
+		},
+	})
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	testID, err := sim.StartTest(suiteID, "test", "")
+	if err != nil {
+		t.Fatal("can't start test:", err)
+	}
+	for _, name := range []string{"a", "b"} {
+		if err := sim.CreateNetwork(suiteID, name); err != nil {
+			t.Fatal("can't create network:", err)
+		}
+	}
+
+	_, _, err = sim.StartClientWithOptions(suiteID, testID, "client-1", WithNetworks("b"), WithNetworks("a"))
+	if err != nil {
+		t.Fatal("can't start client:", err)
+	}
+	mu.Lock()
+	got := events
+	events = nil
+	mu.Unlock()
+	want := []string{"connect net-a", "connect net-b", "start"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("wrong backend calls %q, want %q", got, want)
+	}
+
+	// Unknown networks are rejected, and the container is removed.
+	_, _, err = sim.StartClientWithOptions(suiteID, testID, "client-1", WithNetworks("a", "unknown"))
+	if err == nil {
+		t.Fatal("expected error for unknown network")
+	}
+	if !strings.Contains(err.Error(), `unknown network "unknown"`) {
+		t.Fatalf("wrong error: %v", err)
+	}
+	mu.Lock()
+	got, gotDeleted := events, deleted
+	mu.Unlock()
+	for _, e := range got {
+		if e == "start" {
+			t.Fatal("client started despite unknown network")
+		}
+	}
+	if len(gotDeleted) != 1 {
+		t.Fatalf("container not deleted after network error, deleted %q", gotDeleted)
+	}
+}
+
+// This test checks ContainerIP results for attached and unattached containers.
+func TestContainerIP(t *testing.T) {
+	tm, srv := newFakeAPI(&fakes.BackendHooks{
+		ContainerIP: func(containerID, networkID string) (net.IP, error) {
+			if containerID == "unattached" {
+				return nil, libhive.ErrNotAttached
+			}
+			return net.IP{203, 0, 113, 7}, nil
+		},
+	})
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	if err := sim.CreateNetwork(suiteID, "net1"); err != nil {
+		t.Fatal("can't create network:", err)
+	}
+
+	ip, err := sim.ContainerIP(suiteID, "net1", "attached")
+	if err != nil {
+		t.Fatal("can't get IP:", err)
+	}
+	if !ip.Equal(net.IP{203, 0, 113, 7}) {
+		t.Fatalf("wrong IP %v", ip)
+	}
+	ipString, err := sim.ContainerNetworkIP(suiteID, "net1", "attached")
+	if err != nil {
+		t.Fatal("can't get IP:", err)
+	}
+	if ipString != "203.0.113.7" {
+		t.Fatalf("wrong IP %q from ContainerNetworkIP", ipString)
+	}
+
+	if _, err := sim.ContainerIP(suiteID, "net1", "unattached"); !errors.Is(err, ErrNotAttached) {
+		t.Fatalf("wrong error for unattached container: %v", err)
+	}
+	_, err = sim.ContainerIP(suiteID, "unknown", "attached")
+	if err == nil || errors.Is(err, ErrNotAttached) {
+		t.Fatalf("wrong error for unknown network: %v", err)
+	}
+}
+
+// This test checks that NetworkIPs returns the IPs of all containers on a network.
+func TestNetworkIPs(t *testing.T) {
+	tm, srv := newFakeAPI(&fakes.BackendHooks{
+		NetworkIPs: func(networkID string) (map[string]net.IP, error) {
+			return map[string]net.IP{
+				"c1": {203, 0, 113, 7},
+				"c2": {203, 0, 113, 8},
+			}, nil
+		},
+	})
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	if err := sim.CreateNetwork(suiteID, "net1"); err != nil {
+		t.Fatal("can't create network:", err)
+	}
+
+	ips, err := sim.NetworkIPs(suiteID, "net1")
+	if err != nil {
+		t.Fatal("can't get IPs:", err)
+	}
+	want := map[string]net.IP{
+		"c1": net.ParseIP("203.0.113.7"),
+		"c2": net.ParseIP("203.0.113.8"),
+	}
+	if len(ips) != len(want) {
+		t.Fatalf("wrong IPs %v, want %v", ips, want)
+	}
+	for id, ip := range want {
+		if !ips[id].Equal(ip) {
+			t.Fatalf("wrong IP %v for %s, want %v", ips[id], id, ip)
+		}
+	}
+
+	_, err = sim.NetworkIPs(suiteID, "unknown")
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("wrong error for unknown network: %v", err)
+	}
+}
+
+// This test checks ListNetworks and NetworkExists.
+func TestListNetworks(t *testing.T) {
+	tm, srv := newFakeAPI(nil)
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	names, err := sim.ListNetworks(suiteID)
+	if err != nil {
+		t.Fatal("can't list networks:", err)
+	}
+	if len(names) != 0 {
+		t.Fatalf("wrong networks %q, want none", names)
+	}
+
+	for _, name := range []string{"net2", "net1"} {
+		if err := sim.CreateNetwork(suiteID, name); err != nil {
+			t.Fatal("can't create network:", err)
+		}
+	}
+	names, err = sim.ListNetworks(suiteID)
+	if err != nil {
+		t.Fatal("can't list networks:", err)
+	}
+	if want := []string{"net1", "net2"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("wrong networks %q, want %q", names, want)
+	}
+
+	if ok, err := sim.NetworkExists(suiteID, "net1"); err != nil || !ok {
+		t.Fatalf("NetworkExists(net1) = %v, %v", ok, err)
+	}
+	if ok, err := sim.NetworkExists(suiteID, "net3"); err != nil || ok {
+		t.Fatalf("NetworkExists(net3) = %v, %v", ok, err)
+	}
+}
+
+// This test checks that creating an existing network is reported, and can be ignored
+// using CreateNetworkIfMissing.
+func TestCreateNetworkIfMissing(t *testing.T) {
+	var created int32
+	tm, srv := newFakeAPI(&fakes.BackendHooks{
+		CreateNetwork: func(name string, opt libhive.NetworkOptions) (string, error) {
+			return fmt.Sprint(atomic.AddInt32(&created, 1)), nil
+		},
+	})
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	if err := sim.CreateNetworkIfMissing(suiteID, "net1"); err != nil {
+		t.Fatal("can't create network:", err)
+	}
+	if err := sim.CreateNetworkIfMissing(suiteID, "net1"); err != nil {
+		t.Fatal("CreateNetworkIfMissing failed for existing network:", err)
+	}
+	err = sim.CreateNetwork(suiteID, "net1")
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusConflict {
+		t.Fatalf("wrong error for existing network: %v", err)
+	}
+	if n := atomic.LoadInt32(&created); n != 1 {
+		t.Fatalf("network created %d times", n)
+	}
+
+	// Other errors are still reported.
+	if err := sim.CreateNetworkIfMissing(suiteID+1, "net1"); err == nil {
+		t.Fatal("expected error for unknown suite")
+	}
+}
+
+// This test checks that network options are forwarded to the backend.
+func TestCreateNetworkWithOptions(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		lastOpt libhive.NetworkOptions
+	)
+	tm, srv := newFakeAPI(&fakes.BackendHooks{
+		CreateNetwork: func(name string, opt libhive.NetworkOptions) (string, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			lastOpt = opt
+			return name, nil
+		},
+	})
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	opts := NetworkOptions{Subnet: "10.1.0.0/16", Gateway: "10.1.0.1", Internal: true}
+	if err := sim.CreateNetworkWithOptions(suiteID, "net1", opts); err != nil {
+		t.Fatal("can't create network:", err)
+	}
+	mu.Lock()
+	got := lastOpt
+	mu.Unlock()
+	if want := (libhive.NetworkOptions{Subnet: "10.1.0.0/16", Gateway: "10.1.0.1", Internal: true}); got != want {
+		t.Fatalf("wrong network options %+v, want %+v", got, want)
+	}
+
+	// Plain CreateNetwork leaves the options empty.
+	if err := sim.CreateNetwork(suiteID, "net2"); err != nil {
+		t.Fatal("can't create network:", err)
+	}
+	mu.Lock()
+	got = lastOpt
+	mu.Unlock()
+	if got != (libhive.NetworkOptions{}) {
+		t.Fatalf("wrong network options %+v for CreateNetwork", got)
+	}
+
+	// Invalid options are rejected.
+	invalid := []NetworkOptions{
+		{Subnet: "10.1.0.0"},
+		{Gateway: "10.1.0.1"},
+		{Subnet: "10.2.0.0/16", Gateway: "gw"},
+	}
+	for _, opts := range invalid {
+		err := sim.CreateNetworkWithOptions(suiteID, "net3", opts)
+		var httpErr *HTTPError
+		if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusBadRequest {
+			t.Fatalf("wrong error for options %+v: %v", opts, err)
+		}
+	}
+}
+
+// This test checks that network aliases are forwarded to the backend.
+func TestConnectContainerWithAliases(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		aliases = make(map[string][]string)
+	)
+	tm, srv := newFakeAPI(&fakes.BackendHooks{
+		ConnectContainer: func(containerID, networkID string, a []string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			aliases[containerID] = a
+			return nil
+		},
+		DisconnectContainer: func(containerID, networkID string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			delete(aliases, containerID)
+			return nil
+		},
+	})
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	if err := sim.CreateNetwork(suiteID, "net1"); err != nil {
+		t.Fatal("can't create network:", err)
+	}
+	if err := sim.ConnectContainerWithAliases(suiteID, "net1", "c1", "bootnode", "node-1"); err != nil {
+		t.Fatal("can't connect container:", err)
+	}
+	if err := sim.ConnectContainer(suiteID, "net1", "c2"); err != nil {
+		t.Fatal("can't connect container:", err)
+	}
+	if err := sim.DisconnectContainer(suiteID, "net1", "c2"); err != nil {
+		t.Fatal("can't disconnect container:", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := map[string][]string{"c1": {"bootnode", "node-1"}}
+	if !reflect.DeepEqual(aliases, want) {
+		t.Fatalf("wrong aliases %q, want %q", aliases, want)
+	}
+}
+
+// This test checks that StopClientWithOptions forwards the signal and timeout.
+func TestStopClientWithOptions(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		stops []libhive.StopOptions
+	)
+	tm, srv := newFakeAPI(&fakes.BackendHooks{
+		StopContainer: func(containerID string, opt libhive.StopOptions) error {
+			mu.Lock()
+			defer mu.Unlock()
+			stops = append(stops, opt)
+			return nil
+		},
+	})
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	testID, err := sim.StartTest(suiteID, "test", "")
+	if err != nil {
+		t.Fatal("can't start test:", err)
+	}
+	startClient := func() string {
+		id, _, err := sim.StartClientWithOptions(suiteID, testID, "client-1")
+		if err != nil {
+			t.Fatal("can't start client:", err)
+		}
+		return id
+	}
+
+	if err := sim.StopClientWithOptions(suiteID, testID, startClient(), "SIGINT", 10*time.Second); err != nil {
+		t.Fatal("can't stop client:", err)
+	}
+	if err := sim.StopClientWithOptions(suiteID, testID, startClient(), "", 5*time.Second); err != nil {
+		t.Fatal("can't stop client:", err)
+	}
+	// Without options, the client is killed.
+	if err := sim.StopClientWithOptions(suiteID, testID, startClient(), "", 0); err != nil {
+		t.Fatal("can't stop client:", err)
+	}
+	err = sim.StopClientWithOptions(suiteID, testID, startClient(), "SIGBOGUS", 0)
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("wrong error for unknown signal: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []libhive.StopOptions{
+		{Signal: 2, Timeout: 10 * time.Second},
+		{Signal: 0, Timeout: 5 * time.Second},
+	}
+	if !reflect.DeepEqual(stops, want) {
+		t.Fatalf("wrong stop options %+v, want %+v", stops, want)
+	}
+}
+
+// This test checks that other clients can be used while a client stops gracefully.
+func TestStopClientGracefulNotBlocking(t *testing.T) {
+	var (
+		entered = make(chan struct{})
+		release = make(chan struct{})
+	)
+	tm, srv := newFakeAPI(&fakes.BackendHooks{
+		StopContainer: func(containerID string, opt libhive.StopOptions) error {
+			close(entered)
+			<-release
+			return nil
+		},
+	})
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	testID, err := sim.StartTest(suiteID, "test", "")
+	if err != nil {
+		t.Fatal("can't start test:", err)
+	}
+	clientID, _, err := sim.StartClientWithOptions(suiteID, testID, "client-1")
+	if err != nil {
+		t.Fatal("can't start client:", err)
+	}
+
+	stopErr := make(chan error, 1)
+	go func() {
+		stopErr <- sim.StopClientWithOptions(suiteID, testID, clientID, "SIGTERM", time.Minute)
+	}()
+	<-entered
+
+	// Other clients can be started and stopped while the client stops.
+	otherID, _, err := sim.StartClientWithOptions(suiteID, testID, "client-1")
+	if err != nil {
+		t.Fatal("can't start client during stop:", err)
+	}
+	if err := sim.StopClient(suiteID, testID, otherID); err != nil {
+		t.Fatal("can't stop client during stop:", err)
+	}
+	// Stopping the same client again fails while it is stopping.
+	err = sim.StopClient(suiteID, testID, clientID)
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusConflict {
+		t.Fatalf("wrong error for concurrent stop: %v", err)
+	}
+
+	close(release)
+	if err := <-stopErr; err != nil {
+		t.Fatal("stop failed:", err)
+	}
+	if _, _, err := sim.ClientIsAlive(suiteID, testID, clientID); err == nil {
+		t.Fatal("client not stopped")
+	}
+}
+
+// This test checks that stopping all clients waits for clients which are being stopped.
+func TestStopAllClientsWaitsForStop(t *testing.T) {
+	var (
+		entered = make(chan struct{})
+		release = make(chan struct{})
+		mu      sync.Mutex
+		deletes = make(map[string]int)
+	)
+	tm, srv := newFakeAPI(&fakes.BackendHooks{
+		StopContainer: func(containerID string, opt libhive.StopOptions) error {
+			close(entered)
+			<-release
+			return nil
+		},
+		DeleteContainer: func(containerID string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			deletes[containerID]++
+			return nil
+		},
+	})
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	testID, err := sim.StartTest(suiteID, "test", "")
+	if err != nil {
+		t.Fatal("can't start test:", err)
+	}
+	clientID, _, err := sim.StartClientWithOptions(suiteID, testID, "client-1")
+	if err != nil {
+		t.Fatal("can't start client:", err)
+	}
+
+	stopErr := make(chan error, 1)
+	go func() {
+		stopErr <- sim.StopClientWithOptions(suiteID, testID, clientID, "SIGTERM", time.Minute)
+	}()
+	<-entered
+	stopAllErr := make(chan error, 1)
+	go func() {
+		stopAllErr <- sim.StopAllClients(suiteID, testID)
+	}()
+	select {
+	case err := <-stopAllErr:
+		t.Fatal("StopAllClients returned while a client was stopping:", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+	if err := <-stopErr; err != nil {
+		t.Fatal("stop failed:", err)
+	}
+	if err := <-stopAllErr; err != nil {
+		t.Fatal("StopAllClients failed:", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if deletes[clientID] != 1 {
+		t.Fatalf("client deleted %d times", deletes[clientID])
+	}
+}
+
+// This test checks that StopClientWithStatus reports clients which exited on their own.
+func TestStopClientWithStatus(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		crashed = make(map[string]bool)
+		broken  = make(map[string]bool)
+	)
+	tm, srv := newFakeAPI(&fakes.BackendHooks{
+		ContainerState: func(containerID string) (*libhive.ContainerState, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if broken[containerID] {
+				return nil, errors.New("inspect failed")
+			}
+			if crashed[containerID] {
+				return &libhive.ContainerState{Running: false, ExitCode: 2}, nil
+			}
+			return &libhive.ContainerState{Running: true}, nil
+		},
+	})
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	testID, err := sim.StartTest(suiteID, "test", "")
+	if err != nil {
+		t.Fatal("can't start test:", err)
+	}
+	running, _, err := sim.StartClientWithOptions(suiteID, testID, "client-1")
+	if err != nil {
+		t.Fatal("can't start client:", err)
+	}
+	exited, _, err := sim.StartClientWithOptions(suiteID, testID, "client-1")
+	if err != nil {
+		t.Fatal("can't start client:", err)
+	}
+	mu.Lock()
+	crashed[exited] = true
+	mu.Unlock()
+
+	status, err := sim.StopClientWithStatus(suiteID, testID, running)
+	if err != nil {
+		t.Fatal("can't stop client:", err)
+	}
+	if *status != (ClientStopStatus{Running: true}) {
+		t.Errorf("wrong status for running client: %+v", status)
+	}
+	status, err = sim.StopClientWithStatus(suiteID, testID, exited)
+	if err != nil {
+		t.Fatal("can't stop client:", err)
+	}
+	if *status != (ClientStopStatus{Running: false, ExitCode: 2}) {
+		t.Errorf("wrong status for exited client: %+v", status)
+	}
+	// Stopping again reports the same status.
+	status, err = sim.StopClientWithStatus(suiteID, testID, exited)
+	if err != nil {
+		t.Fatal("can't stop client again:", err)
+	}
+	if *status != (ClientStopStatus{Running: false, ExitCode: 2}) {
+		t.Errorf("wrong status for repeated stop: %+v", status)
+	}
+
+	// Clients are stopped even if their state is unknown.
+	unknown, _, err := sim.StartClientWithOptions(suiteID, testID, "client-1")
+	if err != nil {
+		t.Fatal("can't start client:", err)
+	}
+	mu.Lock()
+	broken[unknown] = true
+	mu.Unlock()
+	status, err = sim.StopClientWithStatus(suiteID, testID, unknown)
+	if err != nil {
+		t.Fatal("can't stop client with unknown state:", err)
+	}
+	if status != nil {
+		t.Errorf("wrong status for client with unknown state: %+v", status)
+	}
+	if _, _, err := sim.ClientIsAlive(suiteID, testID, unknown); err == nil {
+		t.Error("client with unknown state was not stopped")
+	}
+}
+
+// This test checks that StopClientWithStatus accepts an empty response, but not an
+// invalid one.
+func TestStopClientWithStatusEmptyResponse(t *testing.T) {
+	var body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, body)
+	}))
+	defer srv.Close()
+	sim := NewAt(srv.URL)
+
+	for _, body = range []string{"", " \n"} {
+		status, err := sim.StopClientWithStatus(1, 2, "client")
+		if err != nil {
+			t.Fatalf("error for response %q: %v", body, err)
+		}
+		if status != nil {
+			t.Fatalf("wrong status for response %q: %+v", body, status)
+		}
+	}
+	body = "{"
+	if _, err := sim.StopClientWithStatus(1, 2, "client"); err == nil {
+		t.Fatal("expected error for invalid response")
+	}
+}
+
+// This test checks ClientIsAlive and WatchClient.
+func TestClientIsAlive(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		crashed = make(map[string]bool)
+	)
+	tm, srv := newFakeAPI(&fakes.BackendHooks{
+		ContainerState: func(containerID string) (*libhive.ContainerState, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if crashed[containerID] {
+				return &libhive.ContainerState{Running: false, ExitCode: 137}, nil
+			}
+			return &libhive.ContainerState{Running: true}, nil
+		},
+	})
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	testID, err := sim.StartTest(suiteID, "test", "")
+	if err != nil {
+		t.Fatal("can't start test:", err)
+	}
+	clientID, _, err := sim.StartClientWithOptions(suiteID, testID, "client-1")
+	if err != nil {
+		t.Fatal("can't start client:", err)
+	}
+
+	alive, _, err := sim.ClientIsAlive(suiteID, testID, clientID)
+	if err != nil {
+		t.Fatal("ClientIsAlive failed:", err)
+	}
+	if !alive {
+		t.Fatal("client not alive after start")
+	}
+
+	// Crash the client while it is being watched.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	events := sim.WatchClient(ctx, suiteID, testID, clientID)
+	time.Sleep(100 * time.Millisecond)
+	mu.Lock()
+	crashed[clientID] = true
+	mu.Unlock()
+
+	ev, ok := <-events
+	if !ok {
+		t.Fatal("watch channel closed without event")
+	}
+	if ev.Err != nil || ev.ExitCode != 137 {
+		t.Errorf("wrong exit event: %+v", ev)
+	}
+	if _, ok := <-events; ok {
+		t.Error("watch channel not closed after event")
+	}
+	alive, exitCode, err := sim.ClientIsAlive(suiteID, testID, clientID)
+	if err != nil {
+		t.Fatal("ClientIsAlive failed:", err)
+	}
+	if alive || exitCode != 137 {
+		t.Errorf("wrong state of crashed client: alive=%v exitCode=%d", alive, exitCode)
+	}
+
+	// Checking a stopped client is an error.
+	if err := sim.StopClient(suiteID, testID, clientID); err != nil {
+		t.Fatal("can't stop client:", err)
+	}
+	if _, _, err := sim.ClientIsAlive(suiteID, testID, clientID); err == nil {
+		t.Error("expected error for stopped client")
+	}
+	ev = <-sim.WatchClient(ctx, suiteID, testID, clientID)
+	if ev.Err == nil {
+		t.Error("expected error event for stopped client")
+	}
+}
+
+// This test checks ClientEnode and WaitForEnode.
+func TestClientEnode(t *testing.T) {
+	const key = "a61215641fb8714a373c80edbfa0ea8878243193f57c96eeb44d0bc019ef295abd4e044fd619bfc4c59731a73fb79afe84e9ab6da0c743ceb479cbb6d263fa91"
+	var calls int32
+	hooks := &fakes.BackendHooks{
+		StartContainer: func(containerID string, opt libhive.ContainerOptions) (*libhive.ContainerInfo, error) {
+			return &libhive.ContainerInfo{ID: containerID, IP: "192.0.2.1"}, nil
+		},
+		RunEnodeSh: func(string) (string, error) {
+			// The node reports its enode URL on the third attempt.
+			if atomic.AddInt32(&calls, 1) < 3 {
+				return "", nil
+			}
+			return "enode://" + key + "@127.0.0.1:30303?discport=30304", nil
+		},
+	}
+	tm, srv := newFakeAPI(hooks)
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	testID, err := sim.StartTest(suiteID, "test", "")
+	if err != nil {
+		t.Fatal("can't start test:", err)
+	}
+	clientID, _, err := sim.StartClientWithOptions(suiteID, testID, "client-1")
+	if err != nil {
+		t.Fatal("can't start client:", err)
+	}
+
+	if _, err := sim.ClientEnode(suiteID, testID, clientID); err == nil {
+		t.Fatal("expected error while node has no enode URL")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	n, err := sim.WaitForEnode(ctx, suiteID, testID, clientID)
+	if err != nil {
+		t.Fatal("wait failed:", err)
+	}
+	if !n.IP().Equal(net.IP{192, 0, 2, 1}) || n.TCP() != 30303 || n.UDP() != 30304 {
+		t.Fatalf("wrong node %v", n)
+	}
+	if url := n.URLv4(); !strings.HasPrefix(url, "enode://"+key+"@") {
+		t.Fatalf("wrong node URL %s", url)
+	}
+
+	// Unknown nodes are not retried.
+	if _, err := sim.WaitForEnode(ctx, suiteID, testID, "unknown"); err == nil || errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("wrong error for unknown node: %v", err)
+	}
+}
+
+// This test checks that an empty enode URL response is reported as ErrNoEnode.
+func TestClientEnodeURLEmpty(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "\n")
+	}))
+	defer srv.Close()
+
+	sim := NewAt(srv.URL)
+	if _, err := sim.ClientEnodeURL(1, 1, "node"); !errors.Is(err, ErrNoEnode) {
+		t.Fatalf("wrong error: %v", err)
+	}
+}
+
+// This test checks that auxiliary processes are started in order after the client.
+func TestStartClientWithExtraStartup(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		started [][]string
+		stopped []string
+		fail    bool
+	)
+	tm, srv := newFakeAPI(&fakes.BackendHooks{
+		StartProgram: func(containerID string, opt libhive.ExecOptions) (string, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if fail {
+				return "", errors.New("exec failed")
+			}
+			started = append(started, opt.Cmd)
+			return "exec", nil
+		},
+		DeleteContainer: func(containerID string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			stopped = append(stopped, containerID)
+			return nil
+		},
+	})
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	testID, err := sim.StartTest(suiteID, "test", "")
+	if err != nil {
+		t.Fatal("can't start test:", err)
+	}
+
+	// Start with more than ten commands to check they aren't sorted by name.
+	var (
+		options []StartOption
+		want    [][]string
+	)
+	for i := 0; i < 12; i++ {
+		options = append(options, WithExtraStartup([]string{"scrape.sh", strconv.Itoa(i)}))
+		want = append(want, []string{"/hive-bin/scrape.sh", strconv.Itoa(i)})
+	}
+	if _, _, err := sim.StartClientWithOptions(suiteID, testID, "client-1", options...); err != nil {
+		t.Fatal("can't start client:", err)
+	}
+	mu.Lock()
+	got := started
+	mu.Unlock()
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("wrong startup commands:\n got %q\nwant %q", got, want)
+	}
+
+	// Invalid commands are rejected.
+	_, _, err = sim.StartClientWithOptions(suiteID, testID, "client-1", WithExtraStartup([]string{"/bin/sh"}))
+	if err == nil || !strings.Contains(err.Error(), "directory separator") {
+		t.Fatalf("wrong error for invalid command: %v", err)
+	}
+	if _, _, err := sim.StartClientWithOptions(suiteID, testID, "client-1", WithExtraStartup(nil)); err == nil {
+		t.Fatal("expected error for empty command")
+	}
+
+	// When the process can't be started, the client is stopped.
+	mu.Lock()
+	fail = true
+	mu.Unlock()
+	_, _, err = sim.StartClientWithOptions(suiteID, testID, "client-1", WithExtraStartup([]string{"scrape.sh"}))
+	if err == nil || !strings.Contains(err.Error(), "exec failed") {
+		t.Fatalf("wrong error for failed startup command: %v", err)
+	}
+	mu.Lock()
+	nstopped := len(stopped)
+	mu.Unlock()
+	if nstopped != 1 {
+		t.Fatalf("client stopped %d times, want 1", nstopped)
+	}
+}
+
+// This test checks starting, inspecting and killing detached commands.
+func TestClientExecDetached(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		state = make(map[string]bool)
+	)
+	tm, srv := newFakeAPI(&fakes.BackendHooks{
+		StartProgram: func(containerID string, opt libhive.ExecOptions) (string, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			state["exec-1"] = true
+			return "exec-1", nil
+		},
+		ProgramStatus: func(containerID, execID string) (*libhive.ProgramStatus, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			r, ok := state[execID]
+			if !ok {
+				return nil, libhive.ErrNoSuchExec
+			}
+			if r {
+				return &libhive.ProgramStatus{Running: true}, nil
+			}
+			return &libhive.ProgramStatus{ExitCode: 137}, nil
+		},
+		KillProgram: func(containerID, execID string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			if _, ok := state[execID]; !ok {
+				return libhive.ErrNoSuchExec
+			}
+			state[execID] = false
+			return nil
+		},
+	})
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	testID, err := sim.StartTest(suiteID, "test", "")
+	if err != nil {
+		t.Fatal("can't start test:", err)
+	}
+	clientID, _, err := sim.StartClientWithOptions(suiteID, testID, "client-1")
+	if err != nil {
+		t.Fatal("can't start client:", err)
+	}
+
+	execID, err := sim.ClientExecDetached(suiteID, testID, clientID, []string{"load.sh"})
+	if err != nil {
+		t.Fatal("can't start command:", err)
+	}
+	if execID != "exec-1" {
+		t.Fatalf("wrong exec ID %q", execID)
+	}
+	running, _, err := sim.ClientExecStatus(suiteID, testID, clientID, execID)
+	if err != nil {
+		t.Fatal("can't get status:", err)
+	}
+	if !running {
+		t.Fatal("command not running")
+	}
+	if err := sim.ClientExecKill(suiteID, testID, clientID, execID); err != nil {
+		t.Fatal("can't kill command:", err)
+	}
+	running, exitCode, err := sim.ClientExecStatus(suiteID, testID, clientID, execID)
+	if err != nil {
+		t.Fatal("can't get status:", err)
+	}
+	if running || exitCode != 137 {
+		t.Fatalf("wrong status after kill: running %t, exit code %d", running, exitCode)
+	}
+
+	// Unknown exec IDs are reported as 404.
+	_, _, err = sim.ClientExecStatus(suiteID, testID, clientID, "exec-2")
+	if httpErr, ok := err.(*HTTPError); !ok || httpErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("wrong error for unknown exec: %v", err)
+	}
+	if _, err := sim.ClientExecDetached(suiteID, testID, clientID, []string{"/bin/sh"}); err == nil {
+		t.Fatal("expected error for invalid command")
+	}
+}
+
+// This test checks that ClientExecCombined preserves the order of output.
+func TestClientExecCombined(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"stdout": "a\n"}`+"\n")
+		io.WriteString(w, `{"stderr": "b\n"}`+"\n")
+		io.WriteString(w, `{"stdout": "c\n"}`+"\n")
+		io.WriteString(w, `{"exitCode": 2}`+"\n")
+	}))
+	defer srv.Close()
+
+	sim := NewAt(srv.URL)
+	output, exitCode, err := sim.ClientExecCombined(context.Background(), 1, 2, "node", []string{"run.sh"})
+	if err != nil {
+		t.Fatal("exec failed:", err)
+	}
+	content, _ := ioutil.ReadAll(output)
+	if string(content) != "a\nb\nc\n" || exitCode != 2 {
+		t.Fatalf("wrong result %q, exit code %d", content, exitCode)
+	}
+}
+
+// This test checks Ping against working and broken API endpoints.
+func TestPing(t *testing.T) {
+	tm, srv := newFakeAPI(nil)
+	defer srv.Close()
+	defer tm.Terminate()
+
+	if err := NewAt(srv.URL).Ping(context.Background()); err != nil {
+		t.Fatal("ping failed:", err)
+	}
+
+	// Invalid responses are reported.
+	badsrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "<html>")
+	}))
+	defer badsrv.Close()
+	err := NewAt(badsrv.URL).Ping(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "invalid response") {
+		t.Fatalf("wrong error for invalid response: %v", err)
+	}
+
+	// Unreachable servers are reported.
+	badsrv.Close()
+	err = NewAt(badsrv.URL).Ping(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "not reachable") {
+		t.Fatalf("wrong error for unreachable server: %v", err)
+	}
+}
+
+// This test checks that NewFromEnv reports a missing or invalid HIVE_SIMULATOR.
+func TestNewFromEnv(t *testing.T) {
+	if old, ok := os.LookupEnv("HIVE_SIMULATOR"); ok {
+		defer os.Setenv("HIVE_SIMULATOR", old)
+	} else {
+		defer os.Unsetenv("HIVE_SIMULATOR")
+	}
+
+	os.Unsetenv("HIVE_SIMULATOR")
+	if _, err := NewFromEnv(); err == nil || !strings.Contains(err.Error(), "not set") {
+		t.Fatalf("wrong error for missing variable: %v", err)
+	}
+	os.Setenv("HIVE_SIMULATOR", "http://[::1")
+	if _, err := NewFromEnv(); err == nil || !strings.Contains(err.Error(), "invalid HIVE_SIMULATOR") {
+		t.Fatalf("wrong error for invalid URL: %v", err)
+	}
+	os.Setenv("HIVE_SIMULATOR", "http://127.0.0.1:3000")
+	sim, err := NewFromEnv()
+	if err != nil {
+		t.Fatal("NewFromEnv failed:", err)
+	}
+	if sim.url != "http://127.0.0.1:3000" {
+		t.Fatalf("wrong URL %q", sim.url)
+	}
+}
+
+// This test checks the validation of API URLs in NewAt.
+func TestNewAtURL(t *testing.T) {
+	if sim := NewAt("http://127.0.0.1:3000//"); sim.url != "http://127.0.0.1:3000" {
+		t.Fatalf("trailing slashes not removed: %q", sim.url)
+	}
+	if sim := NewAt("https://hive.example/api/"); sim.url != "https://hive.example/api" {
+		t.Fatalf("trailing slash not removed: %q", sim.url)
+	}
+	for _, u := range []string{"", "127.0.0.1:3000", "/api", "ftp://hive.example", "http://"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("NewAt(%q) did not panic", u)
+				}
+			}()
+			NewAt(u)
+		}()
+	}
+}
+
+// This test checks that request paths don't depend on a trailing slash in the API URL.
+func TestEndpointTrailingSlash(t *testing.T) {
+	run := func(newSim func(url string) *Simulation) []string {
+		tm, srv := newFakeAPI(nil)
+		defer tm.Terminate()
+		defer srv.Close()
+		var (
+			mu    sync.Mutex
+			paths []string
+		)
+		api := srv.Config.Handler
+		srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			paths = append(paths, r.URL.Path)
+			mu.Unlock()
+			api.ServeHTTP(w, r)
+		})
+
+		sim := newSim(srv.URL)
+		suiteID, err := sim.StartSuite("suite", "", "")
+		if err != nil {
+			t.Fatal("can't start suite:", err)
+		}
+		testID, err := sim.StartTest(suiteID, "test", "")
+		if err != nil {
+			t.Fatal("can't start test:", err)
+		}
+		if _, err := sim.ClientTypes(); err != nil {
+			t.Fatal("can't get client types:", err)
+		}
+		if err := sim.CreateNetwork(suiteID, "net1"); err != nil {
+			t.Fatal("can't create network:", err)
+		}
+		if err := sim.EndTest(suiteID, testID, TestResult{Pass: true}); err != nil {
+			t.Fatal("can't end test:", err)
+		}
+		if err := sim.EndSuite(suiteID); err != nil {
+			t.Fatal("can't end suite:", err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		return paths
+	}
+
+	want := run(NewAt)
+	for _, path := range want {
+		if strings.Contains(path, "//") {
+			t.Fatalf("double slash in request path %q", path)
+		}
+	}
+	withSlash := run(func(url string) *Simulation { return NewAt(url + "/") })
+	if !reflect.DeepEqual(withSlash, want) {
+		t.Fatalf("wrong paths with NewAt and trailing slash:\n got %q\nwant %q", withSlash, want)
+	}
+	literal := run(func(url string) *Simulation { return &Simulation{url: url + "/"} })
+	if !reflect.DeepEqual(literal, want) {
+		t.Fatalf("wrong paths with trailing slash:\n got %q\nwant %q", literal, want)
+	}
+}
+
+// This test checks that a Simulation can be used from multiple goroutines.
+// Run it with the race detector enabled.
+func TestSimulationConcurrentUse(t *testing.T) {
+	tm, srv := newFakeAPI(nil)
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+
+	const workers = 8
+	var (
+		wg   sync.WaitGroup
+		errs = make(chan error, workers)
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- func() error {
+				testID, err := sim.StartTest(suiteID, fmt.Sprintf("test-%d", i), "")
+				if err != nil {
+					return err
+				}
+				if _, err := sim.ClientTypes(); err != nil {
+					return err
+				}
+				clientID, _, err := sim.StartClientWithOptions(suiteID, testID, "client-1")
+				if err != nil {
+					return err
+				}
+				if _, err := sim.ClientExec(suiteID, testID, clientID, []string{"ls"}); err != nil {
+					return err
+				}
+				return sim.EndTest(suiteID, testID, TestResult{Pass: true})
+			}()
+		}(i)
+	}
+	// Configuration changes are allowed while requests are running.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < workers; i++ {
+			sim.SetRetryPolicy(i+1, 0)
+			sim.SetLogger(new(testLogger))
+			sim.SetRequestHook(func(method, path string, status int, d time.Duration) {})
+			sim.SetHTTPClient(nil)
+		}
+	}()
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// This test checks that WithStartTimeout limits the time to wait for the client.
+func TestStartClientTimeout(t *testing.T) {
+	release := make(chan struct{})
+	tm, srv := newFakeAPI(&fakes.BackendHooks{
+		StartContainer: func(containerID string, opt libhive.ContainerOptions) (*libhive.ContainerInfo, error) {
+			select {
+			case <-release:
+			case <-time.After(5 * time.Second):
+			}
+			return &libhive.ContainerInfo{}, nil
+		},
+	})
+	defer srv.Close()
+	defer tm.Terminate()
+	defer close(release)
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	testID, err := sim.StartTest(suiteID, "test", "")
+	if err != nil {
+		t.Fatal("can't start test:", err)
+	}
+	start := time.Now()
+	_, _, err = sim.StartClientWithOptions(suiteID, testID, "client-1", WithStartTimeout(50*time.Millisecond))
+	if !errors.Is(err, ErrStartTimeout) {
+		t.Fatalf("wrong error %v", err)
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Fatalf("start took %v", d)
+	}
+	if _, _, err := sim.StartClientWithOptions(suiteID, testID, "client-1", WithStartTimeout(0)); err == nil {
+		t.Fatal("expected error for zero timeout")
+	}
+}
+
+// This test checks that the start timeout is sent to hive, and that a timeout reported
+// by hive is returned as ErrStartTimeout.
+func TestStartClientTimeoutServer(t *testing.T) {
+	var gotTimeout string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotTimeout = r.FormValue("timeout")
+		http.Error(w, "client did not start: timed out waiting for container startup", http.StatusGatewayTimeout)
+	}))
+	defer srv.Close()
+
+	sim := NewAt(srv.URL)
+	_, _, err := sim.StartClientWithOptions(1, 2, "client-1", WithStartTimeout(time.Minute))
+	if !errors.Is(err, ErrStartTimeout) {
+		t.Fatalf("wrong error %v", err)
+	}
+	if gotTimeout != "1m0s" {
+		t.Fatalf("wrong timeout %q sent to hive", gotTimeout)
+	}
+}
+
+// This test checks that client starts failing with a start timeout are not retried.
+func TestStartClientTimeoutNoRetry(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		http.Error(w, "client did not start: timed out waiting for container startup", http.StatusGatewayTimeout)
+	}))
+	defer srv.Close()
+
+	sim := NewAt(srv.URL)
+	sim.SetRetryPolicy(3, time.Millisecond)
+	_, _, err := sim.StartClientWithOptions(1, 2, "client-1")
+	if !errors.Is(err, ErrStartTimeout) {
+		t.Fatalf("wrong error %v", err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Fatalf("wrong number of requests: %d", n)
+	}
+}
+
+// This test checks that files opened for a client start request are closed when
+// opening another file fails.
+func TestStartClientFileCleanup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hivesim_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		mu      sync.Mutex
+		open    = make(map[string]bool)
+		options []StartOption
+	)
+	trackedFile := func(path string) func() (io.ReadCloser, error) {
+		return func() (io.ReadCloser, error) {
+			f, err := os.Open(path)
+			if err != nil {
+				return nil, err
+			}
+			mu.Lock()
+			open[path] = true
+			mu.Unlock()
+			return &trackedCloser{f, func() {
+				mu.Lock()
+				delete(open, path)
+				mu.Unlock()
+			}}, nil
+		}
+	}
+	for i := 0; i < 5; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("file-%d", i))
+		if err := ioutil.WriteFile(path, []byte("content"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		options = append(options, WithDynamicFile(fmt.Sprintf("/file-%d", i), trackedFile(path)))
+	}
+	missing := filepath.Join(dir, "missing")
+	options = append(options, WithDynamicFile("/missing", trackedFile(missing)))
+
+	sim := NewAt("http://127.0.0.1:1")
+	if _, _, err := sim.StartClientWithOptions(1, 2, "client-1", options...); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("wrong error %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(open) > 0 {
+		t.Fatalf("files not closed: %v", open)
+	}
+}
+
+type trackedCloser struct {
+	io.ReadCloser
+	onClose func()
+}
+
+func (c *trackedCloser) Close() error {
+	c.onClose()
+	return c.ReadCloser.Close()
+}
+
+// This test checks that client files are streamed to hive while they are read.
+func TestStartClientStreamsFiles(t *testing.T) {
+	var (
+		received     = make(chan struct{})
+		receivedOnce sync.Once
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mr, err := r.MultipartReader()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for {
+			part, err := mr.NextPart()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if part.FormName() == "/data" {
+				buf := make([]byte, 5)
+				if _, err := io.ReadFull(part, buf); err != nil || string(buf) != "first" {
+					http.Error(w, "wrong file content", http.StatusBadRequest)
+					return
+				}
+				receivedOnce.Do(func() { close(received) })
+				io.Copy(ioutil.Discard, r.Body)
+				io.WriteString(w, "id@192.0.2.1@mac")
+				return
+			}
+		}
+	}))
+	defer srv.Close()
+
+	// The file source blocks after the first chunk until hive has received it.
+	// This would time out if the request body was buffered.
+	src := func() (io.ReadCloser, error) {
+		pr, pw := io.Pipe()
+		go func() {
+			pw.Write([]byte("first"))
+			select {
+			case <-received:
+				pw.Write([]byte("second"))
+				pw.Close()
+			case <-time.After(5 * time.Second):
+				pw.CloseWithError(errors.New("file was not streamed"))
+			}
+		}()
+		return pr, nil
+	}
+	sim := NewAt(srv.URL)
+	if _, _, err := sim.StartClientWithOptions(1, 2, "client-1", WithDynamicFile("/data", src)); err != nil {
+		t.Fatal("can't start client:", err)
+	}
+
+	// Errors reading a file abort the request.
+	failing := func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(io.MultiReader(strings.NewReader("first"), &errReader{errors.New("disk error")})), nil
+	}
+	_, _, err := sim.StartClientWithOptions(1, 2, "client-1", WithDynamicFile("/data", failing))
+	if err == nil || !strings.Contains(err.Error(), "disk error") {
+		t.Fatalf("wrong error for failing file: %v", err)
+	}
+}
+
+type errReader struct{ err error }
+
+func (r *errReader) Read([]byte) (int, error) { return 0, r.err }
+
+// This test checks that the error for a missing init file names the file.
+func TestStartClientMissingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hivesim_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	existing := filepath.Join(dir, "genesis.json")
+	if err := ioutil.WriteFile(existing, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(dir, "chain.rlp")
+
+	sim := NewAt("http://127.0.0.1:1")
+	_, _, err = sim.StartClientWithOptions(1, 2, "client-1", WithStaticFiles(map[string]string{
+		"/genesis.json": existing,
+		"/chain.rlp":    missing,
+	}))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("wrong error %v", err)
+	}
+	if msg := err.Error(); !strings.Contains(msg, `"/chain.rlp"`) || !strings.Contains(msg, missing) {
+		t.Fatalf("error does not name the missing file: %v", err)
+	}
+}
+
+// This test checks that archive digests are sent with WithTARChecksum and verified by hive.
+func TestStartClientTARChecksum(t *testing.T) {
+	var lastOptions libhive.ContainerOptions
+	tm, srv := newFakeAPI(&fakes.BackendHooks{
+		CreateContainer: func(image string, opt libhive.ContainerOptions) (string, error) {
+			lastOptions = opt
+			return "0123456789abcdef", nil
+		},
+	})
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	testID, err := sim.StartTest(suiteID, "test", "")
+	if err != nil {
+		t.Fatal("can't start test:", err)
+	}
+
+	data := []byte("tar data")
+	src := func() io.ReadCloser { return ioutil.NopCloser(bytes.NewReader(data)) }
+	digests := make(map[int]string)
+	_, _, err = sim.StartClientWithOptions(suiteID, testID, "client-1", WithTAR(src), WithTAR(src),
+		WithTARChecksum(func(archive int, digest string) { digests[archive] = digest }))
+	if err != nil {
+		t.Fatalf("failed to start client: %v", err)
+	}
+	sum := sha256.Sum256(data)
+	want := hex.EncodeToString(sum[:])
+	if len(digests) != 2 || digests[0] != want || digests[1] != want {
+		t.Fatalf("wrong digests %v, want %s for both archives", digests, want)
+	}
+	if _, ok := lastOptions.Files["archive-1"]; !ok {
+		t.Fatal("missing archive-1")
+	}
+
+	// A corrupted upload is rejected.
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", `form-data; name="archive-0"; filename="archive-0"`)
+	header.Set("X-HIVE-FILETYPE", "TAR")
+	fw, _ := w.CreatePart(header)
+	fw.Write([]byte("corrupted"))
+	w.WriteField("sha256:archive-0", want)
+	w.WriteField("CLIENT", "client-1")
+	w.Close()
+	url := fmt.Sprintf("%s/testsuite/%d/test/%d/node", srv.URL, suiteID, testID)
+	req, _ := http.NewRequest("POST", url, &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("wrong status %d for corrupted archive", resp.StatusCode)
+	}
+}
+
+// This test checks that SetTLSConfig enables requests to an https endpoint with a
+// custom CA, and does not affect http endpoints.
+func TestSetTLSConfig(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("[]"))
+	})
+	tlsSrv := httptest.NewTLSServer(handler)
+	defer tlsSrv.Close()
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(tlsSrv.Certificate())
+	config := &tls.Config{RootCAs: pool}
+
+	sim := NewAt(tlsSrv.URL)
+	if err := sim.Ping(context.Background()); err == nil {
+		t.Fatal("request with unknown CA succeeded")
+	}
+	sim.SetHTTPClient(&http.Client{Timeout: time.Minute})
+	sim.SetTLSConfig(config)
+	if err := sim.Ping(context.Background()); err != nil {
+		t.Fatal("request with custom CA failed:", err)
+	}
+	if timeout := sim.httpClient().Timeout; timeout != time.Minute {
+		t.Fatalf("client timeout not kept, have %v", timeout)
+	}
+
+	plain := NewAt(srv.URL)
+	plain.SetTLSConfig(config)
+	if err := plain.Ping(context.Background()); err != nil {
+		t.Fatal("http request failed:", err)
+	}
+}
+
+// This test checks that WithBuildArg builds client images once for each set of arguments.
+func TestStartClientWithBuildArg(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		images []string
+		builds int
+	)
+	tm, srv := newFakeAPI(&fakes.BackendHooks{
+		CreateContainer: func(image string, opt libhive.ContainerOptions) (string, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			images = append(images, image)
+			return fmt.Sprintf("%0.8x", len(images)), nil
+		},
+	})
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	testID, err := sim.StartTest(suiteID, "test", "")
+	if err != nil {
+		t.Fatal("can't start test:", err)
+	}
+
+	// Without a builder, the request is rejected.
+	_, _, err = sim.StartClientWithOptions(suiteID, testID, "client-1", WithBuildArg("tag", "v1"))
+	if httpErr, ok := err.(*HTTPError); !ok || httpErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("wrong error without builder: %v", err)
+	}
+
+	tm.SetBuilder(fakes.NewBuilder(&fakes.BuilderHooks{
+		BuildClientImageWithArgs: func(name string, args map[string]string) (string, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			builds++
+			return "hive/clients/" + name + ":" + args["tag"], nil
+		},
+	}))
+	for _, tag := range []string{"v1", "v2", "v1"} {
+		if _, _, err := sim.StartClientWithOptions(suiteID, testID, "client-1", WithBuildArg("tag", tag)); err != nil {
+			t.Fatalf("can't start client with tag %s: %v", tag, err)
+		}
+	}
+	if _, _, err := sim.StartClientWithOptions(suiteID, testID, "client-1"); err != nil {
+		t.Fatal("can't start client:", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"hive/clients/client-1:v1", "hive/clients/client-1:v2", "hive/clients/client-1:v1", "/ignored/in/api"}
+	if !reflect.DeepEqual(images, want) {
+		t.Errorf("wrong images %q", images)
+	}
+	if builds != 2 {
+		t.Errorf("wrong number of builds %d, want 2", builds)
+	}
+}
+
+// This test checks that client images with different build arguments are built
+// concurrently.
+func TestStartClientWithBuildArgConcurrent(t *testing.T) {
+	tm, srv := newFakeAPI(nil)
+	defer srv.Close()
+	defer tm.Terminate()
+
+	// The build of v1 finishes only after the build of v2 has started.
+	v2Started := make(chan struct{})
+	tm.SetBuilder(fakes.NewBuilder(&fakes.BuilderHooks{
+		BuildClientImageWithArgs: func(name string, args map[string]string) (string, error) {
+			if args["tag"] == "v2" {
+				close(v2Started)
+			} else {
+				select {
+				case <-v2Started:
+				case <-time.After(5 * time.Second):
+					return "", errors.New("builds are not concurrent")
+				}
+			}
+			return "hive/clients/" + name + ":" + args["tag"], nil
+		},
+	}))
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	testID, err := sim.StartTest(suiteID, "test", "")
+	if err != nil {
+		t.Fatal("can't start test:", err)
+	}
+	errc := make(chan error, 1)
+	go func() {
+		_, _, err := sim.StartClientWithOptions(suiteID, testID, "client-1", WithBuildArg("tag", "v1"))
+		errc <- err
+	}()
+	if _, _, err := sim.StartClientWithOptions(suiteID, testID, "client-1", WithBuildArg("tag", "v2")); err != nil {
+		t.Fatal("can't start client with tag v2:", err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal("can't start client with tag v1:", err)
+	}
+}
+
+// This test checks that WithImage pulls the image and uses it for the client container.
+func TestStartClientWithImage(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		images []string
+		pulls  []string
+	)
+	tm, srv := newFakeAPI(&fakes.BackendHooks{
+		CreateContainer: func(image string, opt libhive.ContainerOptions) (string, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			images = append(images, image)
+			return fmt.Sprintf("%0.8x", len(images)), nil
+		},
+	})
+	defer srv.Close()
+	defer tm.Terminate()
+	tm.SetBuilder(fakes.NewBuilder(&fakes.BuilderHooks{
+		PullImage: func(ref string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			if strings.HasPrefix(ref, "unknown/") {
+				return errors.New("repository does not exist")
+			}
+			pulls = append(pulls, ref)
+			return nil
+		},
+	}))
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	testID, err := sim.StartTest(suiteID, "test", "")
+	if err != nil {
+		t.Fatal("can't start test:", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, _, err := sim.StartClientWithOptions(suiteID, testID, "client-1", WithImage("ethereum/client-go:nightly")); err != nil {
+			t.Fatal("can't start client:", err)
+		}
+	}
+	want := []string{"ethereum/client-go:nightly", "ethereum/client-go:nightly"}
+	if !reflect.DeepEqual(images, want) {
+		t.Errorf("wrong images %q", images)
+	}
+	if len(pulls) != 1 {
+		t.Errorf("wrong pulls %q, want one", pulls)
+	}
+
+	// Pull failures are reported.
+	_, _, err = sim.StartClientWithOptions(suiteID, testID, "client-1", WithImage("unknown/image:latest"))
+	if err == nil || !strings.Contains(err.Error(), `can't pull image "unknown/image:latest"`) {
+		t.Fatalf("wrong error for failed pull: %v", err)
+	}
+	// Build arguments can't be used with an image.
+	_, _, err = sim.StartClientWithOptions(suiteID, testID, "client-1", WithImage("ethereum/client-go:nightly"), WithBuildArg("tag", "v1"))
+	if httpErr, ok := err.(*HTTPError); !ok || httpErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("wrong error for image with build arguments: %v", err)
+	}
+}
+
+// This test checks the timing information returned by StartClientWithInfo.
+func TestStartClientWithInfo(t *testing.T) {
+	tm, srv := newFakeAPI(&fakes.BackendHooks{
+		StartContainer: func(containerID string, opt libhive.ContainerOptions) (*libhive.ContainerInfo, error) {
+			time.Sleep(20 * time.Millisecond)
+			return &libhive.ContainerInfo{IP: "192.0.2.1"}, nil
+		},
+	})
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	testID, err := sim.StartTest(suiteID, "test", "")
+	if err != nil {
+		t.Fatal("can't start test:", err)
+	}
+	c, err := sim.StartClientWithInfo(suiteID, testID, "client-1")
+	if err != nil {
+		t.Fatal("can't start client:", err)
+	}
+	if c.Container == "" || !c.IP.Equal(net.IPv4(192, 0, 2, 1)) {
+		t.Fatalf("wrong client %s@%v", c.Container, c.IP)
+	}
+	if c.MAC.String() != "00:80:41:ae:fd:7e" {
+		t.Fatalf("wrong MAC address %v", c.MAC)
+	}
+	if c.ServerStartDuration < 20*time.Millisecond {
+		t.Fatalf("server start duration %v too short", c.ServerStartDuration)
+	}
+	if c.StartDuration < c.ServerStartDuration {
+		t.Fatalf("start duration %v shorter than server start duration %v", c.StartDuration, c.ServerStartDuration)
+	}
+
+	// Without the header, the server duration is zero.
+	recSim, _ := NewRecording()
+	c, err = recSim.StartClientWithInfo(1, 1, "client-1")
+	if err != nil {
+		t.Fatal("can't start client:", err)
+	}
+	if c.ServerStartDuration != 0 {
+		t.Fatalf("wrong server start duration %v", c.ServerStartDuration)
+	}
+}
+
+// This test checks that the client type argument takes precedence over the
+// CLIENT parameter set by options.
+func TestStartClientTypeParam(t *testing.T) {
+	sim, rec := NewRecording()
+
+	// A matching CLIENT parameter is allowed.
+	if _, _, err := sim.StartClientWithOptions(1, 1, "client-1", Params{"CLIENT": "client-1"}); err != nil {
+		t.Fatal("can't start client:", err)
+	}
+	reqs := rec.Requests()
+	if len(reqs) != 1 || reqs[0].Params.Get("CLIENT") != "client-1" {
+		t.Fatalf("wrong requests %+v", reqs)
+	}
+
+	// A conflicting CLIENT parameter fails before sending the request.
+	rec.Reset()
+	_, _, err := sim.StartClientWithOptions(1, 1, "client-1", Params{"CLIENT": "client-2"})
+	if err == nil || !strings.Contains(err.Error(), `"client-2" conflicts with client type "client-1"`) {
+		t.Fatalf("wrong error for conflicting CLIENT parameter: %v", err)
+	}
+	if reqs := rec.Requests(); len(reqs) != 0 {
+		t.Fatalf("request sent for conflicting CLIENT parameter: %+v", reqs)
+	}
+}
+
+// This test checks starting a client without the default network and connecting it
+// to a network afterwards.
+func TestStartClientNoDefaultNetwork(t *testing.T) {
+	var (
+		mu        sync.Mutex
+		created   libhive.ContainerOptions
+		started   libhive.ContainerOptions
+		restarted libhive.ContainerOptions
+		connected []string
+	)
+	tm, srv := newFakeAPI(&fakes.BackendHooks{
+		CreateContainer: func(image string, opt libhive.ContainerOptions) (string, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			created = opt
+			return "0123456789abcdef", nil
+		},
+		StartContainer: func(containerID string, opt libhive.ContainerOptions) (*libhive.ContainerInfo, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			started = opt
+			return &libhive.ContainerInfo{}, nil
+		},
+		RestartContainer: func(containerID string, opt libhive.ContainerOptions) (*libhive.ContainerInfo, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			restarted = opt
+			return &libhive.ContainerInfo{}, nil
+		},
+		ConnectContainer: func(containerID, networkID string, aliases []string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			connected = append(connected, containerID+"/"+networkID)
+			return nil
+		},
+	})
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	testID, err := sim.StartTest(suiteID, "test", "")
+	if err != nil {
+		t.Fatal("can't start test:", err)
+	}
+	id, ip, err := sim.StartClientWithOptions(suiteID, testID, "client-1", WithNoDefaultNetwork())
+	if err != nil {
+		t.Fatal("can't start client:", err)
+	}
+	if ip != nil {
+		t.Fatalf("client has IP %v", ip)
+	}
+	if err := sim.CreateNetwork(suiteID, "net1"); err != nil {
+		t.Fatal("can't create network:", err)
+	}
+	if err := sim.ConnectContainer(suiteID, "net1", id); err != nil {
+		t.Fatal("can't connect client:", err)
+	}
+	if ip, err := sim.RestartClient(suiteID, testID, id); err != nil {
+		t.Fatal("can't restart client:", err)
+	} else if ip != nil {
+		t.Fatalf("restarted client has IP %v", ip)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !created.NoDefaultNetwork {
+		t.Error("container created with default network")
+	}
+	if started.CheckLive {
+		t.Error("liveness check enabled without default network")
+	}
+	if restarted.CheckLive {
+		t.Error("liveness check enabled on restart without default network")
+	}
+	if len(connected) != 1 || !strings.HasPrefix(connected[0], id+"/") {
+		t.Errorf("wrong network connections %v", connected)
+	}
+}
+
+// This test checks that ClientExecRaw returns binary output unchanged.
+func TestClientExecRaw(t *testing.T) {
+	output := []byte{0x00, 0xff, 0xfe, '\n', 0xc3, 0x28}
+	tm, srv := newFakeAPI(&fakes.BackendHooks{
+		RunProgram: func(containerID string, opt libhive.ExecOptions) (*libhive.ExecInfo, error) {
+			if opt.Cmd[0] == "/hive-bin/fail.sh" {
+				return nil, errors.New("exec failed")
+			}
+			return &libhive.ExecInfo{Stdout: string(output), Stderr: "stderr", ExitCode: 3}, nil
+		},
+	})
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	testID, err := sim.StartTest(suiteID, "test", "")
+	if err != nil {
+		t.Fatal("can't start test:", err)
+	}
+	id, _, err := sim.StartClientWithOptions(suiteID, testID, "client-1")
+	if err != nil {
+		t.Fatal("can't start client:", err)
+	}
+
+	var stdout bytes.Buffer
+	exitCode, err := sim.ClientExecRaw(context.Background(), suiteID, testID, id, []string{"dump.sh"}, &stdout)
+	if err != nil {
+		t.Fatal("exec failed:", err)
+	}
+	if !bytes.Equal(stdout.Bytes(), output) || exitCode != 3 {
+		t.Fatalf("wrong result %x, exit code %d", stdout.Bytes(), exitCode)
+	}
+
+	_, err = sim.ClientExecRaw(context.Background(), suiteID, testID, id, []string{"fail.sh"}, ioutil.Discard)
+	if err == nil || err.Error() != "exec failed" {
+		t.Fatalf("wrong error %v", err)
+	}
+}
+
+// This test checks that Close releases idle connections and prevents further requests.
+func TestSimulationClose(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("[]"))
+	}))
+	closedConn := make(chan struct{}, 1)
+	srv.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateClosed {
+			closedConn <- struct{}{}
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	sim := NewAt(srv.URL)
+	sim.SetHTTPClient(&http.Client{Transport: new(http.Transport)})
+	if err := sim.Ping(context.Background()); err != nil {
+		t.Fatal("ping failed:", err)
+	}
+	if err := sim.Close(); err != nil {
+		t.Fatal("close failed:", err)
+	}
+	select {
+	case <-closedConn:
+	case <-time.After(5 * time.Second):
+		t.Fatal("idle connection not closed")
+	}
+
+	if err := sim.Ping(context.Background()); !errors.Is(err, ErrClosed) {
+		t.Fatalf("wrong error after close: %v", err)
+	}
+	if _, err := sim.ClientTypesRefresh(); !errors.Is(err, ErrClosed) {
+		t.Fatalf("wrong error after close: %v", err)
+	}
+	if err := sim.Close(); err != nil {
+		t.Fatal("second close failed:", err)
+	}
+}
+
+// This test checks that ConnectContainers connects all containers and reports failures
+// by container ID.
+func TestConnectContainers(t *testing.T) {
+	sim, rec := NewRecording()
+	rec.SetResponder(func(req *RecordedRequest) (int, string) {
+		if strings.HasSuffix(req.Path, "/bad") {
+			return http.StatusInternalServerError, "can't connect"
+		}
+		return http.StatusOK, ""
+	})
+
+	err := sim.ConnectContainers(1, "net1", "a", "bad", "b")
+	errs, ok := err.(ContainerErrors)
+	if !ok {
+		t.Fatalf("wrong error type %T: %v", err, err)
+	}
+	if len(errs) != 1 || errs["bad"] == nil {
+		t.Fatalf("wrong errors: %v", errs)
+	}
+
+	var paths []string
+	for _, req := range rec.Requests() {
+		if req.Method != http.MethodPost {
+			t.Errorf("wrong method %s", req.Method)
+		}
+		paths = append(paths, req.Path)
+	}
+	sort.Strings(paths)
+	want := []string{"/testsuite/1/network/net1/a", "/testsuite/1/network/net1/b", "/testsuite/1/network/net1/bad"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Fatalf("wrong requests %v, want %v", paths, want)
+	}
+
+	if err := sim.ConnectContainers(1, "net1", "a", "b"); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+}
+
+// This test checks that ShapeNetwork applies shaping to all clients on a network.
+func TestShapeNetwork(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		shaped = make(map[string]libhive.NetworkShaping)
+	)
+	tm, srv := newFakeAPI(&fakes.BackendHooks{
+		NetworkIPs: func(networkID string) (map[string]net.IP, error) {
+			return map[string]net.IP{
+				"c1":      {203, 0, 113, 7},
+				"c2":      {203, 0, 113, 8},
+				"sim-ctr": {203, 0, 113, 9},
+			}, nil
+		},
+		ShapeContainer: func(containerID, networkID string, opt libhive.NetworkShaping) error {
+			mu.Lock()
+			defer mu.Unlock()
+			shaped[containerID] = opt
+			return nil
+		},
+	})
+	defer srv.Close()
+	defer tm.Terminate()
+	tm.SetSimContainerInfo("sim-ctr", "")
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	if err := sim.CreateNetwork(suiteID, "net1"); err != nil {
+		t.Fatal("can't create network:", err)
+	}
+
+	opts := ShapeOptions{Latency: 100 * time.Millisecond, Jitter: 10 * time.Millisecond, LossPercent: 1.5, RateLimit: 1000000}
+	if err := sim.ShapeNetwork(suiteID, "net1", opts); err != nil {
+		t.Fatal("can't shape network:", err)
+	}
+	want := libhive.NetworkShaping{Latency: 100 * time.Millisecond, Jitter: 10 * time.Millisecond, Loss: 1.5, Rate: 1000000}
+	mu.Lock()
+	got := shaped
+	shaped = make(map[string]libhive.NetworkShaping)
+	mu.Unlock()
+	if !reflect.DeepEqual(got, map[string]libhive.NetworkShaping{"c1": want, "c2": want}) {
+		t.Fatalf("wrong shaping: %v", got)
+	}
+
+	if err := sim.ClearNetworkShaping(suiteID, "net1"); err != nil {
+		t.Fatal("can't clear shaping:", err)
+	}
+	mu.Lock()
+	got = shaped
+	mu.Unlock()
+	if !reflect.DeepEqual(got, map[string]libhive.NetworkShaping{"c1": {}, "c2": {}}) {
+		t.Fatalf("wrong shaping after clear: %v", got)
+	}
+
+	if err := sim.ShapeNetwork(suiteID, "net1", ShapeOptions{Jitter: time.Millisecond}); err == nil {
+		t.Fatal("expected error for jitter without latency")
+	}
+	if err := sim.ShapeNetwork(suiteID, "net1", ShapeOptions{LossPercent: 101}); err == nil {
+		t.Fatal("expected error for invalid loss")
+	}
+	if err := sim.ShapeNetwork(suiteID, "unknown", opts); err == nil {
+		t.Fatal("expected error for unknown network")
+	}
+}
+
+// This test checks that suites and tests can be reported with JSON and form-encoded
+// request bodies.
+func TestSuiteAndTestRequestEncoding(t *testing.T) {
+	tm, srv := newFakeAPI(nil)
+	defer srv.Close()
+	defer tm.Terminate()
+
+	// Details larger than the form size limit of net/http can be sent as JSON.
+	details := strings.Repeat("x", 11<<20)
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("json-suite", "json description", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	testID, err := sim.StartTest(suiteID, "json-test", "")
+	if err != nil {
+		t.Fatal("can't start test:", err)
+	}
+	if err := sim.EndTest(suiteID, testID, TestResult{Pass: true, Details: details}); err != nil {
+		t.Fatal("can't end test:", err)
+	}
+	if err := sim.EndSuite(suiteID); err != nil {
+		t.Fatal("can't end suite:", err)
+	}
+
+	// Form-encoded requests are still supported.
+	post := func(path string, form url.Values) string {
+		resp, err := http.PostForm(srv.URL+path, form)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := readResponse(resp)
+		if err != nil {
+			t.Fatalf("POST %s failed: %v", path, err)
+		}
+		return body
+	}
+	formSuite := post("/testsuite", url.Values{"name": {"form-suite"}})
+	formTest := post("/testsuite/"+formSuite+"/test", url.Values{"name": {"form-test"}})
+	post("/testsuite/"+formSuite+"/test/"+formTest, url.Values{"summaryresult": {`{"pass":false,"details":"form"}`}})
+	if err := sim.EndSuite(SuiteID(mustAtoi(t, formSuite))); err != nil {
+		t.Fatal("can't end suite:", err)
+	}
+
+	results := tm.Results()
+	jsonSuite := results[libhive.TestSuiteID(suiteID)]
+	if jsonSuite == nil || jsonSuite.Name != "json-suite" || jsonSuite.Description != "json description" {
+		t.Fatalf("wrong JSON suite: %+v", jsonSuite)
+	}
+	jsonTest := jsonSuite.TestCases[libhive.TestID(testID)]
+	if jsonTest == nil || jsonTest.Name != "json-test" || !jsonTest.SummaryResult.Pass || jsonTest.SummaryResult.Details != details {
+		t.Fatal("wrong JSON test result")
+	}
+	formResult := results[libhive.TestSuiteID(mustAtoi(t, formSuite))]
+	if formResult == nil || formResult.Name != "form-suite" {
+		t.Fatalf("wrong form suite: %+v", formResult)
+	}
+	formCase := formResult.TestCases[libhive.TestID(mustAtoi(t, formTest))]
+	if formCase == nil || formCase.Name != "form-test" || formCase.SummaryResult.Details != "form" {
+		t.Fatalf("wrong form test result: %+v", formCase)
+	}
+}
+
+func mustAtoi(t *testing.T, s string) int {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// This test checks that long commands are sent to the client intact. Commands are sent in
+// the request body, so they are not subject to the URL length limit of the server.
+func TestRunProgramLongCommand(t *testing.T) {
+	var gotCmd []string
+	hooks := &fakes.BackendHooks{
+		RunProgram: func(containerID string, opt libhive.ExecOptions) (*libhive.ExecInfo, error) {
+			gotCmd = opt.Cmd
+			return &libhive.ExecInfo{Stdout: "ok"}, nil
+		},
+	}
+	tm, srv := newFakeAPI(hooks)
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	testID, err := sim.StartTest(suiteID, "test", "")
+	if err != nil {
+		t.Fatal("can't start test:", err)
+	}
+	clientID, _, err := sim.StartClientWithOptions(suiteID, testID, "client-1")
+	if err != nil {
+		t.Fatal("can't start client:", err)
+	}
+
+	// The script is larger than the default header limit of net/http.
+	script := strings.Repeat("echo 'a line of a long inline script' && ", 1<<16) + "true"
+	info, err := sim.ClientExec(suiteID, testID, clientID, []string{"run.sh", "-c", script})
+	if err != nil {
+		t.Fatal("failed to run program:", err)
+	}
+	if info.Stdout != "ok" {
+		t.Fatalf("wrong output %q", info.Stdout)
+	}
+	want := []string{"/hive-bin/run.sh", "-c", script}
+	if !reflect.DeepEqual(gotCmd, want) {
+		t.Fatalf("command was not sent intact (got %d args)", len(gotCmd))
+	}
+}
+
+// This test checks that upload progress is reported.
+func TestStartClientUploadProgress(t *testing.T) {
+	tm, srv := newFakeAPI(nil)
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	testID, err := sim.StartTest(suiteID, "test", "")
+	if err != nil {
+		t.Fatal("can't start test:", err)
+	}
+
+	data := make([]byte, 1<<20)
+	src := func() io.ReadCloser { return ioutil.NopCloser(bytes.NewReader(data)) }
+	var reports []int64
+	_, _, err = sim.StartClientWithOptions(suiteID, testID, "client-1", WithTAR(src),
+		WithUploadProgress(func(n int64) { reports = append(reports, n) }))
+	if err != nil {
+		t.Fatalf("failed to start client: %v", err)
+	}
+	// The final report is made before the request completes.
+	if len(reports) == 0 {
+		t.Fatal("no progress reported")
+	}
+	for i := 1; i < len(reports); i++ {
+		if reports[i] < reports[i-1] {
+			t.Fatalf("progress decreased: %v", reports)
+		}
+	}
+	if total := reports[len(reports)-1]; total < int64(len(data)) {
+		t.Fatalf("final progress %d is less than archive size %d", total, len(data))
+	}
+}
+
+// This test checks for some common errors returned by StartClient.
+func TestStartClientErrors(t *testing.T) {
+	tm, srv := newFakeAPI(nil)
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	testID, err := sim.StartTest(suiteID, "test", "")
+	if err != nil {
+		t.Fatal("can't start test:", err)
+	}
+
+	// Need CLIENT to start the client.
+	params := map[string]string{}
+	clientID, _, err := sim.StartClient(suiteID, testID, params, nil)
+	if err == nil {
+		t.Fatalf("wanted error from GetNode without CLIENT parameter, got container ID %v", clientID)
+	}
+	if !strings.Contains(err.Error(), "missing 'CLIENT'") {
+		t.Fatalf("wrong error for GetNode without CLIENT parameter: %q", err.Error())
+	}
+
+	// Unknown CLIENT.
+	params = map[string]string{"CLIENT": "unknown"}
+	clientID, _, err = sim.StartClient(suiteID, testID, params, nil)
+	if err == nil {
+		t.Fatalf("wanted error for unknown CLIENT parameter, got container ID %v", clientID)
+	}
+	if !strings.Contains(err.Error(), "unknown 'CLIENT'") {
+		t.Fatalf("wrong error for GetNode with unknown CLIENT parameter: %q", err.Error())
+	}
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) {
+		t.Fatalf("error for unknown CLIENT parameter is not *HTTPError: %T", err)
+	}
+	if httpErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("wrong status code for unknown CLIENT parameter: %d", httpErr.StatusCode)
+	}
+}
+
+// This test checks that failures of teardown requests are reported.
+func TestTeardownErrors(t *testing.T) {
+	tm, srv := newFakeAPI(nil)
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	testID, err := sim.StartTest(suiteID, "test", "")
+	if err != nil {
+		t.Fatal("can't start test:", err)
+	}
+
+	var httpErr *HTTPError
+	if err := sim.StopClient(suiteID, testID, "unknown"); !errors.As(err, &httpErr) {
+		t.Fatalf("wrong error from StopClient with unknown node: %v", err)
+	}
+	if err := sim.RemoveNetwork(suiteID, "unknown"); !errors.As(err, &httpErr) {
+		t.Fatalf("wrong error from RemoveNetwork with unknown network: %v", err)
+	}
+	if err := sim.DisconnectContainer(suiteID, "unknown", "simulation"); !errors.As(err, &httpErr) {
+		t.Fatalf("wrong error from DisconnectContainer with unknown network: %v", err)
+	}
+	// The suite can't end while the test is running.
+	if err := sim.EndSuite(suiteID); !errors.As(err, &httpErr) {
+		t.Fatalf("wrong error from EndSuite with running test: %v", err)
+	}
+}
+
+// This test checks that requests are aborted when the context is cancelled.
+func TestRequestContextCancel(t *testing.T) {
+	tm, srv := newFakeAPI(nil)
+	defer srv.Close()
+	defer tm.Terminate()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	sim := NewAt(srv.URL)
+	if _, err := sim.StartSuiteContext(ctx, "suite", "", ""); !errors.Is(err, context.Canceled) {
+		t.Fatalf("wrong error from StartSuiteContext: %v", err)
+	}
+	if _, err := sim.ClientTypesContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("wrong error from ClientTypesContext: %v", err)
+	}
+	if err := sim.EndSuiteContext(ctx, 0); !errors.Is(err, context.Canceled) {
+		t.Fatalf("wrong error from EndSuiteContext: %v", err)
+	}
+	if err := sim.EndTestContext(ctx, 0, 0, TestResult{}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("wrong error from EndTestContext: %v", err)
+	}
+}
+
+// This test checks that EndTestContext returns when hive does not respond in time.
+func TestEndTestDeadline(t *testing.T) {
+	unblock := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-unblock
+	}))
+	defer srv.Close()
+	defer close(unblock)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	sim := NewAt(srv.URL)
+	err := sim.EndTestContext(ctx, 1, 1, TestResult{Pass: true})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("wrong error: %v", err)
+	}
+}
+
+// This test checks that API requests are sent through the configured HTTP client.
+func TestSetHTTPClient(t *testing.T) {
+	tm, srv := newFakeAPI(nil)
+	defer srv.Close()
+	defer tm.Terminate()
+
+	var requests int
+	sim := NewAt(srv.URL)
+	sim.SetHTTPClient(&http.Client{
+		Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			requests++
+			return http.DefaultTransport.RoundTrip(req)
+		}),
+	})
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	testID, err := sim.StartTest(suiteID, "test", "")
+	if err != nil {
+		t.Fatal("can't start test:", err)
+	}
+	if _, _, err := sim.StartClientWithOptions(suiteID, testID, "client-1"); err != nil {
+		t.Fatal("can't start client:", err)
+	}
+	if requests != 3 {
+		t.Fatalf("wrong number of requests through custom client: %d", requests)
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (fn roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) { return fn(req) }
+
 func newFakeAPI(hooks *fakes.BackendHooks) (*libhive.TestManager, *httptest.Server) {
 	env := libhive.SimEnv{
 		Definitions: map[string]*libhive.ClientDefinition{
-			"client-1": {Name: "client-1", Image: "/ignored/in/api", Version: "client-1-version", Meta: libhive.ClientMetadata{Roles: []string{"eth1"}}},
-			"client-2": {Name: "client-2", Image: "/not/exposed/", Version: "client-2-version", Meta: libhive.ClientMetadata{Roles: []string{"beacon"}}},
+			"client-1": {Name: "client-1", Image: "/ignored/in/api", Version: "client-1-version", Meta: libhive.ClientMetadata{Roles: []string{"eth1"}, Info: map[string]string{"commit": "abc123"}}},
+			"client-2": {Name: "client-2", Image: "/not/exposed/", Version: "client-2-version", Meta: libhive.ClientMetadata{Roles: []string{"beacon"}, Ports: []int{4000, 5052}}},
 		},
 	}
 	backend := fakes.NewContainerBackend(hooks)
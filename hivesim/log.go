@@ -0,0 +1,64 @@
+package hivesim
+
+import (
+	"net/http"
+	"time"
+)
+
+// Logger receives debug messages about API requests. The context arguments are
+// alternating keys and values. This interface is implemented by the loggers of
+// log15 and go-ethereum.
+type Logger interface {
+	Debug(msg string, ctx ...interface{})
+}
+
+// SetLogger configures logging of API requests. Every request attempt is logged with its
+// method, URL, response status and duration. Retries are logged as well. By default,
+// nothing is logged.
+//
+// SetLogger can be called while the simulation is in use.
+func (sim *Simulation) SetLogger(logger Logger) {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	sim.logger = logger
+}
+
+// RequestHook is called after every API request attempt. The status is zero if no
+// response was received. For streaming requests, the duration is the time until the
+// response headers were received.
+type RequestHook func(method, path string, status int, d time.Duration)
+
+// SetRequestHook sets a function which is called after every API request attempt,
+// including retries. This can be used to collect metrics about the time spent waiting
+// for hive. The hook may be called concurrently if the simulation is used by multiple
+// goroutines.
+//
+// SetRequestHook can be called while the simulation is in use.
+func (sim *Simulation) SetRequestHook(hook RequestHook) {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	sim.hook = hook
+}
+
+// logRequest reports a finished request attempt to the logger and request hook.
+func (sim *Simulation) logRequest(req *http.Request, resp *http.Response, err error, d time.Duration) {
+	sim.mu.RLock()
+	logger, hook := sim.logger, sim.hook
+	sim.mu.RUnlock()
+
+	if hook != nil {
+		status := 0
+		if resp != nil {
+			status = resp.StatusCode
+		}
+		hook(req.Method, req.URL.Path, status, d)
+	}
+	if logger == nil {
+		return
+	}
+	if err != nil {
+		logger.Debug("API request failed", "method", req.Method, "url", req.URL, "duration", d, "err", err)
+		return
+	}
+	logger.Debug("API request", "method", req.Method, "url", req.URL, "status", resp.StatusCode, "duration", d)
+}
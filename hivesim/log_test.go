@@ -0,0 +1,93 @@
+package hivesim
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testLogger struct {
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (l *testLogger) Debug(msg string, ctx ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i := 0; i+1 < len(ctx); i += 2 {
+		// Durations and delays vary, so only their presence is recorded.
+		if key := ctx[i]; key == "duration" || key == "delay" || key == "err" {
+			msg += fmt.Sprintf(" %v", key)
+		} else {
+			msg += fmt.Sprintf(" %v=%v", key, ctx[i+1])
+		}
+	}
+	l.msgs = append(l.msgs, msg)
+}
+
+// This test checks that request attempts and retries are logged.
+func TestSetLogger(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls++; calls == 1 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("[]"))
+	}))
+	defer srv.Close()
+
+	logger := new(testLogger)
+	sim := NewAt(srv.URL)
+	sim.SetRetryPolicy(2, 0)
+	sim.SetLogger(logger)
+	if _, err := sim.ClientTypes(); err != nil {
+		t.Fatal("can't get client types:", err)
+	}
+	url := srv.URL + "/clients?metadata=1"
+	want := []string{
+		"API request method=GET url=" + url + " status=503 duration",
+		"Retrying API request attempt=2 delay err",
+		"API request method=GET url=" + url + " status=200 duration",
+	}
+	if !reflect.DeepEqual(logger.msgs, want) {
+		t.Fatalf("wrong log messages:\n got %q\nwant %q", logger.msgs, want)
+	}
+}
+
+// This test checks that the request hook is called for every attempt.
+func TestSetRequestHook(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls++; calls == 1 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("[]"))
+	}))
+	defer srv.Close()
+
+	var got []string
+	sim := NewAt(srv.URL)
+	sim.SetRetryPolicy(2, 0)
+	sim.SetRequestHook(func(method, path string, status int, d time.Duration) {
+		if d < 0 {
+			t.Errorf("invalid duration %v", d)
+		}
+		got = append(got, fmt.Sprintf("%s %s %d", method, path, status))
+	})
+	if _, err := sim.ClientTypes(); err != nil {
+		t.Fatal("can't get client types:", err)
+	}
+	srv.Close()
+	sim.EndSuite(1)
+
+	want := []string{"GET /clients 503", "GET /clients 200", "DELETE /testsuite/1 0"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("wrong hook calls:\n got %q\nwant %q", got, want)
+	}
+}
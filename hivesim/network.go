@@ -0,0 +1,99 @@
+package hivesim
+
+import (
+	"net"
+	"sort"
+	"sync"
+)
+
+// TestNetwork is a docker network of a test suite. It keeps track of the containers
+// connected through it, so they can be disconnected when the network is removed.
+//
+//	network := sim.Network(suiteID, "nodes")
+//	if err := network.Create(); err != nil {
+//		return err
+//	}
+//	defer network.Remove()
+//	network.Connect(client.Container)
+//	ip, err := network.IP(client.Container)
+type TestNetwork struct {
+	sim   *Simulation
+	suite SuiteID
+	name  string
+
+	mu         sync.Mutex
+	containers map[string]struct{}
+}
+
+// Network returns a handle for the network with the given name in a test suite. The
+// network is not created until Create is called.
+func (sim *Simulation) Network(testSuite SuiteID, name string) *TestNetwork {
+	return &TestNetwork{
+		sim:        sim,
+		suite:      testSuite,
+		name:       name,
+		containers: make(map[string]struct{}),
+	}
+}
+
+// Name returns the name of the network.
+func (n *TestNetwork) Name() string {
+	return n.name
+}
+
+// Create creates the network.
+func (n *TestNetwork) Create() error {
+	return n.sim.CreateNetwork(n.suite, n.name)
+}
+
+// Connect connects a container to the network. The container ID can also be
+// "simulation" to connect the simulator container.
+func (n *TestNetwork) Connect(containerID string, aliases ...string) error {
+	if err := n.sim.ConnectContainerWithAliases(n.suite, n.name, containerID, aliases...); err != nil {
+		return err
+	}
+	n.mu.Lock()
+	n.containers[containerID] = struct{}{}
+	n.mu.Unlock()
+	return nil
+}
+
+// Disconnect disconnects a container from the network.
+func (n *TestNetwork) Disconnect(containerID string) error {
+	if err := n.sim.DisconnectContainer(n.suite, n.name, containerID); err != nil {
+		return err
+	}
+	n.mu.Lock()
+	delete(n.containers, containerID)
+	n.mu.Unlock()
+	return nil
+}
+
+// IP returns the IP address of a container on the network.
+func (n *TestNetwork) IP(containerID string) (net.IP, error) {
+	return n.sim.ContainerIP(n.suite, n.name, containerID)
+}
+
+// Containers returns the IDs of containers connected using Connect, in sorted order.
+func (n *TestNetwork) Containers() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	ids := make([]string, 0, len(n.containers))
+	for id := range n.containers {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Remove disconnects all containers connected using Connect, then removes the network.
+// If disconnecting a container fails, the network is not removed.
+func (n *TestNetwork) Remove() error {
+	for _, id := range n.Containers() {
+		if err := n.Disconnect(id); err != nil {
+			return err
+		}
+	}
+	return n.sim.RemoveNetwork(n.suite, n.name)
+}
@@ -0,0 +1,83 @@
+package hivesim
+
+import (
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/hive/internal/fakes"
+)
+
+// This test checks that TestNetwork disconnects containers before removing the network.
+func TestTestNetwork(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		calls []string
+	)
+	record := func(call string) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, call)
+	}
+	tm, srv := newFakeAPI(&fakes.BackendHooks{
+		ConnectContainer: func(containerID, networkID string, aliases []string) error {
+			record("connect " + containerID)
+			return nil
+		},
+		DisconnectContainer: func(containerID, networkID string) error {
+			record("disconnect " + containerID)
+			return nil
+		},
+		RemoveNetwork: func(networkID string) error {
+			record("remove")
+			return nil
+		},
+		ContainerIP: func(containerID, networkID string) (net.IP, error) {
+			return net.IP{203, 0, 113, 7}, nil
+		},
+	})
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	network := sim.Network(suiteID, "nodes")
+	if err := network.Create(); err != nil {
+		t.Fatal("can't create network:", err)
+	}
+	for _, id := range []string{"c2", "c1", "c3"} {
+		if err := network.Connect(id); err != nil {
+			t.Fatal("can't connect:", err)
+		}
+	}
+	if err := network.Disconnect("c3"); err != nil {
+		t.Fatal("can't disconnect:", err)
+	}
+	if ids := network.Containers(); !reflect.DeepEqual(ids, []string{"c1", "c2"}) {
+		t.Fatalf("wrong containers %q", ids)
+	}
+	ip, err := network.IP("c1")
+	if err != nil {
+		t.Fatal("can't get IP:", err)
+	}
+	if !ip.Equal(net.IP{203, 0, 113, 7}) {
+		t.Fatalf("wrong IP %v", ip)
+	}
+	if err := network.Remove(); err != nil {
+		t.Fatal("can't remove network:", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{
+		"connect c2", "connect c1", "connect c3", "disconnect c3",
+		"disconnect c1", "disconnect c2", "remove",
+	}
+	if !reflect.DeepEqual(calls, want) {
+		t.Fatalf("wrong backend calls:\n got %q\nwant %q", calls, want)
+	}
+}
@@ -1,8 +1,15 @@
 package hivesim
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
+	"path"
+	"sync/atomic"
+	"time"
 )
 
 // clientSetup collects client options.
@@ -10,9 +17,115 @@ type clientSetup struct {
 	parameters map[string]string
 	// destination path -> open data function
 	files map[string]func() (io.ReadCloser, error)
+	// archives extracted into the root directory of the container
+	archives []archiveSource
+	// IDs of uploaded archives, extracted after the other files
+	uploads []string
+	// docker labels of the container
+	labels map[string]string
+	// docker build arguments of the client image
+	buildArgs map[string]string
+	// image used instead of the client image
+	image string
+	// networks the container is connected to before it starts
+	networks []string
+	// run the container in privileged mode
+	privileged bool
+	// don't connect the container to the bridge network
+	noDefaultNetwork bool
+	// Linux capabilities added to the container
+	capabilities []string
+	// process resource limits, the value is "<soft>:<hard>"
+	ulimits map[string]string
+	// named volumes by mount path, the value is "<volume>[:ro]"
+	volumes map[string]string
+	// resource limits, zero means unlimited
+	memoryLimit int64
+	cpuLimit    float64
+	// auxiliary commands started after the client
+	startup [][]string
+	// maximum time to wait for the client to start
+	startTimeout time.Duration
+	// send SHA-256 digests of archives, and report them to the callback
+	tarChecksum   bool
+	tarChecksumFn func(archive int, digest string)
+	// reports the number of request body bytes sent
+	uploadProgress func(bytesSent int64)
+	// files can be read only once, so the request can't be retried
+	singleUse bool
+	// the first error encountered while applying options
+	err error
 }
 
+// labelFieldPrefix is the prefix of form fields containing container labels.
+const labelFieldPrefix = "label:"
+
+// buildArgFieldPrefix is the prefix of form fields containing image build arguments.
+const buildArgFieldPrefix = "buildarg:"
+
+// imageField is the form field containing the image of the client.
+const imageField = "image"
+
+// networkFieldPrefix is the prefix of form fields naming networks of the client.
+const networkFieldPrefix = "network:"
+
+// privilegedField is the form field requesting a privileged container.
+const privilegedField = "privileged"
+
+// noDefaultNetworkField is the form field requesting a container without bridge network.
+const noDefaultNetworkField = "nodefaultnetwork"
+
+// ulimitFieldPrefix is the prefix of form fields setting process resource limits.
+const ulimitFieldPrefix = "ulimit:"
+
+// volumeFieldPrefix is the prefix of form fields mounting volumes into the client.
+const volumeFieldPrefix = "volume:"
+
+// capabilityFieldPrefix is the prefix of form fields adding capabilities to the client.
+const capabilityFieldPrefix = "capability:"
+
+// startTimeoutField is the form field containing the start timeout.
+const startTimeoutField = "timeout"
+
+// startupFieldPrefix is the prefix of form fields containing auxiliary commands.
+const startupFieldPrefix = "startup:"
+
+// uploadFieldPrefix is the prefix of form fields naming uploaded archives.
+const uploadFieldPrefix = "upload:"
+
+// checksumFieldPrefix is the prefix of form fields containing file digests.
+const checksumFieldPrefix = "sha256:"
+
+// These form fields set resource limits of the client.
+const (
+	memoryField = "memory"
+	cpusField   = "cpus"
+)
+
+// setError records an error of an option. The client is not started if any option fails.
+func (setup *clientSetup) setError(err error) {
+	if setup.err == nil {
+		setup.err = err
+	}
+}
+
+// archiveSource is a TAR archive added by WithTAR or WithGzipTAR.
+type archiveSource struct {
+	fileType string // value of the X-HIVE-FILETYPE header
+	src      func() io.ReadCloser
+}
+
+// These are the supported archive file types.
+const (
+	fileTypeHeader  = "X-HIVE-FILETYPE"
+	fileTypeTAR     = "TAR"
+	fileTypeTARGzip = "TAR_GZ"
+)
+
 // StartOption is a parameter for starting a client.
+//
+// Options are applied in the order they are given. When multiple options set the same
+// client parameter or file, the last one wins.
 type StartOption interface {
 	Apply(setup *clientSetup)
 }
@@ -47,6 +160,405 @@ func WithDynamicFile(dstPath string, src func() (io.ReadCloser, error)) StartOpt
 	})
 }
 
+// WithBuildArg sets a docker build argument of the client image, e.g. to select the
+// branch or commit of the client source code. When build arguments are given, hive
+// builds a variant of the client image before starting the client. This can take a
+// while, so the build is not limited by the start timeout.
+//
+// Images are cached: starting the same client type with the same build arguments again
+// reuses the image built for the first client. Versions of hive which cannot build
+// images reject the client start request.
+func WithBuildArg(key, value string) StartOption {
+	return optionFunc(func(setup *clientSetup) {
+		if key == "" {
+			setup.setError(errors.New("empty build argument name"))
+			return
+		}
+		if setup.buildArgs == nil {
+			setup.buildArgs = make(map[string]string)
+		}
+		setup.buildArgs[key] = value
+	})
+}
+
+// WithLabels sets docker labels on the client container. Labels can be used to tag
+// containers with test metadata, and are included in the output of ClientInspect.
+func WithLabels(labels map[string]string) StartOption {
+	return optionFunc(func(setup *clientSetup) {
+		if setup.labels == nil {
+			setup.labels = make(map[string]string)
+		}
+		for k, v := range labels {
+			setup.labels[k] = v
+		}
+	})
+}
+
+// WithNetworks connects the client container to the given networks before the client
+// process starts. The networks must have been created using CreateNetwork. Starting the
+// client fails if any of the networks doesn't exist.
+func WithNetworks(names ...string) StartOption {
+	return optionFunc(func(setup *clientSetup) {
+		setup.networks = append(setup.networks, names...)
+	})
+}
+
+// WithNoDefaultNetwork starts the client without connecting it to the default bridge
+// network. The client is only reachable through networks it is connected to, either with
+// WithNetworks or later using ConnectContainer. This is useful for network partition
+// tests which need full control over the connectivity of clients.
+//
+// Since hive can't reach the client, it does not wait for the client to open its RPC
+// port before returning, and the returned IP address is nil. Use ContainerIP to get the
+// address of the client in a network.
+func WithNoDefaultNetwork() StartOption {
+	return optionFunc(func(setup *clientSetup) {
+		setup.noDefaultNetwork = true
+	})
+}
+
+// WithPrivileged runs the client container in privileged mode. This is needed for tests
+// which run tools like tc or iptables inside the client container.
+//
+// Note that a privileged container has full access to the devices and kernel of the
+// docker host. A client running in privileged mode can affect the host and other
+// containers, so use this option only when required. Consider WithCapabilities when
+// the test needs a specific privilege.
+func WithPrivileged() StartOption {
+	return optionFunc(func(setup *clientSetup) {
+		setup.privileged = true
+	})
+}
+
+// WithCapabilities adds Linux capabilities to the client container, e.g. "NET_ADMIN" to
+// configure traffic shaping using tc. Unlike WithPrivileged, this grants only the
+// given privileges.
+func WithCapabilities(caps ...string) StartOption {
+	return optionFunc(func(setup *clientSetup) {
+		setup.capabilities = append(setup.capabilities, caps...)
+	})
+}
+
+// WithUlimit sets a resource limit of processes in the client container, like the
+// --ulimit flag of 'docker run'. For example, WithUlimit("nofile", 65536, 65536) raises
+// the limit of open files for tests creating many connections. The limits appear in the
+// output of ClientInspect.
+func WithUlimit(name string, soft, hard int64) StartOption {
+	return optionFunc(func(setup *clientSetup) {
+		if name == "" || soft < 0 || soft > hard {
+			setup.setError(fmt.Errorf("invalid ulimit %s=%d:%d", name, soft, hard))
+			return
+		}
+		if setup.ulimits == nil {
+			setup.ulimits = make(map[string]string)
+		}
+		setup.ulimits[name] = fmt.Sprintf("%d:%d", soft, hard)
+	})
+}
+
+// WithVolume mounts an existing named docker volume at the given absolute path in the
+// client container. This can be used to share a large pre-generated dataset between
+// clients instead of copying it into every container. Mount the volume read-only when
+// multiple clients use it at the same time.
+//
+// The volume must be created before the client is started, e.g. using 'docker volume
+// create'. Hive does not remove the volume.
+func WithVolume(volumeName, containerPath string, readOnly bool) StartOption {
+	return optionFunc(func(setup *clientSetup) {
+		if volumeName == "" || !path.IsAbs(containerPath) {
+			setup.setError(fmt.Errorf("invalid volume mount %s:%s", volumeName, containerPath))
+			return
+		}
+		if setup.volumes == nil {
+			setup.volumes = make(map[string]string)
+		}
+		value := volumeName
+		if readOnly {
+			value += ":ro"
+		}
+		setup.volumes[path.Clean(containerPath)] = value
+	})
+}
+
+// WithMemoryLimit limits the memory available to the client container. The limit is
+// enforced by docker, and the client is killed when it exceeds it.
+func WithMemoryLimit(bytes int64) StartOption {
+	return optionFunc(func(setup *clientSetup) {
+		if bytes <= 0 {
+			setup.setError(fmt.Errorf("invalid memory limit %d", bytes))
+			return
+		}
+		setup.memoryLimit = bytes
+	})
+}
+
+// WithCPULimit limits the CPU time available to the client container. The number of
+// cores can be fractional, e.g. 0.5 allows the client to use half of one CPU.
+func WithCPULimit(cores float64) StartOption {
+	return optionFunc(func(setup *clientSetup) {
+		if cores <= 0 {
+			setup.setError(fmt.Errorf("invalid CPU limit %v", cores))
+			return
+		}
+		setup.cpuLimit = cores
+	})
+}
+
+// WithStartTimeout limits the time to wait for the client to start. If the client is not
+// running within the timeout, starting it fails with ErrStartTimeout and the container is
+// removed. The timeout overrides the default timeout of hive, which can be set using the
+// --client.checktimelimit flag.
+func WithStartTimeout(d time.Duration) StartOption {
+	return optionFunc(func(setup *clientSetup) {
+		if d <= 0 {
+			setup.setError(fmt.Errorf("invalid start timeout %v", d))
+			return
+		}
+		setup.startTimeout = d
+	})
+}
+
+// WithExtraStartup starts an auxiliary process in the client container after the
+// client has started, e.g. a metrics scraper. Like with ClientExec, the first element
+// of cmd is the name of a script in the /hive-bin directory of the container.
+//
+// The process runs in the background until the client container stops, and its output
+// is discarded. Starting the client fails if the process can't be started. When the
+// option is given multiple times, the processes are started in order.
+func WithExtraStartup(cmd []string) StartOption {
+	return optionFunc(func(setup *clientSetup) {
+		if len(cmd) == 0 {
+			setup.setError(errors.New("empty startup command"))
+			return
+		}
+		setup.startup = append(setup.startup, cmd)
+	})
+}
+
+// WithImage runs the client from the given docker image instead of the image hive built
+// for the client type, e.g. a nightly build pushed to a registry. The reference has the
+// same format as for 'docker pull', e.g. "ethereum/client-go:latest". The image is pulled
+// if it doesn't exist locally, and starting the client fails if it can't be pulled.
+//
+// The image must be compatible with the hive client definition of the client type, i.e.
+// contain its entry point and scripts. WithImage can't be combined with WithBuildArg.
+func WithImage(ref string) StartOption {
+	return optionFunc(func(setup *clientSetup) {
+		if ref == "" {
+			setup.setError(errors.New("empty image reference"))
+			return
+		}
+		setup.image = ref
+	})
+}
+
+// WithTAR adds the content of a TAR archive to the client. The archive is extracted into
+// the root directory of the container, so entries should be named by their absolute path
+// without the leading slash, e.g. "data/genesis.json".
+//
+// The src function is called once for each client started with the returned option.
+// Use TARFromDir to create the archive from a local directory.
+func WithTAR(src func() io.ReadCloser) StartOption {
+	return optionFunc(func(setup *clientSetup) {
+		setup.archives = append(setup.archives, archiveSource{fileTypeTAR, src})
+	})
+}
+
+// WithGzipTAR is like WithTAR, but src provides a gzip-compressed TAR archive. The
+// compressed data is uploaded as-is and decompressed by hive. Versions of hive that do
+// not support compressed archives reject the client start request.
+func WithGzipTAR(src func() io.ReadCloser) StartOption {
+	return optionFunc(func(setup *clientSetup) {
+		setup.archives = append(setup.archives, archiveSource{fileTypeTARGzip, src})
+	})
+}
+
+// WithUploadedTAR adds a TAR archive which was uploaded using Upload to the client. Like
+// with WithTAR, the archive is extracted into the root directory of the container. It may
+// also be gzip-compressed.
+//
+// Uploaded archives are extracted after all other files of the client, in the order they
+// were added. An upload can be used by any number of clients in the test suite.
+func WithUploadedTAR(uploadID string) StartOption {
+	return optionFunc(func(setup *clientSetup) {
+		if uploadID == "" {
+			setup.setError(errors.New("empty upload ID"))
+			return
+		}
+		setup.uploads = append(setup.uploads, uploadID)
+	})
+}
+
+// WithTARChecksum enables integrity verification of archives added by WithTAR and
+// WithGzipTAR. The SHA-256 digest of each archive is computed while it is uploaded, and
+// hive rejects the client start request if the received data doesn't match it.
+//
+// If fn is non-nil, it is called with the index and hex-encoded digest of each archive
+// after it has been uploaded. Archives are numbered in the order they were added.
+func WithTARChecksum(fn func(archive int, digest string)) StartOption {
+	return optionFunc(func(setup *clientSetup) {
+		setup.tarChecksum = true
+		setup.tarChecksumFn = fn
+	})
+}
+
+// WithUploadProgress sets a function which is called with the number of bytes sent while
+// the client start request is uploaded. This can be used to log the progress of large
+// uploads. The count includes all files and form fields of the request.
+//
+// The function is called at most once per second, and once more when the upload is
+// complete. It is called on a different goroutine than StartClientWithOptions and must
+// not block.
+func WithUploadProgress(fn func(bytesSent int64)) StartOption {
+	return optionFunc(func(setup *clientSetup) {
+		setup.uploadProgress = fn
+	})
+}
+
+// uploadProgressInterval is the minimum time between calls of the upload progress
+// function.
+const uploadProgressInterval = time.Second
+
+// progressWriter counts the bytes written to w and reports the count to fn.
+type progressWriter struct {
+	w      io.Writer
+	fn     func(int64)
+	n      int64
+	report time.Time // time of the last report
+}
+
+func (pw *progressWriter) Write(b []byte) (int, error) {
+	n, err := pw.w.Write(b)
+	pw.n += int64(n)
+	if now := time.Now(); now.Sub(pw.report) >= uploadProgressInterval {
+		pw.report = now
+		pw.fn(pw.n)
+	}
+	return n, err
+}
+
+// WithBytes adds a file with the given content to the client. This is useful for files
+// generated by the simulator, such as genesis.json, which would otherwise have to be
+// written to a temporary file first. The data must not be modified after calling WithBytes.
+func WithBytes(dstPath string, data []byte) StartOption {
+	return WithDynamicFile(dstPath, func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(data)), nil
+	})
+}
+
+// WithFileReader adds a file to the client, reading its content from r. If r implements
+// io.Closer, it is closed after the content has been read.
+//
+// Unlike other file options, the returned StartOption can be used for a single client
+// start only because the reader is consumed. For the same reason, the start request is
+// not retried when it fails.
+func WithFileReader(dstPath string, r io.Reader) StartOption {
+	var used int32
+	return optionFunc(func(setup *clientSetup) {
+		setup.singleUse = true
+		setup.files[dstPath] = func() (io.ReadCloser, error) {
+			if !atomic.CompareAndSwapInt32(&used, 0, 1) {
+				return nil, fmt.Errorf("reader for %s was already consumed", dstPath)
+			}
+			if rc, ok := r.(io.ReadCloser); ok {
+				return rc, nil
+			}
+			return ioutil.NopCloser(r), nil
+		}
+	})
+}
+
+// execRequest is the body of a client exec request. It is configured by ExecOptions.
+type execRequest struct {
+	Command []string          `json:"command"`
+	Script  []byte            `json:"script,omitempty"`
+	Stdin   []byte            `json:"stdin,omitempty"`
+	Stream  bool              `json:"stream,omitempty"`
+	Detach  bool              `json:"detach,omitempty"`
+	Raw     bool              `json:"raw,omitempty"`
+	Timeout string            `json:"timeout,omitempty"`
+	WorkDir string            `json:"workdir,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+	User    string            `json:"user,omitempty"`
+	Group   string            `json:"group,omitempty"`
+
+	stdin io.Reader // read into Stdin when the request is sent
+}
+
+func newExecRequest(cmd []string, options []ExecOption) *execRequest {
+	request := &execRequest{Command: cmd}
+	for _, opt := range options {
+		opt.Apply(request)
+	}
+	return request
+}
+
+// ExecOption is a parameter for running a command in a client.
+type ExecOption interface {
+	Apply(req *execRequest)
+}
+
+type execOptionFunc func(req *execRequest)
+
+func (fn execOptionFunc) Apply(req *execRequest) { fn(req) }
+
+// WithStdin provides input to the command. The reader is consumed when the command is
+// sent to hive. If r is nil, the command runs without input.
+func WithStdin(r io.Reader) ExecOption {
+	return execOptionFunc(func(req *execRequest) {
+		req.stdin = r
+	})
+}
+
+// WithExecTimeout sets the maximum running time of the command. When the timeout
+// expires, hive kills the command and the exec call returns ErrExecTimeout along with
+// the output produced until then.
+func WithExecTimeout(timeout time.Duration) ExecOption {
+	return execOptionFunc(func(req *execRequest) {
+		req.Timeout = timeout.String()
+	})
+}
+
+// WithWorkDir sets the working directory of the command. The directory must be an
+// absolute path in the client container. By default, commands run in the working
+// directory of the container.
+func WithWorkDir(dir string) ExecOption {
+	return execOptionFunc(func(req *execRequest) {
+		req.WorkDir = dir
+	})
+}
+
+// WithExecUser runs the command as the given user, which can be a name or numeric user
+// ID. By default, commands run as the user of the client container.
+func WithExecUser(user string) ExecOption {
+	return execOptionFunc(func(req *execRequest) {
+		req.User = user
+	})
+}
+
+// WithExecGroup runs the command with the given group, which can be a name or numeric
+// group ID. This is useful when the command needs the file permissions of a group. The
+// group must be used together with WithExecUser.
+func WithExecGroup(group string) ExecOption {
+	return execOptionFunc(func(req *execRequest) {
+		req.Group = group
+	})
+}
+
+// WithExecEnv sets environment variables for the command. The variables apply to this
+// command only, the environment of the client container is not modified. When the
+// option is given multiple times, the variables are merged.
+func WithExecEnv(env map[string]string) ExecOption {
+	return execOptionFunc(func(req *execRequest) {
+		if req.Env == nil {
+			req.Env = make(map[string]string, len(env))
+		}
+		for k, v := range env {
+			req.Env[k] = v
+		}
+	})
+}
+
 // Bundle combines start options, e.g. to bundle files together as option.
 func Bundle(option ...StartOption) StartOption {
 	return optionFunc(func(setup *clientSetup) {
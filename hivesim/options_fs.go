@@ -0,0 +1,61 @@
+//go:build go1.16
+// +build go1.16
+
+package hivesim
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// WithFS adds files from fsys to the client. This can be used with embedded
+// filesystems to supply test fixtures without extracting them to disk.
+//
+// The keys of the files map are source paths in fsys, the values are destination paths in
+// the client container. If a source path is a directory, all files below it are added
+// to the corresponding location below the destination path. Sources that can't be opened
+// cause the client start request to fail before it is sent.
+func WithFS(fsys fs.FS, files map[string]string) StartOption {
+	return optionFunc(func(setup *clientSetup) {
+		for src, dst := range files {
+			addFSFiles(setup, fsys, src, dst)
+		}
+	})
+}
+
+func addFSFiles(setup *clientSetup, fsys fs.FS, src, dst string) {
+	info, err := fs.Stat(fsys, src)
+	if err != nil || !info.IsDir() {
+		setup.files[dst] = fsFileAsSrc(fsys, src)
+		return
+	}
+	err = fs.WalkDir(fsys, src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel := p
+		if src != "." {
+			rel = strings.TrimPrefix(p, src+"/")
+		}
+		setup.files[path.Join(dst, rel)] = fsFileAsSrc(fsys, p)
+		return nil
+	})
+	if err != nil {
+		setup.files[dst] = func() (io.ReadCloser, error) {
+			return nil, fmt.Errorf("can't read directory %s: %w", src, err)
+		}
+	}
+}
+
+func fsFileAsSrc(fsys fs.FS, name string) func() (io.ReadCloser, error) {
+	return func() (io.ReadCloser, error) {
+		f, err := fsys.Open(name)
+		if err != nil {
+			return nil, fmt.Errorf("can't open %s: %w", name, err)
+		}
+		return f, nil
+	}
+}
@@ -0,0 +1,82 @@
+//go:build go1.16
+// +build go1.16
+
+package hivesim
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/ethereum/hive/internal/fakes"
+	"github.com/ethereum/hive/internal/libhive"
+)
+
+// This checks that WithFS adds files and directories from an fs.FS.
+func TestStartClientWithFS(t *testing.T) {
+	var lastOptions libhive.ContainerOptions
+	var started int
+	tm, srv := newFakeAPI(&fakes.BackendHooks{
+		StartContainer: func(containerID string, opt libhive.ContainerOptions) (*libhive.ContainerInfo, error) {
+			lastOptions = opt
+			started++
+			return &libhive.ContainerInfo{}, nil
+		},
+	})
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	testID, err := sim.StartTest(suiteID, "test", "")
+	if err != nil {
+		t.Fatal("can't start test:", err)
+	}
+
+	fsys := fstest.MapFS{
+		"genesis.json":        {Data: []byte("{}")},
+		"keys/a/key.json":     {Data: []byte("aaa")},
+		"keys/b/key.json":     {Data: []byte("bbbb")},
+		"keys/b/password.txt": {Data: []byte("p")},
+	}
+	_, _, err = sim.StartClientWithOptions(suiteID, testID, "client-1", WithFS(fsys, map[string]string{
+		"genesis.json": "/genesis.json",
+		"keys":         "/keystore",
+	}))
+	if err != nil {
+		t.Fatalf("failed to start client: %v", err)
+	}
+	want := map[string]int64{
+		"/genesis.json":            2,
+		"/keystore/a/key.json":     3,
+		"/keystore/b/key.json":     4,
+		"/keystore/b/password.txt": 1,
+	}
+	if len(lastOptions.Files) != len(want) {
+		t.Fatalf("wrong number of files %d, want %d", len(lastOptions.Files), len(want))
+	}
+	for name, size := range want {
+		f, ok := lastOptions.Files[name]
+		if !ok {
+			t.Fatalf("missing %s", name)
+		}
+		if f.Size != size {
+			t.Fatalf("expected %d bytes for %s, got %d", size, name, f.Size)
+		}
+	}
+
+	// Missing source files fail before the request is sent.
+	_, _, err = sim.StartClientWithOptions(suiteID, testID, "client-1", WithFS(fsys, map[string]string{
+		"missing.json": "/genesis.json",
+	}))
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("wrong error for missing file: %v", err)
+	}
+	if started != 1 {
+		t.Fatalf("client started %d times, want 1", started)
+	}
+}
@@ -0,0 +1,37 @@
+package hivesim
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNoOutputDir is returned by TestOutputDir when the simulator has no access to the
+// log directory of hive, i.e. when the HIVE_OUTPUT_DIR environment variable is not set.
+var ErrNoOutputDir = errors.New("hive output directory not available")
+
+// TestOutputDir returns the output directory of a running test, creating it if
+// necessary. Files written to this directory, e.g. packet captures or profiles, are
+// stored with the hive results and attached to the test result when the test ends.
+// Files in subdirectories are attached by their path relative to the output directory.
+//
+// The directory is only available in simulators run by hive, which mounts its log
+// directory into the simulator container. Use this when the files are too large to
+// send as attachments of the test result.
+func (sim *Simulation) TestOutputDir(testSuite SuiteID, test TestID) (string, error) {
+	return sim.TestOutputDirContext(context.Background(), testSuite, test)
+}
+
+// TestOutputDirContext is like TestOutputDir, but the request can be cancelled using ctx.
+func (sim *Simulation) TestOutputDirContext(ctx context.Context, testSuite SuiteID, test TestID) (string, error) {
+	if sim.outputDir == "" {
+		return "", ErrNoOutputDir
+	}
+	dir, err := sim.request(ctx, http.MethodPost, sim.endpoint("/testsuite/%d/test/%d/output", testSuite, test))
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(sim.outputDir, filepath.FromSlash(strings.TrimSpace(dir))), nil
+}
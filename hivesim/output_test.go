@@ -0,0 +1,76 @@
+package hivesim
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/hive/internal/fakes"
+	"github.com/ethereum/hive/internal/libhive"
+)
+
+// This test checks that files in the test output directory are attached to the result.
+func TestTestOutputDir(t *testing.T) {
+	logDir, err := ioutil.TempDir("", "hivesim-output-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(logDir)
+	tm := libhive.NewTestManager(libhive.SimEnv{LogDir: logDir}, fakes.NewContainerBackend(nil), -1)
+	srv := httptest.NewServer(tm.API())
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	testID, err := sim.StartTest(suiteID, "test", "")
+	if err != nil {
+		t.Fatal("can't start test:", err)
+	}
+	if _, err := sim.TestOutputDir(suiteID, testID); err != ErrNoOutputDir {
+		t.Fatalf("wrong error without output directory: %v", err)
+	}
+
+	// The simulator sees the log directory at the same path.
+	sim.outputDir = logDir
+	dir, err := sim.TestOutputDir(suiteID, testID)
+	if err != nil {
+		t.Fatal("can't get output directory:", err)
+	}
+	if again, _ := sim.TestOutputDir(suiteID, testID); again != dir {
+		t.Fatalf("output directory changed: %s != %s", again, dir)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "pcap"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"profile.out", filepath.Join("pcap", "node1.pcap")} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sim.EndTest(suiteID, testID, TestResult{Pass: true}); err != nil {
+		t.Fatal("can't end test:", err)
+	}
+	if err := sim.EndSuite(suiteID); err != nil {
+		t.Fatal("can't end suite:", err)
+	}
+
+	attachments := tm.Results()[libhive.TestSuiteID(suiteID)].TestCases[libhive.TestID(testID)].Attachments
+	if len(attachments) != 2 {
+		t.Fatalf("wrong attachments %v", attachments)
+	}
+	for _, name := range []string{"profile.out", "pcap/node1.pcap"} {
+		content, err := ioutil.ReadFile(filepath.Join(logDir, filepath.FromSlash(attachments[name])))
+		if err != nil {
+			t.Fatalf("attachment %s: %v", name, err)
+		}
+		if string(content) != filepath.FromSlash(name) {
+			t.Fatalf("attachment %s has wrong content %q", name, content)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package hivesim
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParamsBuilder creates client parameters, checking them for common mistakes. Errors
+// are reported by Build, or when the builder is used as a StartOption.
+//
+//	params, err := hivesim.NewParams().WithChainID(1337).WithNetworkID(1337).Build()
+type ParamsBuilder struct {
+	params Params
+	err    error
+}
+
+var _ StartOption = (*ParamsBuilder)(nil)
+
+// NewParams creates an empty parameter builder.
+func NewParams() *ParamsBuilder {
+	return &ParamsBuilder{params: make(Params)}
+}
+
+// Set sets a parameter. Keys must be "CLIENT" or start with "HIVE_", because hive does
+// not pass any other parameters to the client.
+func (b *ParamsBuilder) Set(key, value string) *ParamsBuilder {
+	if err := checkParam(key, value); err != nil {
+		b.setError(err)
+		return b
+	}
+	b.params[key] = value
+	return b
+}
+
+// WithClient sets the client type.
+func (b *ParamsBuilder) WithClient(name string) *ParamsBuilder {
+	return b.Set("CLIENT", name)
+}
+
+// WithChainID sets HIVE_CHAIN_ID.
+func (b *ParamsBuilder) WithChainID(id uint64) *ParamsBuilder {
+	return b.Set("HIVE_CHAIN_ID", strconv.FormatUint(id, 10))
+}
+
+// WithNetworkID sets HIVE_NETWORK_ID.
+func (b *ParamsBuilder) WithNetworkID(id uint64) *ParamsBuilder {
+	return b.Set("HIVE_NETWORK_ID", strconv.FormatUint(id, 10))
+}
+
+// WithBootnode sets HIVE_BOOTNODE.
+func (b *ParamsBuilder) WithBootnode(enode string) *ParamsBuilder {
+	return b.Set("HIVE_BOOTNODE", enode)
+}
+
+// WithLogLevel sets HIVE_LOGLEVEL. The level ranges from 0 (silent) to 5 (trace).
+func (b *ParamsBuilder) WithLogLevel(level int) *ParamsBuilder {
+	return b.Set("HIVE_LOGLEVEL", strconv.Itoa(level))
+}
+
+// Build returns the parameters, or the first error encountered while setting them.
+func (b *ParamsBuilder) Build() (Params, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	return b.params.Copy(), nil
+}
+
+// Apply implements StartOption. If the builder has an error, starting the client fails.
+func (b *ParamsBuilder) Apply(setup *clientSetup) {
+	if b.err != nil {
+		setup.setError(b.err)
+		return
+	}
+	b.params.Apply(setup)
+}
+
+func (b *ParamsBuilder) setError(err error) {
+	if b.err == nil {
+		b.err = err
+	}
+}
+
+// numericParams are parameters that must be non-negative integers.
+var numericParams = map[string]bool{
+	"HIVE_CHAIN_ID":            true,
+	"HIVE_NETWORK_ID":          true,
+	"HIVE_LOGLEVEL":            true,
+	"HIVE_CLIQUE_PERIOD":       true,
+	"HIVE_FORK_HOMESTEAD":      true,
+	"HIVE_FORK_DAO_BLOCK":      true,
+	"HIVE_FORK_TANGERINE":      true,
+	"HIVE_FORK_SPURIOUS":       true,
+	"HIVE_FORK_BYZANTIUM":      true,
+	"HIVE_FORK_CONSTANTINOPLE": true,
+	"HIVE_FORK_PETERSBURG":     true,
+	"HIVE_FORK_ISTANBUL":       true,
+	"HIVE_FORK_MUIR_GLACIER":   true,
+	"HIVE_FORK_BERLIN":         true,
+	"HIVE_FORK_LONDON":         true,
+}
+
+func checkParam(key, value string) error {
+	switch {
+	case key == "CLIENT":
+		if value == "" {
+			return fmt.Errorf("empty CLIENT parameter")
+		}
+		return nil
+	case !strings.HasPrefix(key, "HIVE_") || key == "HIVE_":
+		return fmt.Errorf("invalid parameter %q: name must start with HIVE_", key)
+	}
+	for _, c := range key {
+		if !(c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			return fmt.Errorf("invalid parameter %q: name must be uppercase", key)
+		}
+	}
+	if numericParams[key] {
+		if _, err := strconv.ParseUint(value, 10, 64); err != nil {
+			return fmt.Errorf("invalid value %q for parameter %s: not a number", value, key)
+		}
+	}
+	return nil
+}
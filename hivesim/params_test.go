@@ -0,0 +1,55 @@
+package hivesim
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParamsBuilder(t *testing.T) {
+	params, err := NewParams().
+		WithClient("go-ethereum").
+		WithChainID(1337).
+		WithNetworkID(1338).
+		WithLogLevel(4).
+		Set("HIVE_FORK_LONDON", "10").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Params{
+		"CLIENT":           "go-ethereum",
+		"HIVE_CHAIN_ID":    "1337",
+		"HIVE_NETWORK_ID":  "1338",
+		"HIVE_LOGLEVEL":    "4",
+		"HIVE_FORK_LONDON": "10",
+	}
+	if !reflect.DeepEqual(params, want) {
+		t.Fatalf("wrong params %v, want %v", params, want)
+	}
+}
+
+func TestParamsBuilderErrors(t *testing.T) {
+	tests := []struct {
+		b   *ParamsBuilder
+		err string
+	}{
+		{NewParams().WithClient(""), "empty CLIENT parameter"},
+		{NewParams().Set("CHAIN_ID", "1"), `invalid parameter "CHAIN_ID": name must start with HIVE_`},
+		{NewParams().Set("HIVE_", "1"), `invalid parameter "HIVE_": name must start with HIVE_`},
+		{NewParams().Set("HIVE_chain_id", "1"), `invalid parameter "HIVE_chain_id": name must be uppercase`},
+		{NewParams().Set("HIVE_FORK_BERLIN", "0x10"), `invalid value "0x10" for parameter HIVE_FORK_BERLIN: not a number`},
+		// The first error is reported.
+		{NewParams().WithClient("").Set("X", "1"), "empty CLIENT parameter"},
+	}
+	for _, test := range tests {
+		_, err := test.b.Build()
+		if err == nil || err.Error() != test.err {
+			t.Errorf("wrong error %v, want %q", err, test.err)
+		}
+		setup := &clientSetup{parameters: make(map[string]string)}
+		test.b.Apply(setup)
+		if setup.err != err {
+			t.Errorf("Apply set wrong error %v", setup.err)
+		}
+	}
+}
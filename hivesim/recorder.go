@@ -0,0 +1,200 @@
+package hivesim
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// RecordedRequest is an API request captured by a Recorder.
+type RecordedRequest struct {
+	Method string
+	Path   string     // URL path, e.g. "/testsuite/1/test/2/node"
+	Query  url.Values // URL query parameters
+	Params url.Values // form fields, or the fields of JSON object bodies
+
+	// Files contains the multipart fields with a filename, keyed by field name.
+	Files map[string][]byte
+	// Body is the raw request body of requests which are not forms, e.g. JSON requests.
+	Body []byte
+}
+
+// Responder computes the response of a Recorder to an API request.
+type Responder func(req *RecordedRequest) (status int, body string)
+
+// Recorder captures the API requests of a Simulation instead of sending them to hive.
+// This can be used to test simulator logic without Docker or a running hive instance.
+// Use NewRecording to create a Simulation using a Recorder.
+//
+// By default, the Recorder responds to requests which start suites, tests and clients
+// with new IDs, lists no client types, and reports successful execution of commands in
+// clients. All other requests succeed with an empty response body. Use SetResponder to
+// simulate other responses.
+type Recorder struct {
+	mu        sync.Mutex
+	requests  []RecordedRequest
+	responder Responder
+	suites    int
+	tests     int
+	nodes     int
+}
+
+// NewRecording creates a Simulation which records all API requests in the returned
+// Recorder.
+func NewRecording() (*Simulation, *Recorder) {
+	rec := new(Recorder)
+	sim := NewAt("http://hive.invalid")
+	sim.SetHTTPClient(&http.Client{Transport: rec})
+	return sim, rec
+}
+
+// SetResponder sets the function which computes responses. If fn is nil, the default
+// responses are restored.
+func (rec *Recorder) SetResponder(fn Responder) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.responder = fn
+}
+
+// Requests returns the requests recorded so far, in the order they were sent.
+func (rec *Recorder) Requests() []RecordedRequest {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return append([]RecordedRequest(nil), rec.requests...)
+}
+
+// Reset discards all recorded requests.
+func (rec *Recorder) Reset() {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.requests = nil
+}
+
+// RoundTrip implements http.RoundTripper.
+func (rec *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	recorded, err := recordRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	rec.mu.Lock()
+	rec.requests = append(rec.requests, *recorded)
+	responder := rec.responder
+	if responder == nil {
+		responder = rec.defaultResponse
+	}
+	rec.mu.Unlock()
+
+	status, body := responder(recorded)
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        make(http.Header),
+		Body:          ioutil.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// defaultResponse computes the default responses.
+func (rec *Recorder) defaultResponse(req *RecordedRequest) (int, string) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	path := strings.Split(strings.Trim(req.Path, "/"), "/")
+	switch {
+	case req.Method == http.MethodGet && req.Path == "/clients":
+		return http.StatusOK, "[]"
+	case req.Method != http.MethodPost:
+		return http.StatusOK, ""
+	case len(path) == 1 && path[0] == "testsuite":
+		rec.suites++
+		return http.StatusOK, fmt.Sprint(rec.suites)
+	case len(path) == 3 && path[2] == "test":
+		rec.tests++
+		return http.StatusOK, fmt.Sprint(rec.tests)
+	case len(path) == 5 && path[4] == "node":
+		rec.nodes++
+		return http.StatusOK, fmt.Sprintf("client-%d@192.0.2.%d@", rec.nodes, rec.nodes%254+1)
+	case len(path) == 7 && path[4] == "node" && path[6] == "exec":
+		return http.StatusOK, `{"stdout":"","stderr":"","exitCode":0}`
+	}
+	return http.StatusOK, ""
+}
+
+// recordRequest reads the body of req and decodes its form fields and files.
+func recordRequest(req *http.Request) (*RecordedRequest, error) {
+	recorded := &RecordedRequest{
+		Method: req.Method,
+		Path:   req.URL.Path,
+		Query:  req.URL.Query(),
+		Params: make(url.Values),
+		Files:  make(map[string][]byte),
+	}
+	if req.Body == nil {
+		return recorded, nil
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	mediaType, params, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	switch {
+	case mediaType == "application/x-www-form-urlencoded":
+		if recorded.Params, err = url.ParseQuery(string(body)); err != nil {
+			return nil, err
+		}
+	case strings.HasPrefix(mediaType, "multipart/"):
+		mr := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+		for {
+			part, err := mr.NextPart()
+			if err != nil {
+				if err == io.EOF {
+					break
+				}
+				return nil, err
+			}
+			data, err := ioutil.ReadAll(part)
+			if err != nil {
+				return nil, err
+			}
+			if part.FileName() != "" {
+				recorded.Files[part.FormName()] = data
+			} else {
+				recorded.Params.Add(part.FormName(), string(data))
+			}
+		}
+	case mediaType == "application/json":
+		recorded.Body = body
+		// Like hive, store the fields of JSON objects as parameters.
+		var params map[string]json.RawMessage
+		if json.Unmarshal(body, &params) == nil {
+			for key, raw := range params {
+				var s string
+				if json.Unmarshal(raw, &s) == nil {
+					recorded.Params.Set(key, s)
+				} else {
+					recorded.Params.Set(key, string(raw))
+				}
+			}
+		}
+	default:
+		if len(body) > 0 {
+			recorded.Body = body
+		}
+	}
+	return recorded, nil
+}
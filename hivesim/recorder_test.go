@@ -0,0 +1,67 @@
+package hivesim
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// This test checks that a recording simulation captures requests without a hive server.
+func TestRecorder(t *testing.T) {
+	sim, rec := NewRecording()
+
+	suite, err := sim.StartSuite("suite", "the suite", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	test, err := sim.StartTest(suite, "test", "")
+	if err != nil {
+		t.Fatal("can't start test:", err)
+	}
+	id, ip, err := sim.StartClientWithOptions(suite, test, "client-1",
+		Params{"HIVE_NETWORK_ID": "1"},
+		WithBytes("/genesis.json", []byte("{}")))
+	if err != nil {
+		t.Fatal("can't start client:", err)
+	}
+	if id != "client-1" || ip.String() != "192.0.2.2" {
+		t.Fatalf("wrong client %s@%v", id, ip)
+	}
+	if _, err := sim.ClientExec(suite, test, id, []string{"echo.sh"}); err != nil {
+		t.Fatal("can't exec:", err)
+	}
+
+	reqs := rec.Requests()
+	if len(reqs) != 4 {
+		t.Fatalf("recorded %d requests, want 4", len(reqs))
+	}
+	if reqs[0].Method != http.MethodPost || reqs[0].Path != "/testsuite" || reqs[0].Params.Get("name") != "suite" {
+		t.Fatalf("wrong suite request %+v", reqs[0])
+	}
+	start := reqs[2]
+	if start.Path != "/testsuite/1/test/1/node" {
+		t.Fatalf("wrong client start path %q", start.Path)
+	}
+	if start.Params.Get("CLIENT") != "client-1" || start.Params.Get("HIVE_NETWORK_ID") != "1" {
+		t.Fatalf("wrong client start params %v", start.Params)
+	}
+	if want := map[string][]byte{"/genesis.json": []byte("{}")}; !reflect.DeepEqual(start.Files, want) {
+		t.Fatalf("wrong client start files %q", start.Files)
+	}
+	if exec := reqs[3]; exec.Path != "/testsuite/1/test/1/node/client-1/exec" || len(exec.Body) == 0 {
+		t.Fatalf("wrong exec request %+v", exec)
+	}
+
+	// Custom responses.
+	rec.Reset()
+	rec.SetResponder(func(req *RecordedRequest) (int, string) {
+		return http.StatusNotFound, "no such test"
+	})
+	err = sim.EndTest(suite, test, TestResult{Pass: true})
+	if httpErr, ok := err.(*HTTPError); !ok || httpErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("wrong error %v", err)
+	}
+	if reqs := rec.Requests(); len(reqs) != 1 || reqs[0].Params.Get("summaryresult") == "" {
+		t.Fatalf("wrong requests after reset %+v", reqs)
+	}
+}
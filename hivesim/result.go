@@ -0,0 +1,147 @@
+package hivesim
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// TestResultBuilder creates a test result with attachments. Attachments are files shown
+// along with the result in the hive viewer, e.g. the log of a failing node.
+//
+//	result := hivesim.NewTestResult().AddDetail("block", "10")
+//	result.Fail("block hash mismatch").AttachFile("node.log", logReader)
+//	err := sim.EndTestWithResult(suiteID, testID, result)
+type TestResultBuilder struct {
+	pass        bool
+	failed      bool
+	reasons     []string
+	details     []string
+	attachments []attachment
+}
+
+type attachment struct {
+	name string
+	r    io.Reader
+}
+
+// NewTestResult creates a result builder. The result is failing unless Pass is called.
+func NewTestResult() *TestResultBuilder {
+	return new(TestResultBuilder)
+}
+
+// Pass marks the test as passed. It has no effect if Fail was called.
+func (b *TestResultBuilder) Pass() *TestResultBuilder {
+	b.pass = true
+	return b
+}
+
+// Fail marks the test as failed. The reason is added to the result details.
+func (b *TestResultBuilder) Fail(reason string) *TestResultBuilder {
+	b.failed = true
+	b.reasons = append(b.reasons, reason)
+	return b
+}
+
+// AddDetail adds a "key: value" line to the result details.
+func (b *TestResultBuilder) AddDetail(key, value string) *TestResultBuilder {
+	b.details = append(b.details, key+": "+value)
+	return b
+}
+
+// AttachFile adds an attachment to the result. The content is read from r when the
+// result is submitted. The name must not contain path separators.
+func (b *TestResultBuilder) AttachFile(name string, r io.Reader) *TestResultBuilder {
+	b.attachments = append(b.attachments, attachment{name, r})
+	return b
+}
+
+// Result returns the test result. Failure reasons are listed before other details.
+func (b *TestResultBuilder) Result() TestResult {
+	lines := append(append([]string{}, b.reasons...), b.details...)
+	return TestResult{
+		Pass:    b.pass && !b.failed,
+		Details: strings.Join(lines, "\n"),
+	}
+}
+
+// EndTestWithResult is like EndTest, but also uploads the attachments of the result.
+func (sim *Simulation) EndTestWithResult(testSuite SuiteID, test TestID, result *TestResultBuilder) error {
+	return sim.EndTestWithResultContext(context.Background(), testSuite, test, result)
+}
+
+// EndTestWithResultContext is like EndTestWithResult, but the request can be cancelled
+// using ctx.
+func (sim *Simulation) EndTestWithResultContext(ctx context.Context, testSuite SuiteID, test TestID, result *TestResultBuilder) error {
+	summaryResultData, err := json.Marshal(result.Result())
+	if err != nil {
+		return fmt.Errorf("can't encode test result: %v", err)
+	}
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	if err := w.WriteField("summaryresult", string(summaryResultData)); err != nil {
+		return err
+	}
+	for _, a := range result.attachments {
+		if a.name == "" || a.name == "." || a.name == ".." || strings.ContainsAny(a.name, "/\\") {
+			return fmt.Errorf("invalid attachment name %q", a.name)
+		}
+		fw, err := w.CreateFormFile("attachment", a.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(fw, a.r); err != nil {
+			return fmt.Errorf("can't read attachment %q: %v", a.name, err)
+		}
+	}
+	w.Close()
+
+	url := sim.endpoint("/testsuite/%d/test/%d", testSuite, test)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	resp, err := sim.do(req)
+	if err != nil {
+		return requestError(ctx, err)
+	}
+	_, err = readResponse(resp)
+	return requestError(ctx, err)
+}
+
+// AddSuiteArtifact attaches a file to a test suite, e.g. a report covering all test
+// cases. The content is read from r and stored with the results of the suite. The name
+// must not contain path separators. Adding an artifact with the same name again replaces
+// the previous content.
+func (sim *Simulation) AddSuiteArtifact(testSuite SuiteID, name string, r io.Reader) error {
+	return sim.AddSuiteArtifactContext(context.Background(), testSuite, name, r)
+}
+
+// AddSuiteArtifactContext is like AddSuiteArtifact, but the request can be cancelled
+// using ctx.
+func (sim *Simulation) AddSuiteArtifactContext(ctx context.Context, testSuite SuiteID, name string, r io.Reader) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\\") {
+		return fmt.Errorf("invalid artifact name %q", name)
+	}
+	query := url.Values{"name": {name}}
+	endpoint := sim.endpoint("/testsuite/%d/attachment?%s", testSuite, query.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, endpoint, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := sim.do(req)
+	if err != nil {
+		return requestError(ctx, err)
+	}
+	_, err = readResponse(resp)
+	return requestError(ctx, err)
+}
@@ -0,0 +1,148 @@
+package hivesim
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/hive/internal/fakes"
+	"github.com/ethereum/hive/internal/libhive"
+)
+
+func TestTestResultBuilder(t *testing.T) {
+	tests := []struct {
+		b    *TestResultBuilder
+		want TestResult
+	}{
+		{NewTestResult(), TestResult{}},
+		{NewTestResult().Pass().AddDetail("block", "10"), TestResult{Pass: true, Details: "block: 10"}},
+		{
+			NewTestResult().AddDetail("block", "10").Fail("bad hash").Pass(),
+			TestResult{Pass: false, Details: "bad hash\nblock: 10"},
+		},
+	}
+	for i, test := range tests {
+		if got := test.b.Result(); got != test.want {
+			t.Errorf("test %d: wrong result %+v, want %+v", i, got, test.want)
+		}
+	}
+}
+
+// This test checks that result attachments are stored in the log directory.
+func TestEndTestWithResult(t *testing.T) {
+	logdir, err := ioutil.TempDir("", "hivesim-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(logdir)
+
+	env := libhive.SimEnv{LogDir: logdir}
+	tm := libhive.NewTestManager(env, fakes.NewContainerBackend(nil), -1)
+	srv := httptest.NewServer(tm.API())
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	testID, err := sim.StartTest(suiteID, "test", "")
+	if err != nil {
+		t.Fatal("can't start test:", err)
+	}
+	result := NewTestResult().Fail("timeout").AttachFile("node.log", strings.NewReader("log output"))
+	if err := sim.EndTestWithResult(suiteID, testID, result); err != nil {
+		t.Fatal("can't end test:", err)
+	}
+
+	// Attachment names must not contain path separators.
+	testID2, err := sim.StartTest(suiteID, "test", "")
+	if err != nil {
+		t.Fatal("can't start test:", err)
+	}
+	result = NewTestResult().AttachFile("../x", strings.NewReader(""))
+	if err := sim.EndTestWithResult(suiteID, testID2, result); err == nil || !strings.Contains(err.Error(), "invalid attachment name") {
+		t.Fatalf("wrong error for invalid attachment name: %v", err)
+	}
+	if err := sim.EndTest(suiteID, testID2, TestResult{}); err != nil {
+		t.Fatal("can't end test:", err)
+	}
+	if err := sim.EndSuite(suiteID); err != nil {
+		t.Fatal("can't end suite:", err)
+	}
+
+	testCase := tm.Results()[libhive.TestSuiteID(suiteID)].TestCases[libhive.TestID(testID)]
+	if testCase.SummaryResult != (libhive.TestResult{Pass: false, Details: "timeout"}) {
+		t.Fatalf("wrong summary result %+v", testCase.SummaryResult)
+	}
+	file, ok := testCase.Attachments["node.log"]
+	if !ok {
+		t.Fatalf("attachment missing from test case: %v", testCase.Attachments)
+	}
+	content, err := ioutil.ReadFile(filepath.Join(logdir, filepath.FromSlash(file)))
+	if err != nil {
+		t.Fatal("can't read attachment:", err)
+	}
+	if string(content) != "log output" {
+		t.Fatalf("wrong attachment content %q", content)
+	}
+}
+
+func TestAddSuiteArtifact(t *testing.T) {
+	logdir, err := ioutil.TempDir("", "hivesim-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(logdir)
+
+	env := libhive.SimEnv{LogDir: logdir}
+	tm := libhive.NewTestManager(env, fakes.NewContainerBackend(nil), -1)
+	srv := httptest.NewServer(tm.API())
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	testID, err := sim.StartTest(suiteID, "test", "")
+	if err != nil {
+		t.Fatal("can't start test:", err)
+	}
+	if err := sim.EndTest(suiteID, testID, TestResult{Pass: true}); err != nil {
+		t.Fatal("can't end test:", err)
+	}
+	if err := sim.AddSuiteArtifact(suiteID, "topology.svg", strings.NewReader("old")); err != nil {
+		t.Fatal("can't add artifact:", err)
+	}
+	if err := sim.AddSuiteArtifact(suiteID, "topology.svg", strings.NewReader("<svg/>")); err != nil {
+		t.Fatal("can't replace artifact:", err)
+	}
+	if err := sim.AddSuiteArtifact(suiteID, "../x", strings.NewReader("")); err == nil {
+		t.Fatal("expected error for invalid artifact name")
+	}
+	if err := sim.EndSuite(suiteID); err != nil {
+		t.Fatal("can't end suite:", err)
+	}
+	if err := sim.AddSuiteArtifact(suiteID, "late.txt", strings.NewReader("")); err == nil {
+		t.Fatal("expected error for ended suite")
+	}
+
+	suite := tm.Results()[libhive.TestSuiteID(suiteID)]
+	file, ok := suite.Attachments["topology.svg"]
+	if !ok || len(suite.Attachments) != 1 {
+		t.Fatalf("wrong suite attachments: %v", suite.Attachments)
+	}
+	content, err := ioutil.ReadFile(filepath.Join(logdir, filepath.FromSlash(file)))
+	if err != nil {
+		t.Fatal("can't read artifact:", err)
+	}
+	if string(content) != "<svg/>" {
+		t.Fatalf("wrong artifact content %q", content)
+	}
+}
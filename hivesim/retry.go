@@ -0,0 +1,91 @@
+package hivesim
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// retryPolicy configures how failed API requests are retried.
+type retryPolicy struct {
+	attempts  int
+	baseDelay time.Duration
+}
+
+// SetRetryPolicy configures retries of API requests which failed due to a transient
+// error, i.e. a connection failure or a 502 or 503 response. The request is attempted
+// up to maxAttempts times. The delay between attempts starts at baseDelay and doubles
+// after every attempt, with some random jitter added.
+//
+// Only idempotent requests (client and network queries) as well as client startup and
+// network creation/connection are retried. Client starts using WithFileReader are not
+// retried because the reader is consumed by the first attempt. Requests failing with a
+// 4xx status are never retried. By default, failed requests are not retried.
+//
+// SetRetryPolicy can be called while the simulation is in use. Requests which have
+// already started are not affected.
+func (sim *Simulation) SetRetryPolicy(maxAttempts int, baseDelay time.Duration) {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	sim.retry = retryPolicy{attempts: maxAttempts, baseDelay: baseDelay}
+}
+
+// withRetry runs fn until it succeeds, fails with a permanent error, or the maximum
+// number of attempts is reached. Waiting between attempts is aborted when ctx is
+// cancelled.
+func (sim *Simulation) withRetry(ctx context.Context, fn func() error) error {
+	sim.mu.RLock()
+	policy, logger := sim.retry, sim.logger
+	sim.mu.RUnlock()
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		if err = fn(); err == nil || !isTransient(ctx, err) || attempt+1 >= policy.attempts {
+			return err
+		}
+		delay := policy.delay(attempt)
+		if logger != nil {
+			logger.Debug("Retrying API request", "attempt", attempt+2, "delay", delay, "err", err)
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%v: %w", err, ctx.Err())
+		}
+	}
+}
+
+// delay returns the backoff delay after the given attempt.
+func (p retryPolicy) delay(attempt int) time.Duration {
+	if p.baseDelay <= 0 {
+		return 0
+	}
+	d := p.baseDelay << uint(attempt)
+	if d <= 0 {
+		d = p.baseDelay // overflow
+	}
+	// Add jitter: the delay is randomized within [d/2, d).
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// isTransient reports whether a failed request may succeed when retried. Other 5xx
+// responses, e.g. a client which did not start or a start timeout, are not transient
+// because hive handled the request and would fail again.
+func isTransient(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode == http.StatusBadGateway || httpErr.StatusCode == http.StatusServiceUnavailable
+	}
+	// Transport failures are reported as *url.Error by net/http.
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
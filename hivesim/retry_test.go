@@ -0,0 +1,111 @@
+package hivesim
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// This test checks that requests failing with a 5xx status are retried.
+func TestRetryTransient(t *testing.T) {
+	tm, srv := newFakeAPI(nil)
+	defer srv.Close()
+	defer tm.Terminate()
+
+	// This server fails the first two requests.
+	var requests int
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests <= 2 {
+			http.Error(w, "try again", http.StatusServiceUnavailable)
+			return
+		}
+		srv.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer flaky.Close()
+
+	sim := NewAt(flaky.URL)
+	if _, err := sim.ClientTypes(); err == nil {
+		t.Fatal("expected error without retry policy")
+	}
+
+	requests = 0
+	sim.SetRetryPolicy(3, time.Millisecond)
+	if _, err := sim.ClientTypes(); err != nil {
+		t.Fatal("request failed with retry policy:", err)
+	}
+	if requests != 3 {
+		t.Fatalf("wrong number of requests: %d", requests)
+	}
+}
+
+// This test checks that requests failing with a 4xx status are not retried.
+func TestRetryPermanent(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.Error(w, "bad request", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	sim := NewAt(srv.URL)
+	sim.SetRetryPolicy(5, time.Millisecond)
+	_, err := sim.ClientTypes()
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("wrong error: %v", err)
+	}
+	if requests != 1 {
+		t.Fatalf("wrong number of requests: %d", requests)
+	}
+}
+
+// This test checks that client starts with WithFileReader are not retried, and that the
+// error of the failed attempt is returned.
+func TestRetryFileReader(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		ioutil.ReadAll(r.Body)
+		http.Error(w, "no space left", http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	sim := NewAt(srv.URL)
+	sim.SetRetryPolicy(5, time.Millisecond)
+	_, _, err := sim.StartClientWithOptions(1, 1, "client-1", WithFileReader("/data", strings.NewReader("data")))
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("wrong error: %v", err)
+	}
+	if requests != 1 {
+		t.Fatalf("wrong number of requests: %d", requests)
+	}
+}
+
+// This test checks that only 502 and 503 responses are retried.
+func TestRetryStatusCodes(t *testing.T) {
+	for _, status := range []int{500, 501, 502, 503, 504} {
+		var requests int
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			http.Error(w, "error", status)
+		}))
+		sim := NewAt(srv.URL)
+		sim.SetRetryPolicy(2, time.Millisecond)
+		sim.ClientTypes()
+		srv.Close()
+
+		want := 1
+		if status == http.StatusBadGateway || status == http.StatusServiceUnavailable {
+			want = 2
+		}
+		if requests != want {
+			t.Errorf("status %d: wrong number of requests %d, want %d", status, requests, want)
+		}
+	}
+}
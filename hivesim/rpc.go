@@ -0,0 +1,53 @@
+package hivesim
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// DefaultRPCPort is the port of the client's HTTP RPC server used by ClientRPC.
+const DefaultRPCPort = 8545
+
+// ClientRPCURL returns the URL of an HTTP server of a running client, using the IP
+// address of the client in the bridge network and the given port. Use ClientPorts to
+// find the ports served by a client type.
+func (sim *Simulation) ClientRPCURL(testSuite SuiteID, test TestID, nodeid string, port int) (string, error) {
+	return sim.ClientRPCURLContext(context.Background(), testSuite, test, nodeid, port)
+}
+
+// ClientRPCURLContext is like ClientRPCURL, but the request can be cancelled using ctx.
+func (sim *Simulation) ClientRPCURLContext(ctx context.Context, testSuite SuiteID, test TestID, nodeid string, port int) (string, error) {
+	nodes, err := sim.NodesContext(ctx, testSuite, test)
+	if err != nil {
+		return "", err
+	}
+	for _, node := range nodes {
+		if node.ID != nodeid {
+			continue
+		}
+		if node.IP == nil {
+			return "", fmt.Errorf("client %s has no IP address in the bridge network", nodeid)
+		}
+		return "http://" + net.JoinHostPort(node.IP.String(), strconv.Itoa(port)), nil
+	}
+	return "", fmt.Errorf("client %s is not running in test %d", nodeid, test)
+}
+
+// ClientRPC returns an RPC client connected to the HTTP RPC server of a running client
+// on DefaultRPCPort. The caller should close the RPC client when done.
+func (sim *Simulation) ClientRPC(testSuite SuiteID, test TestID, nodeid string) (*rpc.Client, error) {
+	return sim.ClientRPCContext(context.Background(), testSuite, test, nodeid)
+}
+
+// ClientRPCContext is like ClientRPC, but the request can be cancelled using ctx.
+func (sim *Simulation) ClientRPCContext(ctx context.Context, testSuite SuiteID, test TestID, nodeid string) (*rpc.Client, error) {
+	url, err := sim.ClientRPCURLContext(ctx, testSuite, test, nodeid, DefaultRPCPort)
+	if err != nil {
+		return nil, err
+	}
+	return rpc.DialHTTP(url)
+}
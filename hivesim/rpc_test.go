@@ -0,0 +1,46 @@
+package hivesim
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestClientRPCURL(t *testing.T) {
+	sim, rec := NewRecording()
+	rec.SetResponder(func(req *RecordedRequest) (int, string) {
+		if req.Method == http.MethodGet && req.Path == "/testsuite/1/test/2/node" {
+			return http.StatusOK, `[{"id":"c1","name":"client-1","ip":"192.0.2.1"},{"id":"c2","name":"client-2","ip":"2001:db8::1"}]`
+		}
+		return http.StatusNotFound, "not found"
+	})
+
+	tests := []struct {
+		node, want string
+		port       int
+	}{
+		{"c1", "http://192.0.2.1:8545", DefaultRPCPort},
+		{"c1", "http://192.0.2.1:8551", 8551},
+		{"c2", "http://[2001:db8::1]:8545", DefaultRPCPort},
+	}
+	for _, test := range tests {
+		url, err := sim.ClientRPCURL(1, 2, test.node, test.port)
+		if err != nil {
+			t.Fatalf("%s: %v", test.node, err)
+		}
+		if url != test.want {
+			t.Errorf("%s: wrong URL %q, want %q", test.node, url, test.want)
+		}
+	}
+
+	if _, err := sim.ClientRPCURL(1, 2, "c3", DefaultRPCPort); err == nil {
+		t.Fatal("expected error for unknown client")
+	}
+	if _, err := sim.ClientRPC(1, 2, "c3"); err == nil {
+		t.Fatal("expected error for unknown client")
+	}
+	client, err := sim.ClientRPC(1, 2, "c1")
+	if err != nil {
+		t.Fatal("can't create RPC client:", err)
+	}
+	client.Close()
+}
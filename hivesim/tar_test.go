@@ -0,0 +1,73 @@
+package hivesim
+
+import (
+	"archive/tar"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestTARFromDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hivesim-tar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.MkdirAll(filepath.Join(dir, "keys", "a"), 0755)
+	os.MkdirAll(filepath.Join(dir, "empty"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "genesis.json"), []byte("{}"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "keys", "a", "key"), []byte("secret"), 0600)
+	ioutil.WriteFile(filepath.Join(dir, "run.sh"), []byte("#!/bin/sh"), 0755)
+	if err := os.Symlink("genesis.json", filepath.Join(dir, "link.json")); err != nil {
+		t.Fatal(err)
+	}
+
+	type entry struct {
+		typ     byte
+		mode    int64
+		content string
+		link    string
+	}
+	want := map[string]entry{
+		"empty/":       {typ: tar.TypeDir, mode: 0755},
+		"genesis.json": {typ: tar.TypeReg, mode: 0644, content: "{}"},
+		"keys/":        {typ: tar.TypeDir, mode: 0755},
+		"keys/a/":      {typ: tar.TypeDir, mode: 0755},
+		"keys/a/key":   {typ: tar.TypeReg, mode: 0600, content: "secret"},
+		"link.json":    {typ: tar.TypeSymlink, mode: 0777, link: "genesis.json"},
+		"run.sh":       {typ: tar.TypeReg, mode: 0755, content: "#!/bin/sh"},
+	}
+
+	r := TARFromDir(dir)()
+	defer r.Close()
+	got := make(map[string]entry)
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal("can't read archive:", err)
+		}
+		content, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal("can't read archive:", err)
+		}
+		got[header.Name] = entry{header.Typeflag, header.Mode & 0777, string(content), header.Linkname}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("wrong archive content:\ngot  %v\nwant %v", got, want)
+	}
+}
+
+func TestTARFromDirMissing(t *testing.T) {
+	r := TARFromDir("/does/not/exist")()
+	defer r.Close()
+	if _, err := ioutil.ReadAll(r); !os.IsNotExist(err) {
+		t.Fatalf("wrong error for missing directory: %v", err)
+	}
+}
@@ -55,6 +55,46 @@ func MustRunSuite(host *Simulation, suite Suite) {
 	}
 }
 
+// RunningSuite is a test suite started by Simulation.Run.
+type RunningSuite struct {
+	Sim *Simulation
+	ID  SuiteID
+}
+
+// Run starts a test suite and calls fn with it. The suite is always ended when Run
+// returns. If fn panics, the panic is recovered and returned as an error.
+//
+//	err := sim.Run("sync", "tests block sync", func(s *hivesim.RunningSuite) error {
+//		return s.RunTest("full sync", "", func(t *hivesim.T) { ... })
+//	})
+func (sim *Simulation) Run(name, description string, fn func(*RunningSuite) error) (err error) {
+	logfile := os.Getenv("HIVE_SIMLOG")
+	suiteID, err := sim.StartSuite(name, description, logfile)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if endErr := sim.EndSuite(suiteID); err == nil {
+			err = endErr
+		}
+	}()
+	defer func() {
+		if r := recover(); r != nil {
+			buf := make([]byte, 4096)
+			i := runtime.Stack(buf, false)
+			err = fmt.Errorf("panic in suite %q: %v\n\n%s", name, r, buf[:i])
+		}
+	}()
+	return fn(&RunningSuite{Sim: sim, ID: suiteID})
+}
+
+// RunTest runs a test in the suite. The test is always ended when RunTest returns. A
+// panic in fn is recovered and fails the test. The returned error is non-nil only if
+// the test could not be reported to hive.
+func (s *RunningSuite) RunTest(name, description string, fn func(*T)) error {
+	return runTest(s.Sim, s.ID, name, description, nil, fn)
+}
+
 // TestSpec is the description of a test.
 //
 // Using this test type doesn't launch any clients by default. To interact with clients,
@@ -70,6 +110,7 @@ func MustRunSuite(host *Simulation, suite Suite) {
 type TestSpec struct {
 	Name        string
 	Description string
+	Labels      map[string]string // stored with the test result, e.g. {"category": "smoke"}
 	Run         func(*T)
 }
 
@@ -84,6 +125,7 @@ type ClientTestSpec struct {
 	Name        string
 	Role        string
 	Description string
+	Labels      map[string]string // stored with the test result, e.g. {"category": "smoke"}
 	Parameters  Params
 	Files       map[string]string
 	Run         func(*T, *Client)
@@ -110,7 +152,7 @@ func (c *Client) RPC() *rpc.Client {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	if c.rpc == nil {
-		c.rpc, _ = rpc.DialHTTP(fmt.Sprintf("http://%v:8545", c.IP))
+		c.rpc, _ = rpc.DialHTTP(fmt.Sprintf("http://%v:%d", c.IP, DefaultRPCPort))
 	}
 	return c.rpc
 }
@@ -142,10 +184,20 @@ func (t *T) StartClient(clientType string, option ...StartOption) *Client {
 	return &Client{Type: clientType, Container: container, IP: ip, test: t}
 }
 
+// OutputDir returns the output directory of the test. Files written to it are attached
+// to the test result. If the directory is not available, the test fails immediately.
+func (t *T) OutputDir() string {
+	dir, err := t.Sim.TestOutputDir(t.SuiteID, t.TestID)
+	if err != nil {
+		t.Fatalf("can't get test output directory: %v", err)
+	}
+	return dir
+}
+
 // RunClient runs the given client test against a single client type.
 // It waits for the subtest to complete.
 func (t *T) RunClient(clientType string, spec ClientTestSpec) {
-	runTest(t.Sim, t.SuiteID, spec.Name, spec.Description, func(t *T) {
+	runTest(t.Sim, t.SuiteID, spec.Name, spec.Description, spec.Labels, func(t *T) {
 		client := t.StartClient(clientType, spec.Parameters, WithStaticFiles(spec.Files))
 		spec.Run(t, client)
 	})
@@ -161,7 +213,7 @@ func (t *T) RunAllClients(spec ClientTestSpec) {
 // It is safe to call this from multiple goroutines concurrently, just be sure to wait for
 // all your tests to finish until returning from the parent test.
 func (t *T) Run(spec TestSpec) {
-	runTest(t.Sim, t.SuiteID, spec.Name, spec.Description, spec.Run)
+	runTest(t.Sim, t.SuiteID, spec.Name, spec.Description, spec.Labels, spec.Run)
 }
 
 // Error is like testing.T.Error.
@@ -228,13 +280,13 @@ func (t *T) FailNow() {
 	runtime.Goexit()
 }
 
-func runTest(host *Simulation, s SuiteID, name, desc string, runit func(t *T)) error {
+func runTest(host *Simulation, s SuiteID, name, desc string, labels map[string]string, runit func(t *T)) error {
 	// Register test on simulation server and initialize the T.
 	t := &T{
 		Sim:     host,
 		SuiteID: s,
 	}
-	testID, err := host.StartTest(s, name, desc)
+	testID, err := host.StartTestWithOptions(s, name, desc, labels)
 	if err != nil {
 		return err
 	}
@@ -276,7 +328,7 @@ func (spec ClientTestSpec) runTest(host *Simulation, suite SuiteID) error {
 			continue
 		}
 		name := clientTestName(spec.Name, clientDef.Name)
-		err := runTest(host, suite, name, spec.Description, func(t *T) {
+		err := runTest(host, suite, name, spec.Description, spec.Labels, func(t *T) {
 			client := t.StartClient(clientDef.Name, spec.Parameters, WithStaticFiles(spec.Files))
 			spec.Run(t, client)
 		})
@@ -299,5 +351,5 @@ func clientTestName(name, clientType string) string {
 }
 
 func (spec TestSpec) runTest(host *Simulation, suite SuiteID) error {
-	return runTest(host, suite, spec.Name, spec.Description, spec.Run)
+	return runTest(host, suite, spec.Name, spec.Description, spec.Labels, spec.Run)
 }
@@ -2,6 +2,7 @@ package hivesim
 
 import (
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -18,6 +19,7 @@ func TestSuiteReporting(t *testing.T) {
 	suite.Add(TestSpec{
 		Name:        "passing test",
 		Description: "this test passes",
+		Labels:      map[string]string{"category": "smoke"},
 		Run: func(t *T) {
 			t.Log("message from the passing test")
 		},
@@ -52,6 +54,7 @@ func TestSuiteReporting(t *testing.T) {
 				1: {
 					Name:        "passing test",
 					Description: "this test passes",
+					Labels:      map[string]string{"category": "smoke"},
 					SummaryResult: libhive.TestResult{
 						Pass:    true,
 						Details: "message from the passing test\n",
@@ -83,3 +86,43 @@ func removeTimestamps(result map[libhive.TestSuiteID]*libhive.TestSuite) {
 		}
 	}
 }
+
+// This test checks that Simulation.Run ends the suite when the callback panics.
+func TestSimulationRun(t *testing.T) {
+	tm, srv := newFakeAPI(nil)
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	err := sim.Run("suite", "run test", func(s *RunningSuite) error {
+		err := s.RunTest("panicking test", "", func(t *T) {
+			panic("boom")
+		})
+		if err != nil {
+			return err
+		}
+		panic("suite boom")
+	})
+	if err == nil || !strings.Contains(err.Error(), `panic in suite "suite": suite boom`) {
+		t.Fatalf("wrong error from Run: %v", err)
+	}
+
+	// The suite must be ended by Run.
+	results := tm.Results()
+	if len(results) != 1 {
+		t.Fatalf("wrong number of ended suites: %d", len(results))
+	}
+	for _, suite := range results {
+		if len(suite.TestCases) != 1 {
+			t.Fatalf("wrong number of test cases: %d", len(suite.TestCases))
+		}
+		for _, test := range suite.TestCases {
+			if test.SummaryResult.Pass {
+				t.Fatal("panicking test passed")
+			}
+			if !strings.Contains(test.SummaryResult.Details, "panic: boom") {
+				t.Fatalf("panic not reported in test details: %q", test.SummaryResult.Details)
+			}
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package hivesim
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// uploadChunkSize is the size of the chunks sent by Upload.
+const uploadChunkSize = 8 << 20
+
+// Upload sends a file to hive in fixed-size chunks and returns the ID of the upload.
+// This is meant for very large TAR archives, e.g. multi-gigabyte chain data, which can
+// be added to clients using WithUploadedTAR.
+//
+// When sending a chunk fails with a transient error, Upload asks hive how much data it
+// has received and continues from there. Chunks are retried according to the retry
+// policy set by SetRetryPolicy. If the upload fails after it was created, the upload ID
+// is returned along with the error, and the upload can be continued using ResumeUpload.
+//
+// Uploads are removed when the test suite ends, or by calling RemoveUpload.
+func (sim *Simulation) Upload(testSuite SuiteID, r io.ReaderAt, size int64) (string, error) {
+	return sim.UploadContext(context.Background(), testSuite, r, size)
+}
+
+// UploadContext is like Upload, but the request can be cancelled using ctx.
+func (sim *Simulation) UploadContext(ctx context.Context, testSuite SuiteID, r io.ReaderAt, size int64) (string, error) {
+	if size < 0 {
+		return "", fmt.Errorf("invalid upload size %d", size)
+	}
+	id, err := sim.requestOnce(ctx, http.MethodPost, sim.endpoint("/testsuite/%d/upload", testSuite))
+	if err != nil {
+		return "", err
+	}
+	return id, sim.ResumeUploadContext(ctx, testSuite, id, r, size)
+}
+
+// ResumeUpload continues an upload created by Upload. The content of r must be the same
+// as in the original call. Data which was already received by hive is not sent again.
+func (sim *Simulation) ResumeUpload(testSuite SuiteID, uploadID string, r io.ReaderAt, size int64) error {
+	return sim.ResumeUploadContext(context.Background(), testSuite, uploadID, r, size)
+}
+
+// ResumeUploadContext is like ResumeUpload, but the request can be cancelled using ctx.
+func (sim *Simulation) ResumeUploadContext(ctx context.Context, testSuite SuiteID, uploadID string, r io.ReaderAt, size int64) error {
+	endpoint := sim.endpoint("/testsuite/%d/upload/%s", testSuite, uploadID)
+	offset, err := sim.uploadSize(ctx, endpoint)
+	if err != nil {
+		return err
+	}
+	for offset < size {
+		var resync bool
+		err := sim.withRetry(ctx, func() error {
+			if resync {
+				// Part of the previous chunk may have been received.
+				received, err := sim.uploadSize(ctx, endpoint)
+				if err != nil {
+					return err
+				}
+				offset = received
+				if offset >= size {
+					return nil
+				}
+			}
+			n := size - offset
+			if n > uploadChunkSize {
+				n = uploadChunkSize
+			}
+			received, err := sim.appendUpload(ctx, endpoint, offset, io.NewSectionReader(r, offset, n))
+			if err != nil {
+				resync = true
+				return err
+			}
+			offset = received
+			return nil
+		})
+		var httpErr *HTTPError
+		if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusConflict {
+			// The offset doesn't match, continue at the size known to hive.
+			if offset, err = sim.uploadSize(ctx, endpoint); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if offset != size {
+		return fmt.Errorf("upload %s has %d bytes, expected %d", uploadID, offset, size)
+	}
+	return nil
+}
+
+// RemoveUpload deletes an upload.
+func (sim *Simulation) RemoveUpload(testSuite SuiteID, uploadID string) error {
+	return sim.RemoveUploadContext(context.Background(), testSuite, uploadID)
+}
+
+// RemoveUploadContext is like RemoveUpload, but the request can be cancelled using ctx.
+func (sim *Simulation) RemoveUploadContext(ctx context.Context, testSuite SuiteID, uploadID string) error {
+	_, err := sim.request(ctx, http.MethodDelete, sim.endpoint("/testsuite/%d/upload/%s", testSuite, uploadID))
+	return err
+}
+
+// uploadSize returns the number of bytes hive has received for an upload.
+func (sim *Simulation) uploadSize(ctx context.Context, endpoint string) (int64, error) {
+	resp, err := sim.request(ctx, http.MethodGet, endpoint)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(resp), 10, 64)
+}
+
+// appendUpload sends a chunk of an upload and returns the number of bytes received.
+func (sim *Simulation) appendUpload(ctx context.Context, endpoint string, offset int64, chunk *io.SectionReader) (int64, error) {
+	url := endpoint + "?offset=" + strconv.FormatInt(offset, 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, url, chunk)
+	if err != nil {
+		return 0, err
+	}
+	req.ContentLength = chunk.Size()
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := sim.do(req)
+	if err != nil {
+		return 0, requestError(ctx, err)
+	}
+	body, err := readResponse(resp)
+	if err != nil {
+		return 0, requestError(ctx, err)
+	}
+	return strconv.ParseInt(strings.TrimSpace(body), 10, 64)
+}
@@ -0,0 +1,122 @@
+package hivesim
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ethereum/hive/internal/fakes"
+	"github.com/ethereum/hive/internal/libhive"
+)
+
+// This test checks that an upload continues after a chunk was partially received,
+// and that the uploaded archive is extracted into the client.
+func TestUploadResume(t *testing.T) {
+	var extracted []byte
+	hooks := &fakes.BackendHooks{
+		UploadArchive: func(containerID, dir string, archive io.Reader) error {
+			data, err := ioutil.ReadAll(archive)
+			extracted = data
+			return err
+		},
+	}
+	tm, srv := newFakeAPI(hooks)
+	defer srv.Close()
+	defer tm.Terminate()
+
+	// This server receives only half of the second chunk and fails the request.
+	var puts int
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			puts++
+			if puts == 2 {
+				r.Body = ioutil.NopCloser(io.LimitReader(r.Body, uploadChunkSize/2))
+				srv.Config.Handler.ServeHTTP(httptest.NewRecorder(), r)
+				http.Error(w, "connection lost", http.StatusBadGateway)
+				return
+			}
+		}
+		srv.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer flaky.Close()
+
+	sim := NewAt(flaky.URL)
+	sim.SetRetryPolicy(3, time.Millisecond)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+	testID, err := sim.StartTest(suiteID, "test", "")
+	if err != nil {
+		t.Fatal("can't start test:", err)
+	}
+
+	data := make([]byte, 2*uploadChunkSize+1000)
+	rand.New(rand.NewSource(1)).Read(data)
+	id, err := sim.Upload(suiteID, bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal("upload failed:", err)
+	}
+	// The third request sends the rest of the data after the received half chunk.
+	if puts != 3 {
+		t.Errorf("wrong number of chunk requests: %d", puts)
+	}
+
+	if _, _, err := sim.StartClientWithOptions(suiteID, testID, "client-1", WithUploadedTAR(id)); err != nil {
+		t.Fatal("can't start client:", err)
+	}
+	if !bytes.Equal(extracted, data) {
+		t.Fatalf("wrong extracted data (%d bytes, want %d)", len(extracted), len(data))
+	}
+
+	// Removed uploads can't be used.
+	if err := sim.RemoveUpload(suiteID, id); err != nil {
+		t.Fatal("can't remove upload:", err)
+	}
+	if _, _, err := sim.StartClientWithOptions(suiteID, testID, "client-1", WithUploadedTAR(id)); err == nil {
+		t.Fatal("expected error for removed upload")
+	}
+}
+
+// This test checks that ResumeUpload only sends the missing data.
+func TestResumeUpload(t *testing.T) {
+	tm, srv := newFakeAPI(nil)
+	defer srv.Close()
+	defer tm.Terminate()
+
+	sim := NewAt(srv.URL)
+	suiteID, err := sim.StartSuite("suite", "", "")
+	if err != nil {
+		t.Fatal("can't start suite:", err)
+	}
+
+	data := []byte("0123456789")
+	id, err := sim.Upload(suiteID, bytes.NewReader(data[:4]), 4)
+	if err != nil {
+		t.Fatal("upload failed:", err)
+	}
+	if err := sim.ResumeUpload(suiteID, id, bytes.NewReader(data), int64(len(data))); err != nil {
+		t.Fatal("resume failed:", err)
+	}
+	size, err := tm.UploadSize(libhive.TestSuiteID(suiteID), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != int64(len(data)) {
+		t.Fatalf("wrong upload size %d", size)
+	}
+	r, err := tm.OpenUpload(libhive.TestSuiteID(suiteID), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	content, _ := ioutil.ReadAll(r)
+	if !bytes.Equal(content, data) {
+		t.Fatalf("wrong upload content %q", content)
+	}
+}
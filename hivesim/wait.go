@@ -0,0 +1,168 @@
+package hivesim
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// These are the bounds of the delay between connection attempts in WaitForClientPort
+// and WaitForClientHTTP.
+const (
+	waitMinDelay = 50 * time.Millisecond
+	waitMaxDelay = time.Second
+)
+
+// WaitForClientPort waits until the given TCP port of a client accepts connections. It
+// returns an error wrapping ctx.Err() if the port does not become reachable before ctx
+// is done.
+func (sim *Simulation) WaitForClientPort(ctx context.Context, ip net.IP, port int) error {
+	addr := net.JoinHostPort(ip.String(), strconv.Itoa(port))
+	return waitFor(ctx, func() error {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		conn.Close()
+		return nil
+	})
+}
+
+// WaitForClientHTTP waits until a GET request to the given URL returns status 200 OK.
+// This can be used to wait for a health check endpoint of a client. It returns an error
+// wrapping ctx.Err() if the client is not healthy before ctx is done.
+func (sim *Simulation) WaitForClientHTTP(ctx context.Context, url string) error {
+	return waitFor(ctx, func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("status %s", resp.Status)
+		}
+		return nil
+	})
+}
+
+// WaitForEnode waits until the client reports its enode URL, and returns the node.
+// It returns an error wrapping ctx.Err() if the client does not report an enode URL
+// before ctx is done.
+func (sim *Simulation) WaitForEnode(ctx context.Context, testSuite SuiteID, test TestID, node string) (*enode.Node, error) {
+	var n *enode.Node
+	err := waitFor(ctx, func() (err error) {
+		n, err = sim.ClientEnodeContext(ctx, testSuite, test, node)
+		return err
+	})
+	return n, err
+}
+
+// WaitForLog waits until a line of the client output contains substring. The whole
+// output is searched, including lines written before the call. It returns an error
+// wrapping ctx.Err() if no matching line appears before ctx is done, and an error if the
+// client exits without writing a matching line.
+func (sim *Simulation) WaitForLog(ctx context.Context, testSuite SuiteID, test TestID, nodeid, substring string) error {
+	return sim.waitForLog(ctx, testSuite, test, nodeid, fmt.Sprintf("%q", substring), func(line string) bool {
+		return strings.Contains(line, substring)
+	})
+}
+
+// WaitForLogRegexp is like WaitForLog, but waits for a line matching re.
+func (sim *Simulation) WaitForLogRegexp(ctx context.Context, testSuite SuiteID, test TestID, nodeid string, re *regexp.Regexp) error {
+	return sim.waitForLog(ctx, testSuite, test, nodeid, fmt.Sprintf("/%v/", re), re.MatchString)
+}
+
+// maxLogLine is the maximum length of a log line searched by WaitForLog.
+const maxLogLine = 1024 * 1024
+
+func (sim *Simulation) waitForLog(ctx context.Context, testSuite SuiteID, test TestID, nodeid, what string, match func(string) bool) error {
+	logs, err := sim.ClientLogsWithOptionsContext(ctx, testSuite, test, nodeid, LogsOptions{Follow: true})
+	if err != nil {
+		return err
+	}
+	defer logs.Close()
+
+	scanner := bufio.NewScanner(logs)
+	scanner.Buffer(make([]byte, 4096), maxLogLine)
+	for scanner.Scan() {
+		if match(scanner.Text()) {
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return requestError(ctx, fmt.Errorf("can't read client output: %v", err))
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("no line matching %s in client output: %w", what, ctx.Err())
+	}
+	return fmt.Errorf("client output ended without line matching %s", what)
+}
+
+// WatchClient checks the state of a client periodically and sends an event on the
+// returned channel when the client exits. If the state can't be checked, e.g. because
+// the client was stopped by the simulation or the test has ended, the event contains
+// the error. The channel is closed after sending the event, or when ctx is done.
+func (sim *Simulation) WatchClient(ctx context.Context, testSuite SuiteID, test TestID, nodeid string) <-chan ExitEvent {
+	ch := make(chan ExitEvent, 1)
+	go func() {
+		defer close(ch)
+		var ev ExitEvent
+		err := waitFor(ctx, func() error {
+			alive, exitCode, err := sim.ClientIsAliveContext(ctx, testSuite, test, nodeid)
+			switch {
+			case err != nil:
+				return err
+			case alive:
+				return errClientAlive
+			}
+			ev.ExitCode = exitCode
+			return nil
+		})
+		if err != nil && ctx.Err() != nil {
+			return
+		}
+		ev.Err = err
+		ch <- ev
+	}()
+	return ch
+}
+
+var errClientAlive = errors.New("client is alive")
+
+// waitFor calls check until it succeeds, with increasing delay between attempts.
+// Errors with a 4xx status code, e.g. for unknown clients, are returned immediately.
+func waitFor(ctx context.Context, check func() error) error {
+	delay := waitMinDelay
+	for {
+		err := check()
+		if err == nil {
+			return nil
+		}
+		var httpErr *HTTPError
+		if errors.As(err, &httpErr) && httpErr.StatusCode >= 400 && httpErr.StatusCode < 500 {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%v: %w", err, ctx.Err())
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > waitMaxDelay {
+			delay = waitMaxDelay
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package hivesim
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWaitForClientPort(t *testing.T) {
+	// Reserve a port, then close the listener so the port is unreachable.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().(*net.TCPAddr)
+	l.Close()
+
+	sim := NewAt("http://127.0.0.1:0")
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if err := sim.WaitForClientPort(ctx, addr.IP, addr.Port); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("wrong error for unreachable port: %v", err)
+	}
+
+	// Start listening after a short delay.
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		l, err := net.Listen("tcp", addr.String())
+		if err != nil {
+			return
+		}
+		defer l.Close()
+		if conn, err := l.Accept(); err == nil {
+			conn.Close()
+		}
+	}()
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := sim.WaitForClientPort(ctx, addr.IP, addr.Port); err != nil {
+		t.Fatal("wait failed:", err)
+	}
+}
+
+func TestWaitForClientHTTP(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	sim := NewAt("http://127.0.0.1:0")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := sim.WaitForClientHTTP(ctx, srv.URL+"/health"); err != nil {
+		t.Fatal("wait failed:", err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 3 {
+		t.Fatalf("%d requests sent, want 3", n)
+	}
+}
+
+func TestWaitForLog(t *testing.T) {
+	// The server streams some lines, then keeps the stream open like a running client,
+	// unless the 'exited' query parameter is set.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("follow") != "1" {
+			http.Error(w, "not following", http.StatusBadRequest)
+			return
+		}
+		io.WriteString(w, "INFO starting\nINFO HTTP server started port=8545\n")
+		w.(http.Flusher).Flush()
+		if !strings.Contains(r.URL.Path, "exited") {
+			<-r.Context().Done()
+		}
+	}))
+	defer srv.Close()
+	sim := NewAt(srv.URL)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := sim.WaitForLog(ctx, 1, 2, "running", "HTTP server started"); err != nil {
+		t.Fatal("WaitForLog failed:", err)
+	}
+	if err := sim.WaitForLogRegexp(ctx, 1, 2, "running", regexp.MustCompile(`port=\d+`)); err != nil {
+		t.Fatal("WaitForLogRegexp failed:", err)
+	}
+
+	// Missing line in running client.
+	shortCtx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := sim.WaitForLog(shortCtx, 1, 2, "running", "IPC endpoint opened"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("wrong error for missing line: %v", err)
+	}
+
+	// Missing line in exited client.
+	err := sim.WaitForLog(ctx, 1, 2, "exited", "IPC endpoint opened")
+	if err == nil || errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("wrong error for exited client: %v", err)
+	}
+}
@@ -4,25 +4,43 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net"
+	"sync/atomic"
 
 	"github.com/ethereum/hive/internal/libhive"
 )
 
 // BackendHooks can be used to override the behavior of the fake backend.
 type BackendHooks struct {
-	CreateContainer func(image string, opt libhive.ContainerOptions) (string, error)
-	StartContainer  func(containerID string, opt libhive.ContainerOptions) (*libhive.ContainerInfo, error)
-	DeleteContainer func(containerID string) error
-	RunEnodeSh      func(containerID string) (string, error)
-	RunProgram      func(containerID string, cmd []string) (*libhive.ExecInfo, error)
+	CreateContainer  func(image string, opt libhive.ContainerOptions) (string, error)
+	StartContainer   func(containerID string, opt libhive.ContainerOptions) (*libhive.ContainerInfo, error)
+	DeleteContainer  func(containerID string) error
+	StopContainer    func(containerID string, opt libhive.StopOptions) error
+	RestartContainer func(containerID string, opt libhive.ContainerOptions) (*libhive.ContainerInfo, error)
+	PauseContainer   func(containerID string) error
+	UnpauseContainer func(containerID string) error
+	SignalContainer  func(containerID string, signal int) error
+	ContainerState   func(containerID string) (*libhive.ContainerState, error)
+	ContainerLogs    func(containerID string, opt libhive.LogsOptions) (string, error)
+	DownloadFiles    func(containerID, path string, w io.Writer) error
+	UploadArchive    func(containerID, dir string, archive io.Reader) error
+	ContainerStats   func(containerID string) ([]*libhive.ContainerStats, error)
+	InspectContainer func(containerID string) ([]byte, error)
+	RunEnodeSh       func(containerID string) (string, error)
+	RunProgram       func(containerID string, opt libhive.ExecOptions) (*libhive.ExecInfo, error)
+	StartProgram     func(containerID string, opt libhive.ExecOptions) (string, error)
+	ProgramStatus    func(containerID, execID string) (*libhive.ProgramStatus, error)
+	KillProgram      func(containerID, execID string) error
 
 	NetworkNameToID     func(string) (string, error)
-	CreateNetwork       func(string) (string, error)
+	CreateNetwork       func(name string, opt libhive.NetworkOptions) (string, error)
 	RemoveNetwork       func(networkID string) error
 	ContainerIP         func(containerID, networkID string) (net.IP, error)
-	ConnectContainer    func(containerID, networkID string) error
+	NetworkIPs          func(networkID string) (map[string]net.IP, error)
+	ConnectContainer    func(containerID, networkID string, aliases []string) error
 	DisconnectContainer func(containerID, networkID string) error
+	ShapeContainer      func(containerID, networkID string, opt libhive.NetworkShaping) error
 }
 
 var _ = libhive.ContainerBackend(&fakeBackend{})
@@ -32,6 +50,7 @@ type fakeBackend struct {
 	hooks         BackendHooks
 	clientCounter uint64
 	netCounter    uint64
+	execCounter   uint64
 }
 
 // NewBackend creates a new fake container backend.
@@ -47,8 +66,7 @@ func (b *fakeBackend) CreateContainer(ctx context.Context, image string, opt lib
 	if b.hooks.CreateContainer != nil {
 		return b.hooks.CreateContainer(image, opt)
 	}
-	b.clientCounter++
-	id := fmt.Sprintf("%0.8x", b.clientCounter)
+	id := fmt.Sprintf("%0.8x", atomic.AddUint64(&b.clientCounter, 1))
 	return id, nil
 }
 
@@ -67,8 +85,8 @@ func (b *fakeBackend) StartContainer(ctx context.Context, containerID string, op
 	}
 
 	info.ID = containerID
-	if info.IP == "" {
-		ip := net.IP{192, 0, 2, byte(b.clientCounter)}
+	if info.IP == "" && !opt.NoDefaultNetwork {
+		ip := net.IP{192, 0, 2, byte(atomic.LoadUint64(&b.clientCounter))}
 		info.IP = ip.String()
 	}
 	if info.MAC == "" {
@@ -85,6 +103,102 @@ func (b *fakeBackend) DeleteContainer(containerID string) error {
 	return nil
 }
 
+func (b *fakeBackend) StopContainer(ctx context.Context, containerID string, opt libhive.StopOptions) error {
+	if b.hooks.StopContainer != nil {
+		return b.hooks.StopContainer(containerID, opt)
+	}
+	return nil
+}
+
+func (b *fakeBackend) RestartContainer(ctx context.Context, containerID string, opt libhive.ContainerOptions) (*libhive.ContainerInfo, error) {
+	if b.hooks.RestartContainer != nil {
+		info, err := b.hooks.RestartContainer(containerID, opt)
+		if info != nil && info.Wait == nil {
+			info.Wait = func() {}
+		}
+		return info, err
+	}
+	return b.StartContainer(ctx, containerID, opt)
+}
+
+func (b *fakeBackend) PauseContainer(containerID string) error {
+	if b.hooks.PauseContainer != nil {
+		return b.hooks.PauseContainer(containerID)
+	}
+	return nil
+}
+
+func (b *fakeBackend) SignalContainer(ctx context.Context, containerID string, signal int) error {
+	if b.hooks.SignalContainer != nil {
+		return b.hooks.SignalContainer(containerID, signal)
+	}
+	return nil
+}
+
+func (b *fakeBackend) ContainerState(ctx context.Context, containerID string) (*libhive.ContainerState, error) {
+	if b.hooks.ContainerState != nil {
+		return b.hooks.ContainerState(containerID)
+	}
+	return &libhive.ContainerState{Running: true}, nil
+}
+
+func (b *fakeBackend) UnpauseContainer(containerID string) error {
+	if b.hooks.UnpauseContainer != nil {
+		return b.hooks.UnpauseContainer(containerID)
+	}
+	return nil
+}
+
+func (b *fakeBackend) ContainerLogs(ctx context.Context, containerID string, opt libhive.LogsOptions, w io.Writer) error {
+	output := "client output\n"
+	if b.hooks.ContainerLogs != nil {
+		var err error
+		if output, err = b.hooks.ContainerLogs(containerID, opt); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, output)
+	return err
+}
+
+func (b *fakeBackend) DownloadFiles(ctx context.Context, containerID, path string, w io.Writer) error {
+	if b.hooks.DownloadFiles != nil {
+		return b.hooks.DownloadFiles(containerID, path, w)
+	}
+	return errors.New("no such file")
+}
+
+func (b *fakeBackend) UploadArchive(ctx context.Context, containerID, dir string, archive io.Reader) error {
+	if b.hooks.UploadArchive != nil {
+		return b.hooks.UploadArchive(containerID, dir, archive)
+	}
+	return nil
+}
+
+func (b *fakeBackend) ContainerStats(ctx context.Context, containerID string, stream bool, fn func(*libhive.ContainerStats)) error {
+	samples := []*libhive.ContainerStats{{MemoryUsage: 1 << 20, MemoryLimit: 1 << 30}}
+	if b.hooks.ContainerStats != nil {
+		var err error
+		if samples, err = b.hooks.ContainerStats(containerID); err != nil {
+			return err
+		}
+	}
+	if !stream && len(samples) > 1 {
+		samples = samples[:1]
+	}
+	for _, s := range samples {
+		fn(s)
+	}
+	return nil
+}
+
+func (b *fakeBackend) InspectContainer(ctx context.Context, containerID string) ([]byte, error) {
+	if b.hooks.InspectContainer != nil {
+		return b.hooks.InspectContainer(containerID)
+	}
+	return []byte(fmt.Sprintf(`{"Id":%q}`, containerID)), nil
+}
+
 func (b *fakeBackend) RunEnodeSh(ctx context.Context, containerID string) (string, error) {
 	if b.hooks.RunEnodeSh != nil {
 		return b.hooks.RunEnodeSh(containerID)
@@ -92,11 +206,46 @@ func (b *fakeBackend) RunEnodeSh(ctx context.Context, containerID string) (strin
 	return "enode://a61215641fb8714a373c80edbfa0ea8878243193f57c96eeb44d0bc019ef295abd4e044fd619bfc4c59731a73fb79afe84e9ab6da0c743ceb479cbb6d263fa91@192.0.2.1:30303", nil
 }
 
-func (b *fakeBackend) RunProgram(ctx context.Context, containerID string, cmd []string) (*libhive.ExecInfo, error) {
+func (b *fakeBackend) RunProgram(ctx context.Context, containerID string, opt libhive.ExecOptions) (int, error) {
+	var (
+		info = &libhive.ExecInfo{Stdout: "std output", Stderr: "std err", ExitCode: 0}
+		err  error
+	)
 	if b.hooks.RunProgram != nil {
-		return b.hooks.RunProgram(containerID, cmd)
+		// The hook may return output along with an error, e.g. for timeouts.
+		if info, err = b.hooks.RunProgram(containerID, opt); info == nil {
+			return 0, err
+		}
 	}
-	return &libhive.ExecInfo{Stdout: "std output", Stderr: "std err", ExitCode: 0}, nil
+	if opt.Stdout != nil {
+		io.WriteString(opt.Stdout, info.Stdout)
+	}
+	if opt.Stderr != nil {
+		io.WriteString(opt.Stderr, info.Stderr)
+	}
+	return info.ExitCode, err
+}
+
+func (b *fakeBackend) StartProgram(ctx context.Context, containerID string, opt libhive.ExecOptions) (string, error) {
+	if b.hooks.StartProgram != nil {
+		return b.hooks.StartProgram(containerID, opt)
+	}
+	id := fmt.Sprintf("exec-%d", atomic.AddUint64(&b.execCounter, 1))
+	return id, nil
+}
+
+func (b *fakeBackend) ProgramStatus(ctx context.Context, containerID, execID string) (*libhive.ProgramStatus, error) {
+	if b.hooks.ProgramStatus != nil {
+		return b.hooks.ProgramStatus(containerID, execID)
+	}
+	return &libhive.ProgramStatus{Running: false, ExitCode: 0}, nil
+}
+
+func (b *fakeBackend) KillProgram(ctx context.Context, containerID, execID string) error {
+	if b.hooks.KillProgram != nil {
+		return b.hooks.KillProgram(containerID, execID)
+	}
+	return nil
 }
 
 func (b *fakeBackend) NetworkNameToID(name string) (string, error) {
@@ -106,12 +255,11 @@ func (b *fakeBackend) NetworkNameToID(name string) (string, error) {
 	return "", errors.New("network not found")
 }
 
-func (b *fakeBackend) CreateNetwork(name string) (string, error) {
+func (b *fakeBackend) CreateNetwork(name string, opt libhive.NetworkOptions) (string, error) {
 	if b.hooks.CreateNetwork != nil {
-		return b.hooks.CreateNetwork(name)
+		return b.hooks.CreateNetwork(name, opt)
 	}
-	b.netCounter++
-	id := fmt.Sprintf("%0.8x", b.netCounter)
+	id := fmt.Sprintf("%0.8x", atomic.AddUint64(&b.netCounter, 1))
 	return id, nil
 }
 
@@ -129,9 +277,16 @@ func (b *fakeBackend) ContainerIP(containerID, networkID string) (net.IP, error)
 	return net.IP{203, 0, 113, 2}, nil
 }
 
-func (b *fakeBackend) ConnectContainer(containerID, networkID string) error {
+func (b *fakeBackend) NetworkIPs(networkID string) (map[string]net.IP, error) {
+	if b.hooks.NetworkIPs != nil {
+		return b.hooks.NetworkIPs(networkID)
+	}
+	return make(map[string]net.IP), nil
+}
+
+func (b *fakeBackend) ConnectContainer(containerID, networkID string, aliases ...string) error {
 	if b.hooks.ConnectContainer != nil {
-		return b.hooks.ConnectContainer(containerID, networkID)
+		return b.hooks.ConnectContainer(containerID, networkID, aliases)
 	}
 	return nil
 }
@@ -142,3 +297,10 @@ func (b *fakeBackend) DisconnectContainer(containerID, networkID string) error {
 	}
 	return nil
 }
+
+func (b *fakeBackend) ShapeContainer(ctx context.Context, containerID, networkID string, opt libhive.NetworkShaping) error {
+	if b.hooks.ShapeContainer != nil {
+		return b.hooks.ShapeContainer(containerID, networkID, opt)
+	}
+	return nil
+}
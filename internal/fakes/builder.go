@@ -0,0 +1,72 @@
+package fakes
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/hive/internal/libhive"
+)
+
+// BuilderHooks can be used to override the behavior of the fake builder.
+type BuilderHooks struct {
+	BuildClientImage         func(name string) (string, error)
+	BuildClientImageWithArgs func(name string, args map[string]string) (string, error)
+	PullImage                func(ref string) error
+}
+
+var _ = libhive.Builder(&fakeBuilder{})
+
+// fakeBuilder implements Builder without docker.
+type fakeBuilder struct {
+	hooks BuilderHooks
+}
+
+// NewBuilder creates a new fake image builder.
+func NewBuilder(hooks *BuilderHooks) libhive.Builder {
+	b := &fakeBuilder{}
+	if hooks != nil {
+		b.hooks = *hooks
+	}
+	return b
+}
+
+func (b *fakeBuilder) ReadClientMetadata(name string) (*libhive.ClientMetadata, error) {
+	return &libhive.ClientMetadata{Roles: []string{"eth1"}}, nil
+}
+
+func (b *fakeBuilder) BuildClientImage(ctx context.Context, name string) (string, error) {
+	if b.hooks.BuildClientImage != nil {
+		return b.hooks.BuildClientImage(name)
+	}
+	return fmt.Sprintf("hive/clients/%s:latest", name), nil
+}
+
+func (b *fakeBuilder) BuildClientImageWithArgs(ctx context.Context, name string, args map[string]string) (string, error) {
+	if b.hooks.BuildClientImageWithArgs != nil {
+		return b.hooks.BuildClientImageWithArgs(name, args)
+	}
+	var list []string
+	for k, v := range args {
+		list = append(list, k+"="+v)
+	}
+	sort.Strings(list)
+	return fmt.Sprintf("hive/clients/%s:%s", name, strings.Join(list, ",")), nil
+}
+
+func (b *fakeBuilder) PullImage(ctx context.Context, ref string) error {
+	if b.hooks.PullImage != nil {
+		return b.hooks.PullImage(ref)
+	}
+	return nil
+}
+
+func (b *fakeBuilder) BuildSimulatorImage(ctx context.Context, name string) (string, error) {
+	return fmt.Sprintf("hive/simulators/%s:latest", name), nil
+}
+
+func (b *fakeBuilder) ReadFile(image, path string) ([]byte, error) {
+	return nil, os.ErrNotExist
+}
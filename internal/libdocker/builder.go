@@ -4,12 +4,15 @@ import (
 	"archive/tar"
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"gopkg.in/yaml.v2"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 
 	"github.com/ethereum/hive/internal/libhive"
 	docker "github.com/fsouza/go-dockerclient"
@@ -56,15 +59,67 @@ func (b *Builder) BuildClientImage(ctx context.Context, name string) (string, er
 	dir := b.config.Inventory.ClientDirectory(name)
 	_, branch := libhive.SplitClientName(name)
 	tag := fmt.Sprintf("hive/clients/%s:latest", name)
-	err := b.buildImage(ctx, dir, branch, tag)
+	err := b.buildImage(ctx, dir, branch, tag, nil)
 	return tag, err
 }
 
+// BuildClientImageWithArgs builds a docker image of the given client using build
+// arguments. The image tag is derived from the arguments, so builds with the same
+// arguments reuse the cached layers of the previous build.
+func (b *Builder) BuildClientImageWithArgs(ctx context.Context, name string, args map[string]string) (string, error) {
+	dir := b.config.Inventory.ClientDirectory(name)
+	_, branch := libhive.SplitClientName(name)
+	tag := fmt.Sprintf("hive/clients/%s:args-%s", name, buildArgsHash(args))
+	err := b.buildImage(ctx, dir, branch, tag, args)
+	return tag, err
+}
+
+// buildArgsHash returns a short hash identifying a set of build arguments.
+func buildArgsHash(args map[string]string) string {
+	keys := make([]string, 0, len(args))
+	for k := range args {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	h := sha256.New()
+	for _, k := range keys {
+		fmt.Fprintf(h, "%s=%s\n", k, args[k])
+	}
+	return hex.EncodeToString(h.Sum(nil)[:6])
+}
+
+// PullImage pulls the given image reference, unless it is already present.
+func (b *Builder) PullImage(ctx context.Context, ref string) error {
+	_, err := b.client.InspectImage(ref)
+	if err == nil {
+		return nil
+	} else if err != docker.ErrNoSuchImage {
+		return err
+	}
+	logger := b.logger.New("image", ref)
+	repo, tag := docker.ParseRepositoryTag(ref)
+	opts := docker.PullImageOptions{
+		Context:      ctx,
+		Repository:   repo,
+		Tag:          tag,
+		OutputStream: ioutil.Discard,
+	}
+	if b.config.BuildOutput != nil {
+		opts.OutputStream = b.config.BuildOutput
+	}
+	logger.Info("pulling image")
+	if err := b.client.PullImage(opts, docker.AuthConfiguration{}); err != nil {
+		logger.Error("image pull failed", "err", err)
+		return err
+	}
+	return nil
+}
+
 // BuildSimulatorImage builds a docker image of a simulator.
 func (b *Builder) BuildSimulatorImage(ctx context.Context, name string) (string, error) {
 	dir := b.config.Inventory.SimulatorDirectory(name)
 	tag := fmt.Sprintf("hive/simulators/%s:latest", name)
-	err := b.buildImage(ctx, dir, "", tag)
+	err := b.buildImage(ctx, dir, "", tag, nil)
 	return tag, err
 }
 
@@ -110,7 +165,8 @@ func (b *Builder) ReadFile(image, path string) ([]byte, error) {
 
 // buildImage builds a single docker image from the specified context.
 // branch specifes a build argument to use a specific base image branch or github source branch.
-func (b *Builder) buildImage(ctx context.Context, contextDir, branch, imageTag string) error {
+// args are additional build arguments, which take precedence over branch.
+func (b *Builder) buildImage(ctx context.Context, contextDir, branch, imageTag string, args map[string]string) error {
 	nocache := false
 	if b.config.NoCachePattern != nil {
 		nocache = b.config.NoCachePattern.MatchString(imageTag)
@@ -135,10 +191,21 @@ func (b *Builder) buildImage(ctx context.Context, contextDir, branch, imageTag s
 		opts.OutputStream = b.config.BuildOutput
 	}
 	logctx := []interface{}{"dir", contextDir, "nocache", opts.NoCache, "pull", opts.Pull}
-	if branch != "" {
+	if branch != "" && args["branch"] == "" {
 		logctx = append(logctx, "branch", branch)
 		opts.BuildArgs = []docker.BuildArg{{Name: "branch", Value: branch}}
 	}
+	if len(args) > 0 {
+		names := make([]string, 0, len(args))
+		for name := range args {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			opts.BuildArgs = append(opts.BuildArgs, docker.BuildArg{Name: name, Value: args[name]})
+		}
+		logctx = append(logctx, "args", args)
+	}
 
 	logger.Info("building image", logctx...)
 	if err := b.client.BuildImage(opts); err != nil {
@@ -3,7 +3,9 @@ package libdocker
 import (
 	"archive/tar"
 	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -12,6 +14,9 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -34,6 +39,98 @@ func NewContainerBackend(c *docker.Client, cfg *Config) *ContainerBackend {
 	return b
 }
 
+// ContainerLogs writes the output of a container to w.
+func (b *ContainerBackend) ContainerLogs(ctx context.Context, containerID string, opt libhive.LogsOptions, w io.Writer) error {
+	logs := docker.LogsOptions{
+		Context:      ctx,
+		Container:    containerID,
+		OutputStream: w,
+		ErrorStream:  w,
+		Stdout:       true,
+		Stderr:       true,
+		Follow:       opt.Follow,
+	}
+	if !opt.Since.IsZero() {
+		logs.Since = opt.Since.Unix()
+	}
+	return b.client.Logs(logs)
+}
+
+// DownloadFiles writes a TAR archive of a file or directory in the container to w.
+func (b *ContainerBackend) DownloadFiles(ctx context.Context, containerID, path string, w io.Writer) error {
+	return b.client.DownloadFromContainer(containerID, docker.DownloadFromContainerOptions{
+		Context:      ctx,
+		Path:         path,
+		OutputStream: w,
+	})
+}
+
+// UploadArchive extracts a TAR archive into a directory of the container.
+func (b *ContainerBackend) UploadArchive(ctx context.Context, containerID, dir string, archive io.Reader) error {
+	return b.client.UploadToContainer(containerID, docker.UploadToContainerOptions{
+		Context:     ctx,
+		InputStream: archive,
+		Path:        dir,
+	})
+}
+
+// ContainerStats samples the resource usage of a container.
+func (b *ContainerBackend) ContainerStats(ctx context.Context, containerID string, stream bool, fn func(*libhive.ContainerStats)) error {
+	var (
+		samples = make(chan *docker.Stats)
+		errc    = make(chan error, 1)
+	)
+	go func() {
+		// Stats closes the samples channel when it returns.
+		errc <- b.client.Stats(docker.StatsOptions{
+			Context: ctx,
+			ID:      containerID,
+			Stats:   samples,
+			Stream:  stream,
+		})
+	}()
+	for s := range samples {
+		fn(convertStats(s))
+	}
+	return <-errc
+}
+
+// convertStats computes resource usage from docker stats. The CPU percentage is
+// computed in the same way as by 'docker stats'.
+func convertStats(s *docker.Stats) *libhive.ContainerStats {
+	stats := &libhive.ContainerStats{
+		Time:        s.Read,
+		MemoryUsage: s.MemoryStats.Usage,
+		MemoryLimit: s.MemoryStats.Limit,
+	}
+	cpuDelta := float64(s.CPUStats.CPUUsage.TotalUsage) - float64(s.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(s.CPUStats.SystemCPUUsage) - float64(s.PreCPUStats.SystemCPUUsage)
+	cpus := float64(s.CPUStats.OnlineCPUs)
+	if cpus == 0 {
+		cpus = float64(len(s.CPUStats.CPUUsage.PercpuUsage))
+	}
+	if cpuDelta > 0 && systemDelta > 0 {
+		stats.CPUPercent = cpuDelta / systemDelta * cpus * 100
+	}
+	for _, n := range s.Networks {
+		stats.NetworkRxBytes += n.RxBytes
+		stats.NetworkTxBytes += n.TxBytes
+	}
+	return stats
+}
+
+// InspectContainer returns the docker inspect output of a container as JSON.
+func (b *ContainerBackend) InspectContainer(ctx context.Context, containerID string) ([]byte, error) {
+	info, err := b.client.InspectContainerWithOptions(docker.InspectContainerOptions{
+		Context: ctx,
+		ID:      containerID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(info)
+}
+
 // RunEnodeSh runs the enode.sh script in a container.
 func (b *ContainerBackend) RunEnodeSh(ctx context.Context, containerID string) (string, error) {
 	exec, err := b.client.CreateExec(docker.CreateExecOptions{
@@ -59,39 +156,164 @@ func (b *ContainerBackend) RunEnodeSh(ctx context.Context, containerID string) (
 	return outputBuf.String(), nil
 }
 
-func (b *ContainerBackend) RunProgram(ctx context.Context, containerID string, cmd []string) (*libhive.ExecInfo, error) {
+// RunProgram runs a command in a container, writing its output to the streams in opt.
+func (b *ContainerBackend) RunProgram(ctx context.Context, containerID string, opt libhive.ExecOptions) (int, error) {
+	// Docker can't kill exec'd processes. When a timeout is set, the command is
+	// started through a shell which records its PID, so it can be killed later.
+	var (
+		cmd     = opt.Cmd
+		execCtx = ctx
+		pidFile string
+	)
+	if opt.Timeout > 0 {
+		var cancel context.CancelFunc
+		execCtx, cancel = context.WithTimeout(ctx, opt.Timeout)
+		defer cancel()
+		pidFile = fmt.Sprintf("/tmp/hive-exec-%d.pid", time.Now().UnixNano())
+		script := fmt.Sprintf(`echo $$ > %s && exec "$@"`, pidFile)
+		cmd = append([]string{"/bin/sh", "-c", script, "sh"}, opt.Cmd...)
+	}
+
 	exec, err := b.client.CreateExec(docker.CreateExecOptions{
 		Context:      ctx,
+		AttachStdin:  opt.Stdin != nil,
 		AttachStdout: true,
 		AttachStderr: true,
 		Tty:          false,
 		Cmd:          cmd,
 		Container:    containerID,
+		WorkingDir:   opt.WorkDir,
+		Env:          execEnv(opt.Env),
+		User:         opt.User,
 	})
 	if err != nil {
-		return nil, fmt.Errorf("can't create exec %v: %v", cmd, err)
+		return 0, fmt.Errorf("can't create exec %v: %v", opt.Cmd, err)
+	}
+	stdout, stderr := opt.Stdout, opt.Stderr
+	if stdout == nil {
+		stdout = ioutil.Discard
+	}
+	if stderr == nil {
+		stderr = ioutil.Discard
 	}
-	outputBuf := new(bytes.Buffer)
-	errBuf := new(bytes.Buffer)
 	err = b.client.StartExec(exec.ID, docker.StartExecOptions{
-		Context:      ctx,
+		Context:      execCtx,
 		Detach:       false,
-		OutputStream: outputBuf,
-		ErrorStream:  errBuf,
+		InputStream:  opt.Stdin,
+		OutputStream: stdout,
+		ErrorStream:  stderr,
 	})
+	if pidFile != "" {
+		if execCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+			b.runShell(containerID, fmt.Sprintf("kill -9 $(cat %s); rm -f %s", pidFile, pidFile))
+			return 128 + 9, libhive.ErrExecTimeout
+		}
+		b.runShell(containerID, "rm -f "+pidFile)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("can't run exec %v: %v", cmd, err)
+		return 0, fmt.Errorf("can't run exec %v: %v", opt.Cmd, err)
 	}
 	insp, err := b.client.InspectExec(exec.ID)
 	if err != nil {
-		return nil, fmt.Errorf("can't check execution result of %v: %v", cmd, err)
+		return 0, fmt.Errorf("can't check execution result of %v: %v", opt.Cmd, err)
 	}
+	return insp.ExitCode, nil
+}
 
-	return &libhive.ExecInfo{
-		Stdout:   outputBuf.String(),
-		Stderr:   errBuf.String(),
-		ExitCode: insp.ExitCode,
-	}, nil
+// StartProgram starts a command in the given container without waiting for it to exit.
+// Like in RunProgram, the command is started through a shell which records its PID, so
+// KillProgram can kill it later. The PID file is passed to the shell as $0.
+func (b *ContainerBackend) StartProgram(ctx context.Context, containerID string, opt libhive.ExecOptions) (string, error) {
+	pidFile := fmt.Sprintf("/tmp/hive-exec-%d.pid", time.Now().UnixNano())
+	cmd := append([]string{"/bin/sh", "-c", `echo $$ > "$0" && exec "$@"`, pidFile}, opt.Cmd...)
+	exec, err := b.client.CreateExec(docker.CreateExecOptions{
+		Context:    ctx,
+		Cmd:        cmd,
+		Container:  containerID,
+		WorkingDir: opt.WorkDir,
+		Env:        execEnv(opt.Env),
+		User:       opt.User,
+	})
+	if err != nil {
+		return "", fmt.Errorf("can't create exec %v: %v", opt.Cmd, err)
+	}
+	err = b.client.StartExec(exec.ID, docker.StartExecOptions{Context: ctx, Detach: true})
+	if err != nil {
+		return "", fmt.Errorf("can't start exec %v: %v", opt.Cmd, err)
+	}
+	return exec.ID, nil
+}
+
+// execEnv converts environment variables to the KEY=value form used by docker.
+// The result is sorted to keep exec requests reproducible.
+func execEnv(env map[string]string) []string {
+	if len(env) == 0 {
+		return nil
+	}
+	vars := make([]string, 0, len(env))
+	for key, val := range env {
+		vars = append(vars, key+"="+val)
+	}
+	sort.Strings(vars)
+	return vars
+}
+
+// ProgramStatus returns the state of a command started by StartProgram.
+func (b *ContainerBackend) ProgramStatus(ctx context.Context, containerID, execID string) (*libhive.ProgramStatus, error) {
+	insp, err := b.inspectProgram(containerID, execID)
+	if err != nil {
+		return nil, err
+	}
+	return &libhive.ProgramStatus{Running: insp.Running, ExitCode: insp.ExitCode}, nil
+}
+
+// KillProgram kills a command started by StartProgram. Killing a command which has
+// already exited is not an error.
+func (b *ContainerBackend) KillProgram(ctx context.Context, containerID, execID string) error {
+	insp, err := b.inspectProgram(containerID, execID)
+	if err != nil {
+		return err
+	}
+	if !insp.Running {
+		return nil
+	}
+	args := insp.ProcessConfig.Arguments
+	if len(args) < 3 || !strings.HasPrefix(args[2], "/tmp/hive-exec-") {
+		return fmt.Errorf("exec %s was not started by hive", execID)
+	}
+	pidFile := args[2]
+	b.runShell(containerID, fmt.Sprintf("kill -9 $(cat %s); rm -f %s", pidFile, pidFile))
+	return nil
+}
+
+// inspectProgram returns the state of an exec, checking that it belongs to the
+// given container.
+func (b *ContainerBackend) inspectProgram(containerID, execID string) (*docker.ExecInspect, error) {
+	insp, err := b.client.InspectExec(execID)
+	if err != nil {
+		if _, ok := err.(*docker.NoSuchExec); ok {
+			return nil, libhive.ErrNoSuchExec
+		}
+		return nil, err
+	}
+	if insp.ContainerID != containerID {
+		return nil, libhive.ErrNoSuchExec
+	}
+	return insp, nil
+}
+
+// runShell runs a shell script in a container, ignoring its output.
+func (b *ContainerBackend) runShell(containerID, script string) {
+	exec, err := b.client.CreateExec(docker.CreateExecOptions{
+		Cmd:       []string{"/bin/sh", "-c", script},
+		Container: containerID,
+	})
+	if err == nil {
+		err = b.client.StartExec(exec.ID, docker.StartExecOptions{Detach: false})
+	}
+	if err != nil {
+		b.logger.Error("can't run shell script", "container", containerID[:8], "script", script, "err", err)
+	}
 }
 
 // CreateContainer creates a docker container.
@@ -100,11 +322,45 @@ func (b *ContainerBackend) CreateContainer(ctx context.Context, imageName string
 	for key, val := range opt.Env {
 		vars = append(vars, key+"="+val)
 	}
+	var ulimits []docker.ULimit
+	for _, u := range opt.Ulimits {
+		ulimits = append(ulimits, docker.ULimit{Name: u.Name, Soft: u.Soft, Hard: u.Hard})
+	}
+	// Docker creates missing volumes on mount. Check that the volumes exist,
+	// so mistyped names are reported instead of mounting empty volumes.
+	var mounts []docker.HostMount
+	for _, m := range opt.Mounts {
+		if m.HostDir != "" {
+			mounts = append(mounts, docker.HostMount{Type: "bind", Source: m.HostDir, Target: m.Target, ReadOnly: m.ReadOnly})
+			continue
+		}
+		if _, err := b.client.InspectVolume(m.Volume); err == docker.ErrNoSuchVolume {
+			return "", fmt.Errorf("volume %q does not exist", m.Volume)
+		} else if err != nil {
+			return "", err
+		}
+		mounts = append(mounts, docker.HostMount{Type: "volume", Source: m.Volume, Target: m.Target, ReadOnly: m.ReadOnly})
+	}
+	config := &docker.Config{
+		Image:  imageName,
+		Env:    vars,
+		Labels: opt.Labels,
+	}
+	if opt.EnvFile != "" {
+		if err := b.wrapEntrypoint(config, opt.EnvFile); err != nil {
+			return "", err
+		}
+	}
 	c, err := b.client.CreateContainer(docker.CreateContainerOptions{
 		Context: ctx,
-		Config: &docker.Config{
-			Image: imageName,
-			Env:   vars,
+		Config:  config,
+		HostConfig: &docker.HostConfig{
+			Privileged: opt.Privileged,
+			CapAdd:     opt.CapAdd,
+			Memory:     opt.Memory,
+			NanoCPUs:   opt.NanoCPUs,
+			Ulimits:    ulimits,
+			Mounts:     mounts,
 		},
 	})
 	if err != nil {
@@ -112,6 +368,16 @@ func (b *ContainerBackend) CreateContainer(ctx context.Context, imageName string
 	}
 	logger := b.logger.New("image", imageName, "container", c.ID[:8])
 
+	// Containers created with network mode "none" can't join other networks,
+	// so the container is disconnected from the bridge network instead.
+	if opt.NoDefaultNetwork {
+		if err := b.DisconnectContainer(c.ID, "bridge"); err != nil {
+			logger.Error("can't disconnect container from bridge network", "err", err)
+			b.DeleteContainer(c.ID)
+			return "", err
+		}
+	}
+
 	// Now upload files.
 	if err := b.uploadFiles(ctx, c.ID, opt.Files); err != nil {
 		logger.Error("container file upload failed", "err", err)
@@ -122,14 +388,52 @@ func (b *ContainerBackend) CreateContainer(ctx context.Context, imageName string
 	return c.ID, err
 }
 
+// envFileScript is the entrypoint of containers with an environment file. The file
+// is passed as $0 and the original command of the image as the remaining arguments.
+const envFileScript = `if [ -f "$0" ]; then set -a; . "$0"; set +a; fi; exec "$@"`
+
+// wrapEntrypoint replaces the entrypoint of the container with a shell script that
+// loads the environment file before running the original entrypoint and command.
+func (b *ContainerBackend) wrapEntrypoint(config *docker.Config, envFile string) error {
+	img, err := b.client.InspectImage(config.Image)
+	if err != nil {
+		return fmt.Errorf("can't inspect image %q: %v", config.Image, err)
+	}
+	if img.Config == nil {
+		return fmt.Errorf("image %q has no config", config.Image)
+	}
+	cmd := append(append([]string{}, img.Config.Entrypoint...), img.Config.Cmd...)
+	if len(cmd) == 0 {
+		return fmt.Errorf("image %q has no entrypoint or command", config.Image)
+	}
+	config.Entrypoint = []string{"/bin/sh", "-c", envFileScript, envFile}
+	config.Cmd = cmd
+	return nil
+}
+
 // StartContainer starts a docker container.
 func (b *ContainerBackend) StartContainer(ctx context.Context, containerID string, opt libhive.ContainerOptions) (*libhive.ContainerInfo, error) {
+	return b.startContainer(ctx, containerID, opt, os.O_TRUNC)
+}
+
+// RestartContainer stops a running container and starts it again.
+func (b *ContainerBackend) RestartContainer(ctx context.Context, containerID string, opt libhive.ContainerOptions) (*libhive.ContainerInfo, error) {
+	b.logger.Debug("stopping container for restart", "container", containerID[:8])
+	if err := b.client.StopContainerWithContext(containerID, 10, ctx); err != nil {
+		return nil, fmt.Errorf("%w: %v", libhive.ErrContainerNotStopped, err)
+	}
+	return b.startContainer(ctx, containerID, opt, os.O_APPEND)
+}
+
+// startContainer runs the container and waits for it to come online. The logFlag
+// is used when opening the log file and should be O_TRUNC or O_APPEND.
+func (b *ContainerBackend) startContainer(ctx context.Context, containerID string, opt libhive.ContainerOptions, logFlag int) (*libhive.ContainerInfo, error) {
 	info := &libhive.ContainerInfo{ID: containerID[:8], LogFile: opt.LogFile}
 	logger := b.logger.New("container", info.ID)
 
 	// Run the container.
 	var startTime = time.Now()
-	waiter, err := b.runContainer(ctx, logger, containerID, info.LogFile)
+	waiter, err := b.runContainer(ctx, logger, containerID, info.LogFile, logFlag)
 	if err != nil {
 		b.DeleteContainer(containerID)
 		return nil, fmt.Errorf("container did not start: %v", err)
@@ -226,13 +530,91 @@ func (b *ContainerBackend) DeleteContainer(containerID string) error {
 	return err
 }
 
+// StopContainer sends a signal to the container and waits for it to exit. The
+// container is killed if it doesn't exit within the timeout.
+func (b *ContainerBackend) StopContainer(ctx context.Context, containerID string, opt libhive.StopOptions) error {
+	sig := docker.SIGTERM
+	if opt.Signal != 0 {
+		sig = docker.Signal(opt.Signal)
+	}
+	b.logger.Debug("stopping container", "container", containerID[:8], "signal", int(sig), "timeout", opt.Timeout)
+	err := b.client.KillContainer(docker.KillContainerOptions{ID: containerID, Signal: sig, Context: ctx})
+	if err != nil {
+		return err
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, opt.Timeout)
+	defer cancel()
+	if _, err := b.client.WaitContainerWithContext(containerID, waitCtx); err == nil {
+		return nil
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	b.logger.Debug("container did not exit in time, killing it", "container", containerID[:8])
+	return b.client.KillContainer(docker.KillContainerOptions{ID: containerID, Signal: docker.SIGKILL, Context: ctx})
+}
+
+// ContainerState returns whether the main process of the given container is running,
+// and its exit code if it isn't.
+func (b *ContainerBackend) ContainerState(ctx context.Context, containerID string) (*libhive.ContainerState, error) {
+	info, err := b.client.InspectContainerWithOptions(docker.InspectContainerOptions{ID: containerID, Context: ctx})
+	if err != nil {
+		return nil, err
+	}
+	return &libhive.ContainerState{Running: info.State.Running, ExitCode: info.State.ExitCode}, nil
+}
+
+// SignalContainer sends a signal to the main process of the given container.
+func (b *ContainerBackend) SignalContainer(ctx context.Context, containerID string, signal int) error {
+	b.logger.Debug("signalling container", "container", containerID[:8], "signal", signal)
+	return b.client.KillContainer(docker.KillContainerOptions{ID: containerID, Signal: docker.Signal(signal), Context: ctx})
+}
+
+// PauseContainer suspends all processes in the given container.
+func (b *ContainerBackend) PauseContainer(containerID string) error {
+	paused, err := b.isPaused(containerID)
+	if err != nil || paused {
+		return err
+	}
+	b.logger.Debug("pausing container", "container", containerID[:8])
+	return b.client.PauseContainer(containerID)
+}
+
+// UnpauseContainer resumes a paused container.
+func (b *ContainerBackend) UnpauseContainer(containerID string) error {
+	paused, err := b.isPaused(containerID)
+	if err != nil || !paused {
+		return err
+	}
+	b.logger.Debug("unpausing container", "container", containerID[:8])
+	return b.client.UnpauseContainer(containerID)
+}
+
+func (b *ContainerBackend) isPaused(containerID string) (bool, error) {
+	info, err := b.client.InspectContainerWithOptions(docker.InspectContainerOptions{ID: containerID})
+	if err != nil {
+		return false, err
+	}
+	if !info.State.Running {
+		return false, fmt.Errorf("container %s is not running", containerID[:8])
+	}
+	return info.State.Paused, nil
+}
+
 // CreateNetwork creates a docker network.
-func (b *ContainerBackend) CreateNetwork(name string) (string, error) {
-	network, err := b.client.CreateNetwork(docker.CreateNetworkOptions{
+func (b *ContainerBackend) CreateNetwork(name string, opt libhive.NetworkOptions) (string, error) {
+	createOpts := docker.CreateNetworkOptions{
 		Name:           name,
 		CheckDuplicate: true,
 		Attachable:     true,
-	})
+		Internal:       opt.Internal,
+	}
+	if opt.Subnet != "" {
+		createOpts.IPAM = &docker.IPAMOptions{
+			Config: []docker.IPAMConfig{{Subnet: opt.Subnet, Gateway: opt.Gateway}},
+		}
+	}
+	network, err := b.client.CreateNetwork(createOpts)
 	if err != nil {
 		return "", err
 	}
@@ -282,14 +664,35 @@ func (b *ContainerBackend) ContainerIP(containerID, networkID string) (net.IP, e
 			return net.ParseIP(network.IPAddress), nil
 		}
 	}
-	return nil, fmt.Errorf("network not found")
+	return nil, libhive.ErrNotAttached
 }
 
-// ConnectContainer connects the given container to a network.
-func (b *ContainerBackend) ConnectContainer(containerID, networkID string) error {
-	return b.client.ConnectNetwork(networkID, docker.NetworkConnectionOptions{
-		Container: containerID,
-	})
+// NetworkIPs returns the IPs of all containers in the given network.
+func (b *ContainerBackend) NetworkIPs(networkID string) (map[string]net.IP, error) {
+	info, err := b.client.NetworkInfo(networkID)
+	if err != nil {
+		return nil, err
+	}
+	ips := make(map[string]net.IP, len(info.Containers))
+	for id, endpoint := range info.Containers {
+		// The address is reported in CIDR notation.
+		ip, _, err := net.ParseCIDR(endpoint.IPv4Address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP address %q of container %s", endpoint.IPv4Address, id)
+		}
+		ips[id] = ip
+	}
+	return ips, nil
+}
+
+// ConnectContainer connects the given container to a network. The aliases are
+// DNS names of the container on the network.
+func (b *ContainerBackend) ConnectContainer(containerID, networkID string, aliases ...string) error {
+	opts := docker.NetworkConnectionOptions{Container: containerID}
+	if len(aliases) > 0 {
+		opts.EndpointConfig = &docker.EndpointConfig{Aliases: aliases}
+	}
+	return b.client.ConnectNetwork(networkID, opts)
 }
 
 // DisconnectContainer disconnects the given container from a network.
@@ -299,16 +702,105 @@ func (b *ContainerBackend) DisconnectContainer(containerID, networkID string) er
 	})
 }
 
+// shapeScript finds the network interface with the MAC address given in $0 and
+// configures its netem queueing discipline. The netem parameters are passed as the
+// remaining arguments. Without parameters, the queueing discipline is reset.
+const shapeScript = `dev=$(grep -lx "$0" /sys/class/net/*/address | cut -d/ -f5)
+if [ -z "$dev" ]; then echo "no interface with address $0" >&2; exit 1; fi
+if [ $# -eq 0 ]; then tc qdisc del dev "$dev" root 2>/dev/null; exit 0; fi
+exec tc qdisc replace dev "$dev" root netem "$@"`
+
+// ShapeContainer configures traffic shaping of a container on the given network.
+// Shaping is implemented using netem, which is run in the container through a
+// privileged exec. This requires the 'tc' tool to be installed in the container.
+func (b *ContainerBackend) ShapeContainer(ctx context.Context, containerID, networkID string, opt libhive.NetworkShaping) error {
+	details, err := b.client.InspectContainerWithOptions(docker.InspectContainerOptions{
+		Context: ctx,
+		ID:      containerID,
+	})
+	if err != nil {
+		return err
+	}
+	var mac string
+	for _, network := range details.NetworkSettings.Networks {
+		if network.NetworkID == networkID {
+			mac = network.MacAddress
+		}
+	}
+	if mac == "" {
+		return libhive.ErrNotAttached
+	}
+
+	cmd := append([]string{"/bin/sh", "-c", shapeScript, mac}, netemArgs(opt)...)
+	exec, err := b.client.CreateExec(docker.CreateExecOptions{
+		Context:      ctx,
+		AttachStdout: true,
+		AttachStderr: true,
+		Cmd:          cmd,
+		Container:    containerID,
+		Privileged:   true,
+	})
+	if err != nil {
+		return fmt.Errorf("can't create exec: %v", err)
+	}
+	var output bytes.Buffer
+	err = b.client.StartExec(exec.ID, docker.StartExecOptions{
+		Context:      ctx,
+		OutputStream: &output,
+		ErrorStream:  &output,
+	})
+	if err != nil {
+		return fmt.Errorf("can't run exec: %v", err)
+	}
+	insp, err := b.client.InspectExec(exec.ID)
+	if err != nil {
+		return fmt.Errorf("can't check execution result: %v", err)
+	}
+	if insp.ExitCode != 0 {
+		return fmt.Errorf("tc failed with exit code %d: %s", insp.ExitCode, strings.TrimSpace(output.String()))
+	}
+	return nil
+}
+
+// netemArgs returns the netem parameters for the given shaping options.
+func netemArgs(opt libhive.NetworkShaping) []string {
+	var args []string
+	if opt.Latency > 0 {
+		args = append(args, "delay", fmt.Sprintf("%dus", opt.Latency.Microseconds()))
+		if opt.Jitter > 0 {
+			args = append(args, fmt.Sprintf("%dus", opt.Jitter.Microseconds()))
+		}
+	}
+	if opt.Loss > 0 {
+		args = append(args, "loss", strconv.FormatFloat(opt.Loss, 'f', -1, 64)+"%")
+	}
+	if opt.Rate > 0 {
+		args = append(args, "rate", fmt.Sprintf("%dbit", opt.Rate))
+	}
+	return args
+}
+
 // uploadFiles uploads the given files into a docker container.
 func (b *ContainerBackend) uploadFiles(ctx context.Context, id string, files map[string]*multipart.FileHeader) error {
 	// Short circuit if there are no files to upload
 	if len(files) == 0 {
 		return nil
 	}
-	// Create a tarball archive with all the data files
+	// Create a tarball archive with all the data files. Archives are added
+	// first, so that individual files take precedence over archive content.
 	tarball := new(bytes.Buffer)
 	tw := tar.NewWriter(tarball)
+	for _, fileHeader := range files {
+		if ftype := fileHeader.Header.Get(libhive.FileTypeHeader); ftype != "" {
+			if err := copyArchive(tw, fileHeader, ftype); err != nil {
+				return fmt.Errorf("can't extract archive %s: %v", fileHeader.Filename, err)
+			}
+		}
+	}
 	for filePath, fileHeader := range files {
+		if fileHeader.Header.Get(libhive.FileTypeHeader) != "" {
+			continue
+		}
 		// Fetch the next file to inject into the container
 		file, err := fileHeader.Open()
 		if err != nil {
@@ -345,10 +837,49 @@ func (b *ContainerBackend) uploadFiles(ctx context.Context, id string, files map
 	})
 }
 
+// copyArchive adds the entries of an uploaded TAR archive to tw.
+func copyArchive(tw *tar.Writer, fileHeader *multipart.FileHeader, ftype string) error {
+	file, err := fileHeader.Open()
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	switch ftype {
+	case libhive.FileTypeTAR:
+	case libhive.FileTypeTARGzip:
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	default:
+		return fmt.Errorf("unsupported archive type %q", ftype)
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return err
+		}
+	}
+}
+
 // runContainer attaches to the output streams of an existing container, then
 // starts executing the container and returns the CloseWaiter to allow the caller
 // to wait for termination.
-func (b *ContainerBackend) runContainer(ctx context.Context, logger log15.Logger, id, logfile string) (docker.CloseWaiter, error) {
+func (b *ContainerBackend) runContainer(ctx context.Context, logger log15.Logger, id, logfile string, logFlag int) (docker.CloseWaiter, error) {
 	var stream io.Writer
 
 	// Redirect container output to logfile.
@@ -357,7 +888,7 @@ func (b *ContainerBackend) runContainer(ctx context.Context, logger log15.Logger
 		if err := os.MkdirAll(filepath.Dir(logfile), 0755); err != nil {
 			return nil, err
 		}
-		log, err := os.OpenFile(logfile, os.O_WRONLY|os.O_CREATE|os.O_SYNC|os.O_TRUNC, 0644)
+		log, err := os.OpenFile(logfile, os.O_WRONLY|os.O_CREATE|os.O_SYNC|logFlag, 0644)
 		if err != nil {
 			return nil, err
 		}
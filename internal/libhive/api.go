@@ -1,14 +1,23 @@
 package libhive
 
 import (
+	"archive/tar"
+	"bytes"
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"mime"
 	"mime/multipart"
 	"net"
 	"net/http"
+	"net/url"
+	"os"
 	"path"
 	"path/filepath"
 	"sort"
@@ -25,6 +34,79 @@ import (
 // be moved from test images to client container to fine tune their setup.
 const hiveEnvvarPrefix = "HIVE_"
 
+// labelFieldPrefix is the prefix of form fields that set docker labels
+// on client containers.
+const labelFieldPrefix = "label:"
+
+// privilegedField is the form field that requests a privileged client container.
+const privilegedField = "privileged"
+
+// noDefaultNetworkField is the form field that requests a client container which
+// is not connected to the default bridge network.
+const noDefaultNetworkField = "nodefaultnetwork"
+
+// These form fields set resource limits of client containers.
+const (
+	memoryField = "memory" // in bytes
+	cpusField   = "cpus"   // number of CPUs, may be fractional
+)
+
+// ulimitFieldPrefix is the prefix of form fields that set process resource
+// limits of client containers. The field name ends with the limit name, the
+// value is "<soft>:<hard>".
+const ulimitFieldPrefix = "ulimit:"
+
+// volumeFieldPrefix is the prefix of form fields that mount named volumes
+// into client containers. The field name ends with the mount path in the
+// container, the value is the volume name, optionally followed by ":ro"
+// for a read-only mount.
+const volumeFieldPrefix = "volume:"
+
+// capabilityFieldPrefix is the prefix of form fields that add Linux
+// capabilities to client containers.
+const capabilityFieldPrefix = "capability:"
+
+// networkFieldPrefix is the prefix of form fields that name networks
+// which client containers are connected to before they start.
+const networkFieldPrefix = "network:"
+
+// startTimeoutField is the form field that sets the time to wait for the
+// client to start. It overrides the default start timeout.
+const startTimeoutField = "timeout"
+
+// startupFieldPrefix is the prefix of form fields containing auxiliary commands
+// which are started in client containers after the client. The field name
+// ends with the index of the command, the value is a JSON array.
+const startupFieldPrefix = "startup:"
+
+// uploadFieldPrefix is the prefix of form fields naming uploads which are
+// extracted into client containers as TAR archives. The field name ends with
+// the index of the archive, the value is the upload ID.
+const uploadFieldPrefix = "upload:"
+
+// checksumFieldPrefix is the prefix of form fields containing the hex-encoded SHA-256
+// digest of an uploaded file. The field name ends with the name of the file field.
+// The digest is sent in a separate field because the multipart header of the file
+// is written before its content.
+const checksumFieldPrefix = "sha256:"
+
+// buildArgFieldPrefix is the prefix of form fields containing docker build
+// arguments. When present, the client image is rebuilt using the arguments.
+const buildArgFieldPrefix = "buildarg:"
+
+// imageField is the form field containing an image reference which is used
+// instead of the client image, e.g. a nightly build pushed to a registry. The
+// image is pulled if it doesn't exist locally.
+const imageField = "image"
+
+// clientEnvFile is the environment file of client containers. It is written when a
+// client is reconfigured and loaded by the container entrypoint.
+const clientEnvFile = "/hive.env"
+
+// startDurationHeader is the response header of client start requests containing
+// the time from container creation until the client was ready.
+const startDurationHeader = "X-HIVE-START-DURATION"
+
 // This is the default timeout for starting clients.
 const defaultStartTimeout = time.Duration(60 * time.Second)
 
@@ -36,16 +118,41 @@ func newSimulationAPI(b ContainerBackend, env SimEnv, tm *TestManager) http.Hand
 	router := mux.NewRouter()
 	router.HandleFunc("/clients", api.getClientTypes).Methods("GET")
 	router.HandleFunc("/testsuite/{suite}/test/{test}/node/{node}/exec", api.execInClient).Methods("POST")
+	router.HandleFunc("/testsuite/{suite}/test/{test}/node/{node}/exec/{exec}", api.execStatus).Methods("GET")
+	router.HandleFunc("/testsuite/{suite}/test/{test}/node/{node}/exec/{exec}", api.execKill).Methods("DELETE")
+	router.HandleFunc("/testsuite/{suite}/test/{test}/node/{node}/logs", api.getClientLogs).Methods("GET")
+	router.HandleFunc("/testsuite/{suite}/test/{test}/node/{node}/files", api.getClientFiles).Methods("GET")
+	router.HandleFunc("/testsuite/{suite}/test/{test}/node/{node}/files", api.putClientFile).Methods("PUT")
+	router.HandleFunc("/testsuite/{suite}/test/{test}/node/{node}/inspect", api.inspectClient).Methods("GET")
+	router.HandleFunc("/testsuite/{suite}/test/{test}/node/{node}/stats", api.getClientStats).Methods("GET")
+	router.HandleFunc("/testsuite/{suite}/test/{test}/node/{node}/state", api.getClientState).Methods("GET")
+	router.HandleFunc("/testsuite/{suite}/test/{test}/node/{node}/restart", api.restartClient).Methods("POST")
+	router.HandleFunc("/testsuite/{suite}/test/{test}/node/{node}/reconfigure", api.reconfigureClient).Methods("POST")
+	router.HandleFunc("/testsuite/{suite}/test/{test}/node/{node}/pause", api.pauseClient).Methods("POST")
+	router.HandleFunc("/testsuite/{suite}/test/{test}/node/{node}/unpause", api.unpauseClient).Methods("POST")
+	router.HandleFunc("/testsuite/{suite}/test/{test}/node/{node}/signal", api.signalClient).Methods("POST")
 	router.HandleFunc("/testsuite/{suite}/test/{test}/node/{node}", api.getEnodeURL).Methods("GET")
+	router.HandleFunc("/testsuite/{suite}/test/{test}/output", api.testOutputDir).Methods("POST")
 	router.HandleFunc("/testsuite/{suite}/test/{test}/node", api.startClient).Methods("POST")
+	router.HandleFunc("/testsuite/{suite}/test/{test}/node", api.listClients).Methods("GET")
+	router.HandleFunc("/testsuite/{suite}/test/{test}/node", api.stopAllClients).Methods("DELETE")
 	router.HandleFunc("/testsuite/{suite}/test/{test}/node/{node}", api.stopClient).Methods("DELETE")
 	router.HandleFunc("/testsuite/{suite}/test", api.startTest).Methods("POST")
 	// post because the delete http verb does not always support a message body
 	router.HandleFunc("/testsuite/{suite}/test/{test}", api.endTest).Methods("POST")
 	router.HandleFunc("/testsuite", api.startSuite).Methods("POST")
 	router.HandleFunc("/testsuite/{suite}", api.endSuite).Methods("DELETE")
+	router.HandleFunc("/testsuite/{suite}/attachment", api.putSuiteAttachment).Methods("PUT")
+	router.HandleFunc("/testsuite/{suite}/upload", api.uploadCreate).Methods("POST")
+	router.HandleFunc("/testsuite/{suite}/upload/{upload}", api.uploadSize).Methods("GET")
+	router.HandleFunc("/testsuite/{suite}/upload/{upload}", api.uploadAppend).Methods("PUT")
+	router.HandleFunc("/testsuite/{suite}/upload/{upload}", api.uploadRemove).Methods("DELETE")
+	router.HandleFunc("/testsuite/{suite}/network", api.networkList).Methods("GET")
 	router.HandleFunc("/testsuite/{suite}/network/{network}", api.networkCreate).Methods("POST")
 	router.HandleFunc("/testsuite/{suite}/network/{network}", api.networkRemove).Methods("DELETE")
+	router.HandleFunc("/testsuite/{suite}/network/{network}", api.networkIPs).Methods("GET")
+	router.HandleFunc("/testsuite/{suite}/network/{network}/shaping", api.networkShape).Methods("POST")
+	router.HandleFunc("/testsuite/{suite}/network/{network}/shaping", api.networkUnshape).Methods("DELETE")
 	router.HandleFunc("/testsuite/{suite}/network/{network}/{node}", api.networkIPGet).Methods("GET")
 	router.HandleFunc("/testsuite/{suite}/network/{network}/{node}", api.networkConnect).Methods("POST")
 	router.HandleFunc("/testsuite/{suite}/network/{network}/{node}", api.networkDisconnect).Methods("DELETE")
@@ -80,9 +187,37 @@ func (api *simAPI) getClientTypes(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// parseForm parses the parameters of a request into r.Form. The parameters can be sent
+// as a url-encoded form or as a JSON object. Values of a JSON object which are not
+// strings are stored as their JSON encoding.
+func parseForm(r *http.Request) error {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/json" {
+		return r.ParseForm()
+	}
+	var params map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		return fmt.Errorf("invalid JSON: %v", err)
+	}
+	r.PostForm = make(url.Values, len(params))
+	for key, raw := range params {
+		var s string
+		if err := json.Unmarshal(raw, &s); err == nil {
+			r.PostForm.Set(key, s)
+		} else {
+			r.PostForm.Set(key, string(raw))
+		}
+	}
+	r.Form = r.URL.Query()
+	for key, vals := range r.PostForm {
+		r.Form[key] = append(vals, r.Form[key]...)
+	}
+	return nil
+}
+
 // startSuite starts a suite.
 func (api *simAPI) startSuite(w http.ResponseWriter, r *http.Request) {
-	if err := r.ParseForm(); err != nil {
+	if err := parseForm(r); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
@@ -120,13 +255,20 @@ func (api *simAPI) startTest(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	if err := r.ParseForm(); err != nil {
+	if err := parseForm(r); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	var labels map[string]string
+	if enc := r.Form.Get("labels"); enc != "" {
+		if err := json.Unmarshal([]byte(enc), &labels); err != nil {
+			http.Error(w, fmt.Sprintf("invalid labels: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
 	name := r.Form.Get("name")
-	testID, err := api.tm.StartTest(suiteID, name, r.Form.Get("description"))
+	testID, err := api.tm.StartTestWithLabels(suiteID, name, r.Form.Get("description"), labels)
 	if err != nil {
 		msg := fmt.Sprintf("can't start test case: %s", err.Error())
 		http.Error(w, msg, http.StatusInternalServerError)
@@ -143,7 +285,13 @@ func (api *simAPI) endTest(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	if err := r.ParseForm(); err != nil {
+	// Results with attachments are sent as multipart form data.
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+		err = r.ParseMultipartForm((1 << 10) * 4)
+	} else {
+		err = parseForm(r)
+	}
+	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
@@ -179,6 +327,107 @@ func (api *simAPI) endTest(w http.ResponseWriter, r *http.Request) {
 		responseWritten = true
 		return
 	}
+
+	// Store attachments.
+	if r.MultipartForm == nil || len(r.MultipartForm.File["attachment"]) == 0 {
+		return
+	}
+	dir := path.Join("attachments", fmt.Sprintf("%d-%d-%d", time.Now().Unix(), suiteID, testID))
+	for _, fh := range r.MultipartForm.File["attachment"] {
+		if err := api.storeAttachment(testID, dir, fh); err != nil {
+			log15.Error("API: can't store attachment", "test", testID, "name", fh.Filename, "error", err)
+			http.Error(w, fmt.Sprintf("can't store attachment %q: %v", fh.Filename, err), http.StatusBadRequest)
+			responseWritten = true
+			return
+		}
+	}
+}
+
+// storeAttachment writes a test result attachment to the log directory.
+func (api *simAPI) storeAttachment(testID TestID, dir string, fh *multipart.FileHeader) error {
+	name := fh.Filename
+	if !validAttachmentName(name) {
+		return fmt.Errorf("invalid attachment name")
+	}
+	src, err := fh.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	jsonPath := path.Join(dir, name)
+	if err := api.writeLogFile(jsonPath, src); err != nil {
+		return err
+	}
+	return api.tm.AddTestAttachment(testID, name, jsonPath)
+}
+
+// putSuiteAttachment stores the request body as an attachment of a test suite.
+// An existing attachment with the same name is replaced.
+func (api *simAPI) putSuiteAttachment(w http.ResponseWriter, r *http.Request) {
+	suiteID, err := api.requestSuite(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	name := r.URL.Query().Get("name")
+	if !validAttachmentName(name) {
+		http.Error(w, fmt.Sprintf("invalid attachment name %q", name), http.StatusBadRequest)
+		return
+	}
+	jsonPath := path.Join("attachments", fmt.Sprintf("%d-%d", time.Now().Unix(), suiteID), name)
+	if err := api.writeLogFile(jsonPath, r.Body); err != nil {
+		log15.Error("API: can't store suite attachment", "suite", suiteID, "name", name, "error", err)
+		http.Error(w, fmt.Sprintf("can't store attachment %q: %v", name, err), http.StatusInternalServerError)
+		return
+	}
+	if err := api.tm.AddSuiteAttachment(suiteID, name, jsonPath); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	log15.Info("API: suite attachment stored", "suite", suiteID, "name", name)
+}
+
+// validAttachmentName reports whether name can be used as the file name of an attachment.
+func validAttachmentName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
+
+// writeLogFile writes the content of src to a file in the log directory. The path
+// is relative to the log directory and uses '/' as the separator.
+func (api *simAPI) writeLogFile(jsonPath string, src io.Reader) error {
+	file := filepath.Join(api.env.LogDir, filepath.FromSlash(jsonPath))
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	dst, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+// testOutputDir creates the output directory of a test and responds with its path
+// relative to the log directory.
+func (api *simAPI) testOutputDir(w http.ResponseWriter, r *http.Request) {
+	suiteID, testID, err := api.requestSuiteAndTest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	dir, err := api.tm.TestOutputDir(suiteID, testID)
+	if err == ErrNoSuchTestCase {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		log15.Error("API: can't create test output directory", "test", testID, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	io.WriteString(w, dir)
 }
 
 // startClient starts a client container.
@@ -197,14 +446,118 @@ func (api *simAPI) startClient(w http.ResponseWriter, r *http.Request) {
 	}
 	files := make(map[string]*multipart.FileHeader)
 	for key, fheaders := range r.MultipartForm.File {
-		if len(fheaders) > 0 {
+		if len(fheaders) == 0 {
+			continue
+		}
+		switch ftype := fheaders[0].Header.Get(FileTypeHeader); ftype {
+		case "", FileTypeTAR, FileTypeTARGzip:
 			files[key] = fheaders[0]
+		default:
+			log15.Error("API: unsupported file type in node request", "file", key, "type", ftype)
+			http.Error(w, fmt.Sprintf("unsupported %s %q for file %s", FileTypeHeader, ftype, key), http.StatusBadRequest)
+			return
 		}
 	}
+	if err := verifyChecksums(r.MultipartForm); err != nil {
+		log15.Error("API: file checksum verification failed", "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	env := make(map[string]string)
+	labels := make(map[string]string)
+	buildArgs := make(map[string]string)
+	var ulimits []Ulimit
+	var mounts []Mount
+	var (
+		networks   []string
+		caps       []string
+		privileged bool
+		noDefault  bool
+		memory     int64
+		nanoCPUs   int64
+		timeout    time.Duration
+		imageRef   string
+	)
 	for key, vals := range r.MultipartForm.Value {
-		if strings.HasPrefix(key, hiveEnvvarPrefix) {
+		switch {
+		case key == imageField:
+			imageRef = vals[0]
+		case key == privilegedField:
+			if privileged, err = strconv.ParseBool(vals[0]); err != nil {
+				http.Error(w, fmt.Sprintf("invalid value %q for %s", vals[0], privilegedField), http.StatusBadRequest)
+				return
+			}
+		case key == noDefaultNetworkField:
+			if noDefault, err = strconv.ParseBool(vals[0]); err != nil {
+				http.Error(w, fmt.Sprintf("invalid value %q for %s", vals[0], noDefaultNetworkField), http.StatusBadRequest)
+				return
+			}
+		case strings.HasPrefix(key, hiveEnvvarPrefix):
 			env[key] = vals[0]
+		case strings.HasPrefix(key, labelFieldPrefix) && len(key) > len(labelFieldPrefix):
+			labels[key[len(labelFieldPrefix):]] = vals[0]
+		case strings.HasPrefix(key, buildArgFieldPrefix) && len(key) > len(buildArgFieldPrefix):
+			buildArgs[key[len(buildArgFieldPrefix):]] = vals[0]
+		case strings.HasPrefix(key, networkFieldPrefix) && len(key) > len(networkFieldPrefix):
+			networks = append(networks, key[len(networkFieldPrefix):])
+		case key == memoryField:
+			if memory, err = strconv.ParseInt(vals[0], 10, 64); err != nil || memory <= 0 {
+				http.Error(w, fmt.Sprintf("invalid value %q for %s", vals[0], memoryField), http.StatusBadRequest)
+				return
+			}
+		case key == cpusField:
+			cpus, err := strconv.ParseFloat(vals[0], 64)
+			if err != nil || cpus <= 0 {
+				http.Error(w, fmt.Sprintf("invalid value %q for %s", vals[0], cpusField), http.StatusBadRequest)
+				return
+			}
+			nanoCPUs = int64(cpus * 1e9)
+		case key == startTimeoutField:
+			if timeout, err = time.ParseDuration(vals[0]); err != nil || timeout <= 0 {
+				http.Error(w, fmt.Sprintf("invalid value %q for %s", vals[0], startTimeoutField), http.StatusBadRequest)
+				return
+			}
+		case strings.HasPrefix(key, ulimitFieldPrefix):
+			u, err := parseUlimit(key[len(ulimitFieldPrefix):], vals[0])
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			ulimits = append(ulimits, u)
+		case strings.HasPrefix(key, volumeFieldPrefix):
+			m, err := parseVolume(key[len(volumeFieldPrefix):], vals[0])
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			mounts = append(mounts, m)
+		case strings.HasPrefix(key, capabilityFieldPrefix):
+			capability := key[len(capabilityFieldPrefix):]
+			if !validCapability(capability) {
+				http.Error(w, fmt.Sprintf("invalid capability %q", capability), http.StatusBadRequest)
+				return
+			}
+			caps = append(caps, capability)
+		}
+	}
+	sort.Strings(networks)
+	sort.Strings(caps)
+	sort.Slice(ulimits, func(i, j int) bool { return ulimits[i].Name < ulimits[j].Name })
+	sort.Slice(mounts, func(i, j int) bool { return mounts[i].Target < mounts[j].Target })
+	startup, err := parseStartupCommands(r.MultipartForm.Value)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	uploads, err := parseUploadFields(r.MultipartForm.Value)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, id := range uploads {
+		if _, err := api.tm.UploadSize(suiteID, id); err != nil {
+			http.Error(w, fmt.Sprintf("unknown upload %q", id), http.StatusBadRequest)
+			return
 		}
 	}
 	// Set default client loglevel to sim loglevel.
@@ -218,8 +571,40 @@ func (api *simAPI) startClient(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Build the client with the requested arguments. This happens
+	// before the start timeout applies because builds can be slow.
+	image := clientDef.Image
+	if imageRef != "" && len(buildArgs) > 0 {
+		http.Error(w, "image can't be combined with build arguments", http.StatusBadRequest)
+		return
+	}
+	if imageRef != "" {
+		if err := api.tm.PullImage(r.Context(), imageRef); err == ErrNoBuilder {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		} else if err != nil {
+			log15.Error("API: client image pull failed", "client", clientDef.Name, "image", imageRef, "error", err)
+			http.Error(w, fmt.Sprintf("can't pull image %q: %v", imageRef, err), http.StatusInternalServerError)
+			return
+		}
+		image = imageRef
+	}
+	if len(buildArgs) > 0 {
+		image, err = api.tm.ClientImage(r.Context(), clientDef.Name, buildArgs)
+		if err == ErrNoBuilder {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		} else if err != nil {
+			log15.Error("API: client image build failed", "client", clientDef.Name, "args", buildArgs, "error", err)
+			http.Error(w, "client image build failed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
 	// Set up the timeout.
-	timeout := api.env.ClientStartTimeout
+	if timeout == 0 {
+		timeout = api.env.ClientStartTimeout
+	}
 	if timeout == 0 {
 		timeout = defaultStartTimeout
 	}
@@ -227,22 +612,70 @@ func (api *simAPI) startClient(w http.ResponseWriter, r *http.Request) {
 	defer cancel()
 
 	// Create the client container.
-	options := ContainerOptions{Env: env, Files: files}
-	containerID, err := api.backend.CreateContainer(ctx, clientDef.Image, options)
+	createTime := time.Now()
+	options := ContainerOptions{
+		Env:        env,
+		Files:      files,
+		Labels:     labels,
+		Privileged: privileged,
+		CapAdd:     caps,
+		Memory:     memory,
+		NanoCPUs:   nanoCPUs,
+		Ulimits:    ulimits,
+		Mounts:     mounts,
+
+		NoDefaultNetwork: noDefault,
+	}
+	if imageRef == "" {
+		// Images pulled by reference may not have a shell to load the
+		// environment file, so only hive-built clients can be reconfigured.
+		options.EnvFile = clientEnvFile
+	}
+	containerID, err := api.backend.CreateContainer(ctx, image, options)
 	if err != nil {
 		log15.Error("API: client container create failed", "client", clientDef.Name, "error", err)
 		http.Error(w, "client container create failed: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	// Extract uploaded archives. They are added after the files of the request.
+	for _, id := range uploads {
+		err := api.extractUpload(ctx, suiteID, containerID, id)
+		if err == nil {
+			continue
+		}
+		log15.Error("API: could not extract upload", "client", clientDef.Name, "upload", id, "error", err)
+		api.backend.DeleteContainer(containerID)
+		http.Error(w, fmt.Sprintf("can't extract upload %q: %v", id, err), http.StatusInternalServerError)
+		return
+	}
+
+	// Connect to the requested networks before the client process starts.
+	for _, network := range networks {
+		err := api.tm.ConnectContainer(suiteID, network, containerID)
+		if err == nil {
+			continue
+		}
+		log15.Error("API: could not connect client to network", "client", clientDef.Name, "network", network, "error", err)
+		api.backend.DeleteContainer(containerID)
+		if err == ErrNetworkNotFound {
+			http.Error(w, fmt.Sprintf("unknown network %q", network), http.StatusBadRequest)
+		} else {
+			http.Error(w, fmt.Sprintf("can't connect client to network %q: %v", network, err), http.StatusInternalServerError)
+		}
+		return
+	}
+
 	// Set the log file. We need the container ID for this,
 	// so it can only be set after creating the container.
 	logPath, logFilePath := api.clientLogFilePaths(clientDef.Name, containerID)
 	options.LogFile = logFilePath
-	options.CheckLive = true
+	// Hive reaches the client through the bridge network to check that it is live.
+	options.CheckLive = !noDefault
 
 	// Start it!
 	info, err := api.backend.StartContainer(ctx, containerID, options)
+	startDuration := time.Since(createTime)
 	if info != nil {
 		clientInfo := &ClientInfo{
 			ID:             info.ID,
@@ -250,7 +683,9 @@ func (api *simAPI) startClient(w http.ResponseWriter, r *http.Request) {
 			Name:           clientDef.Name,
 			InstantiatedAt: time.Now(),
 			LogFile:        logPath,
+			checkLive:      options.CheckLive,
 			wait:           info.Wait,
+			envFile:        options.EnvFile,
 		}
 		api.tm.testSuiteMutex.Lock()
 
@@ -269,13 +704,191 @@ func (api *simAPI) startClient(w http.ResponseWriter, r *http.Request) {
 	}
 	if err != nil {
 		log15.Error("API: could not start client", "client", clientDef.Name, "container", containerID[:8], "error", err)
-		http.Error(w, "client did not start: "+err.Error(), http.StatusInternalServerError)
+		status := http.StatusInternalServerError
+		if ctx.Err() == context.DeadlineExceeded {
+			status = http.StatusGatewayTimeout
+		}
+		http.Error(w, "client did not start: "+err.Error(), status)
 		return
 	}
+
+	// Start auxiliary processes. They run until the client container stops.
+	for _, cmd := range startup {
+		if _, err := api.backend.StartProgram(ctx, info.ID, ExecOptions{Cmd: cmd}); err != nil {
+			log15.Error("API: could not start auxiliary process", "client", clientDef.Name, "container", containerID[:8], "cmd", cmd, "error", err)
+			api.tm.StopNode(testID, info.ID)
+			http.Error(w, fmt.Sprintf("can't start auxiliary process %v: %v", cmd, err), http.StatusInternalServerError)
+			return
+		}
+	}
 	log15.Info("API: client "+clientDef.Name+" started", "suite", suiteID, "test", testID, "container", containerID[:8])
+	w.Header().Set(startDurationHeader, startDuration.String())
 	fmt.Fprintf(w, "%s@%s@%s", info.ID, info.IP, info.MAC)
 }
 
+// validCapability reports whether name looks like a Linux capability name,
+// e.g. "NET_ADMIN" or "CAP_NET_ADMIN".
+func validCapability(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'A' && c <= 'Z' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// parseUlimit decodes a ulimit form field. The value is "<soft>:<hard>".
+func parseUlimit(name, value string) (Ulimit, error) {
+	u := Ulimit{Name: name}
+	for _, c := range name {
+		if c < 'a' || c > 'z' {
+			return u, fmt.Errorf("invalid ulimit name %q", name)
+		}
+	}
+	limits := strings.Split(value, ":")
+	if name == "" || len(limits) != 2 {
+		return u, fmt.Errorf("invalid ulimit %s=%q", name, value)
+	}
+	var err1, err2 error
+	u.Soft, err1 = strconv.ParseInt(limits[0], 10, 64)
+	u.Hard, err2 = strconv.ParseInt(limits[1], 10, 64)
+	if err1 != nil || err2 != nil || u.Soft < 0 || u.Soft > u.Hard {
+		return u, fmt.Errorf("invalid ulimit %s=%q", name, value)
+	}
+	return u, nil
+}
+
+// parseVolume decodes a volume form field. The value is "<volume>" or "<volume>:ro".
+func parseVolume(target, value string) (Mount, error) {
+	m := Mount{Target: target, Volume: value}
+	if strings.HasSuffix(value, ":ro") {
+		m.Volume, m.ReadOnly = strings.TrimSuffix(value, ":ro"), true
+	}
+	if !path.IsAbs(target) || path.Clean(target) != target || target == "/" {
+		return m, fmt.Errorf("invalid volume mount path %q", target)
+	}
+	if !validVolumeName(m.Volume) {
+		return m, fmt.Errorf("invalid volume name %q", m.Volume)
+	}
+	return m, nil
+}
+
+// validVolumeName reports whether name is a valid docker volume name.
+func validVolumeName(name string) bool {
+	for i, c := range name {
+		alnum := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+		if !alnum && (i == 0 || !strings.ContainsRune("_.-", c)) {
+			return false
+		}
+	}
+	return name != ""
+}
+
+// parseStartupCommands decodes the auxiliary commands of a client start request,
+// ordered by their index.
+func parseStartupCommands(form map[string][]string) ([][]string, error) {
+	var (
+		indices  []int
+		commands = make(map[int][]string)
+	)
+	for key, vals := range form {
+		if !strings.HasPrefix(key, startupFieldPrefix) {
+			continue
+		}
+		index, err := strconv.Atoi(key[len(startupFieldPrefix):])
+		if err != nil || index < 0 {
+			return nil, fmt.Errorf("invalid startup command field %q", key)
+		}
+		var cmd []string
+		if err := json.Unmarshal([]byte(vals[0]), &cmd); err != nil {
+			return nil, fmt.Errorf("invalid startup command %d: %v", index, err)
+		}
+		if cmd, err = hiveBinCommand(cmd); err != nil {
+			return nil, fmt.Errorf("invalid startup command %d: %v", index, err)
+		}
+		indices = append(indices, index)
+		commands[index] = cmd
+	}
+	sort.Ints(indices)
+	result := make([][]string, len(indices))
+	for i, index := range indices {
+		result[i] = commands[index]
+	}
+	return result, nil
+}
+
+// parseUploadFields returns the upload IDs of a client start request, ordered by
+// their index.
+func parseUploadFields(form map[string][]string) ([]string, error) {
+	var (
+		indices []int
+		ids     = make(map[int]string)
+	)
+	for key, vals := range form {
+		if !strings.HasPrefix(key, uploadFieldPrefix) {
+			continue
+		}
+		index, err := strconv.Atoi(key[len(uploadFieldPrefix):])
+		if err != nil || index < 0 {
+			return nil, fmt.Errorf("invalid upload field %q", key)
+		}
+		indices = append(indices, index)
+		ids[index] = vals[0]
+	}
+	sort.Ints(indices)
+	result := make([]string, len(indices))
+	for i, index := range indices {
+		result[i] = ids[index]
+	}
+	return result, nil
+}
+
+// extractUpload extracts an uploaded archive into the root directory of a container.
+func (api *simAPI) extractUpload(ctx context.Context, suiteID TestSuiteID, containerID, id string) error {
+	r, err := api.tm.OpenUpload(suiteID, id)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return api.backend.UploadArchive(ctx, containerID, "/", r)
+}
+
+// verifyChecksums checks the uploaded files against the digests sent in
+// checksum form fields.
+func verifyChecksums(form *multipart.Form) error {
+	for key, vals := range form.Value {
+		if !strings.HasPrefix(key, checksumFieldPrefix) {
+			continue
+		}
+		name := key[len(checksumFieldPrefix):]
+		fheaders := form.File[name]
+		if len(fheaders) == 0 {
+			return fmt.Errorf("checksum for missing file %q", name)
+		}
+		want, err := hex.DecodeString(vals[0])
+		if err != nil || len(want) != sha256.Size {
+			return fmt.Errorf("invalid checksum %q for file %q", vals[0], name)
+		}
+		f, err := fheaders[0].Open()
+		if err != nil {
+			return fmt.Errorf("can't read file %q: %v", name, err)
+		}
+		h := sha256.New()
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("can't read file %q: %v", name, err)
+		}
+		if have := h.Sum(nil); !bytes.Equal(have, want) {
+			return fmt.Errorf("checksum mismatch for file %q: got %x, want %x", name, have, want)
+		}
+	}
+	return nil
+}
+
 // clientLogFilePaths determines the log file path of a client container.
 // Note that jsonPath gets written to the result JSON and always uses '/' as the separator.
 // The filePath is passed to the docker backend and uses the platform separator.
@@ -304,6 +917,22 @@ func (api *simAPI) checkClient(r *http.Request, w http.ResponseWriter) (*ClientD
 	return nil, false
 }
 
+// listClients sends the running clients of a test.
+func (api *simAPI) listClients(w http.ResponseWriter, r *http.Request) {
+	_, testID, err := api.requestSuiteAndTest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	nodes, err := api.tm.RunningNodes(testID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(nodes)
+}
+
 // stopClient terminates a client container.
 func (api *simAPI) stopClient(w http.ResponseWriter, r *http.Request) {
 	_, testID, err := api.requestSuiteAndTest(r)
@@ -313,110 +942,910 @@ func (api *simAPI) stopClient(w http.ResponseWriter, r *http.Request) {
 	}
 	node := mux.Vars(r)["node"]
 
-	err = api.tm.StopNode(testID, node)
+	// The client is killed immediately unless a signal or timeout is given.
+	q := r.URL.Query()
+	var state *ContainerState
+	if q.Get("signal") != "" || q.Get("timeout") != "" {
+		var opt StopOptions
+		if opt.Signal, opt.Timeout, err = parseStopQuery(q); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		state, err = api.tm.StopNodeGracefully(r.Context(), testID, node, opt)
+	} else {
+		state, err = api.tm.StopNode(testID, node)
+	}
 	if err == ErrNoSuchNode {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
+	} else if err == ErrNodeBusy {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
 	} else if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(state)
 }
 
-// getEnodeURL gets the enode URL of the client.
-func (api *simAPI) getEnodeURL(w http.ResponseWriter, r *http.Request) {
-	suiteID, testID, err := api.requestSuiteAndTest(r)
+// parseStopQuery reads the signal and timeout parameters of a stop request.
+func parseStopQuery(q url.Values) (signal int, timeout time.Duration, err error) {
+	if s := q.Get("signal"); s != "" {
+		if signal, err = ParseSignal(s); err != nil {
+			return 0, 0, err
+		}
+	}
+	if s := q.Get("timeout"); s != "" {
+		if timeout, err = time.ParseDuration(s); err != nil || timeout < 0 {
+			return 0, 0, fmt.Errorf("invalid timeout %q", s)
+		}
+	}
+	return signal, timeout, nil
+}
+
+// restartClient restarts a client container.
+func (api *simAPI) restartClient(w http.ResponseWriter, r *http.Request) {
+	_, testID, err := api.requestSuiteAndTest(r)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-
 	node := mux.Vars(r)["node"]
-	nodeInfo, err := api.tm.GetNodeInfo(suiteID, testID, node)
-	if err != nil {
-		log15.Error("API: can't find node", "node", node, "error", err)
+
+	timeout := api.env.ClientStartTimeout
+	if timeout == 0 {
+		timeout = defaultStartTimeout
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	nodeInfo, err := api.tm.RestartNode(ctx, testID, node)
+	switch {
+	case err == ErrNoSuchNode:
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
-	}
-	output, err := api.backend.RunEnodeSh(r.Context(), nodeInfo.ID)
-	if err != nil {
-		log15.Error("API: error running enode.sh", "node", node, "error", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	case err == ErrNodeStopped:
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
-	}
-
-	// Check that the container returned a valid enode URL.
-	output = strings.TrimSpace(output)
-	n, err := enode.ParseV4(output)
-	if err != nil {
-		log15.Error("API: enode.sh returned bad URL", "node", node, "error", err)
+	case err == ErrNodeBusy:
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		log15.Error("API: could not restart client", "node", node, "error", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	tcpPort := n.TCP()
-	if tcpPort == 0 {
-		log15.Warn("API: enode.sh returned TCP port zero", "node", node, "client", nodeInfo.Name)
-		tcpPort = 30303
-	}
-	udpPort := n.UDP()
-	if udpPort == 0 {
-		log15.Warn("API: enode.sh returned UDP port zero", "node", node, "client", nodeInfo.Name)
-		udpPort = 30303
-	}
-
-	// Switch out the IP with the container's IP on the primary network.
-	// This is required because the client usually doesn't know its own IP.
-	fixedIP := enode.NewV4(n.Pubkey(), net.ParseIP(nodeInfo.IP), tcpPort, udpPort)
-	io.WriteString(w, fixedIP.URLv4())
+	log15.Info("API: client restarted", "node", node, "ip", nodeInfo.IP)
+	io.WriteString(w, nodeInfo.IP)
 }
 
-func (api *simAPI) execInClient(w http.ResponseWriter, r *http.Request) {
-	suiteID, testID, err := api.requestSuiteAndTest(r)
+// reconfigureClient restarts a client container with new client parameters.
+func (api *simAPI) reconfigureClient(w http.ResponseWriter, r *http.Request) {
+	_, testID, err := api.requestSuiteAndTest(r)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 	node := mux.Vars(r)["node"]
-	nodeInfo, err := api.tm.GetNodeInfo(suiteID, testID, node)
-	if err != nil {
+	if err := parseForm(r); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	env := make(map[string]string, len(r.PostForm))
+	for key, vals := range r.PostForm {
+		if !validEnvParam(key) {
+			http.Error(w, fmt.Sprintf("invalid client parameter %q", key), http.StatusBadRequest)
+			return
+		}
+		env[key] = vals[0]
+	}
+
+	timeout := api.env.ClientStartTimeout
+	if timeout == 0 {
+		timeout = defaultStartTimeout
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	nodeInfo, err := api.tm.ReconfigureNode(ctx, testID, node, env)
+	switch {
+	case err == ErrNoSuchNode:
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err == ErrNodeStopped, err == ErrNodeNotReconfigurable:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err == ErrNodeBusy:
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		log15.Error("API: could not reconfigure client", "node", node, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log15.Info("API: client reconfigured", "node", node, "ip", nodeInfo.IP)
+	io.WriteString(w, nodeInfo.IP)
+}
+
+// validEnvParam reports whether key is a client parameter that can be written to the
+// environment file, i.e. a shell variable name starting with HIVE_.
+func validEnvParam(key string) bool {
+	if !strings.HasPrefix(key, hiveEnvvarPrefix) {
+		return false
+	}
+	for _, c := range key {
+		if !(c == '_' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// pauseClient suspends a client container.
+func (api *simAPI) pauseClient(w http.ResponseWriter, r *http.Request) {
+	api.setClientPaused(w, r, true)
+}
+
+// unpauseClient resumes a paused client container.
+func (api *simAPI) unpauseClient(w http.ResponseWriter, r *http.Request) {
+	api.setClientPaused(w, r, false)
+}
+
+func (api *simAPI) setClientPaused(w http.ResponseWriter, r *http.Request, pause bool) {
+	suiteID, testID, err := api.requestSuiteAndTest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	node := mux.Vars(r)["node"]
+	nodeInfo, err := api.tm.GetNodeInfo(suiteID, testID, node)
+	if err != nil {
+		log15.Error("API: can't find node", "node", node, "error", err)
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if pause {
+		err = api.backend.PauseContainer(nodeInfo.ID)
+	} else {
+		err = api.backend.UnpauseContainer(nodeInfo.ID)
+	}
+	if err != nil {
+		log15.Error("API: can't change client pause state", "node", node, "pause", pause, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log15.Info("API: client pause state changed", "node", node, "paused", pause)
+}
+
+// signalClient sends a signal to the main process of a client container.
+func (api *simAPI) signalClient(w http.ResponseWriter, r *http.Request) {
+	suiteID, testID, err := api.requestSuiteAndTest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s := r.URL.Query().Get("signal")
+	if s == "" {
+		http.Error(w, "missing 'signal' in request", http.StatusBadRequest)
+		return
+	}
+	signal, err := ParseSignal(s)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	node := mux.Vars(r)["node"]
+	nodeInfo, err := api.tm.GetNodeInfo(suiteID, testID, node)
+	if err != nil {
+		log15.Error("API: can't find node", "node", node, "error", err)
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err := api.backend.SignalContainer(r.Context(), nodeInfo.ID, signal); err != nil {
+		log15.Error("API: can't signal client", "node", node, "signal", signal, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log15.Info("API: client signalled", "node", node, "signal", signal)
+}
+
+// stopAllClients terminates all client containers of a test. If some clients can't be
+// stopped, the response contains their errors.
+func (api *simAPI) stopAllClients(w http.ResponseWriter, r *http.Request) {
+	_, testID, err := api.requestSuiteAndTest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	failed, err := api.tm.StopAllNodes(testID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if len(failed) == 0 {
+		return
+	}
+	resp := stopClientsResponse{Errors: make(map[string]string, len(failed))}
+	for node, err := range failed {
+		log15.Error("API: can't stop client", "node", node, "error", err)
+		resp.Errors[node] = err.Error()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusInternalServerError)
+	json.NewEncoder(w).Encode(&resp)
+}
+
+// stopClientsResponse is sent when stopping clients fails.
+type stopClientsResponse struct {
+	Errors map[string]string `json:"errors"` // node ID -> error message
+}
+
+// getEnodeURL gets the enode URL of the client.
+func (api *simAPI) getEnodeURL(w http.ResponseWriter, r *http.Request) {
+	suiteID, testID, err := api.requestSuiteAndTest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	node := mux.Vars(r)["node"]
+	nodeInfo, err := api.tm.GetNodeInfo(suiteID, testID, node)
+	if err != nil {
+		log15.Error("API: can't find node", "node", node, "error", err)
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	output, err := api.backend.RunEnodeSh(r.Context(), nodeInfo.ID)
+	if err != nil {
+		log15.Error("API: error running enode.sh", "node", node, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Check that the container returned a valid enode URL.
+	output = strings.TrimSpace(output)
+	n, err := enode.ParseV4(output)
+	if err != nil {
+		log15.Error("API: enode.sh returned bad URL", "node", node, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	tcpPort := n.TCP()
+	if tcpPort == 0 {
+		log15.Warn("API: enode.sh returned TCP port zero", "node", node, "client", nodeInfo.Name)
+		tcpPort = 30303
+	}
+	udpPort := n.UDP()
+	if udpPort == 0 {
+		log15.Warn("API: enode.sh returned UDP port zero", "node", node, "client", nodeInfo.Name)
+		udpPort = 30303
+	}
+
+	// Switch out the IP with the container's IP on the primary network.
+	// This is required because the client usually doesn't know its own IP.
+	fixedIP := enode.NewV4(n.Pubkey(), net.ParseIP(nodeInfo.IP), tcpPort, udpPort)
+	io.WriteString(w, fixedIP.URLv4())
+}
+
+// getClientLogs streams the output of a client container.
+func (api *simAPI) getClientLogs(w http.ResponseWriter, r *http.Request) {
+	suiteID, testID, err := api.requestSuiteAndTest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	node := mux.Vars(r)["node"]
+	nodeInfo, err := api.tm.GetNodeInfo(suiteID, testID, node)
+	if err != nil {
+		log15.Error("API: can't find node", "node", node, "error", err)
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	var opt LogsOptions
+	query := r.URL.Query()
+	opt.Follow = query.Get("follow") != ""
+	if since := query.Get("since"); since != "" {
+		sec, err := strconv.ParseInt(since, 10, 64)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid 'since' timestamp %q", since), http.StatusBadRequest)
+			return
+		}
+		opt.Since = time.Unix(sec, 0)
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	if err := api.backend.ContainerLogs(r.Context(), nodeInfo.ID, opt, newFlushWriter(w)); err != nil {
+		log15.Error("API: can't get client logs", "node", node, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// inspectClient sends the docker inspect output of a client container.
+func (api *simAPI) inspectClient(w http.ResponseWriter, r *http.Request) {
+	suiteID, testID, err := api.requestSuiteAndTest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	node := mux.Vars(r)["node"]
+	nodeInfo, err := api.tm.GetNodeInfo(suiteID, testID, node)
+	if err != nil {
+		log15.Error("API: can't find node", "node", node, "error", err)
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	info, err := api.backend.InspectContainer(r.Context(), nodeInfo.ID)
+	if err != nil {
+		log15.Error("API: can't inspect client", "node", node, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(info)
+}
+
+// getClientState reports whether the main process of a client container is running.
+func (api *simAPI) getClientState(w http.ResponseWriter, r *http.Request) {
+	_, testID, err := api.requestSuiteAndTest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	node := mux.Vars(r)["node"]
+	state, err := api.tm.NodeState(r.Context(), testID, node)
+	switch {
+	case err == ErrNoSuchNode:
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err == ErrNodeStopped:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		log15.Error("API: can't get client state", "node", node, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(state)
+}
+
+// getClientStats sends resource usage statistics of a client container. If the 'stream'
+// query parameter is set, new samples are sent as they become available.
+func (api *simAPI) getClientStats(w http.ResponseWriter, r *http.Request) {
+	suiteID, testID, err := api.requestSuiteAndTest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	node := mux.Vars(r)["node"]
+	nodeInfo, err := api.tm.GetNodeInfo(suiteID, testID, node)
+	if err != nil {
+		log15.Error("API: can't find node", "node", node, "error", err)
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	stream := r.URL.Query().Get("stream") != ""
+	if !stream {
+		var sample *ContainerStats
+		err := api.backend.ContainerStats(r.Context(), nodeInfo.ID, false, func(s *ContainerStats) { sample = s })
+		if err == nil && sample == nil {
+			err = errors.New("no stats available")
+		}
+		if err != nil {
+			log15.Error("API: can't get client stats", "node", node, "error", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(sample)
+		return
+	}
+
+	// In stream mode, samples are sent as newline-delimited JSON.
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(newFlushWriter(w))
+	err = api.backend.ContainerStats(r.Context(), nodeInfo.ID, true, func(s *ContainerStats) { enc.Encode(s) })
+	if err != nil && r.Context().Err() == nil {
+		log15.Error("API: client stats stream failed", "node", node, "error", err)
+	}
+}
+
+// getClientFiles sends a file or directory from a client container. Regular files are
+// sent as-is, directories are sent as a TAR archive.
+func (api *simAPI) getClientFiles(w http.ResponseWriter, r *http.Request) {
+	suiteID, testID, err := api.requestSuiteAndTest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	node := mux.Vars(r)["node"]
+	nodeInfo, err := api.tm.GetNodeInfo(suiteID, testID, node)
+	if err != nil {
+		log15.Error("API: can't find node", "node", node, "error", err)
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	file := r.URL.Query().Get("path")
+	if !path.IsAbs(file) {
+		http.Error(w, "'path' must be an absolute path", http.StatusBadRequest)
+		return
+	}
+
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	go func() {
+		pw.CloseWithError(api.backend.DownloadFiles(r.Context(), nodeInfo.ID, file, pw))
+	}()
+
+	// The first entry of the archive tells whether the path is a regular file.
+	tr := tar.NewReader(pr)
+	header, err := tr.Next()
+	if err != nil {
+		log15.Error("API: can't download client files", "node", node, "path", file, "error", err)
+		http.Error(w, fmt.Sprintf("can't read %s: %v", file, err), http.StatusNotFound)
+		return
+	}
+	if header.Typeflag == tar.TypeReg {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", strconv.FormatInt(header.Size, 10))
+		io.Copy(w, tr)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-tar")
+	tw := tar.NewWriter(w)
+	for {
+		if err = tw.WriteHeader(header); err != nil {
+			break
+		}
+		if _, err = io.Copy(tw, tr); err != nil {
+			break
+		}
+		if header, err = tr.Next(); err != nil {
+			break
+		}
+	}
+	if err != io.EOF {
+		log15.Error("API: error sending client files", "node", node, "path", file, "error", err)
+		return
+	}
+	tw.Close()
+}
+
+// putClientFile writes the request body to a file in a client container.
+func (api *simAPI) putClientFile(w http.ResponseWriter, r *http.Request) {
+	suiteID, testID, err := api.requestSuiteAndTest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	node := mux.Vars(r)["node"]
+	nodeInfo, err := api.tm.GetNodeInfo(suiteID, testID, node)
+	if err != nil {
+		log15.Error("API: can't find node", "node", node, "error", err)
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	file := r.URL.Query().Get("path")
+	if !path.IsAbs(file) || strings.HasSuffix(file, "/") {
+		http.Error(w, "'path' must be an absolute file path", http.StatusBadRequest)
+		return
+	}
+
+	// The archive header needs the file size, so the content is read first. The archive
+	// is extracted in the root directory, which creates missing parent directories.
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "can't read request body", http.StatusBadRequest)
+		return
+	}
+	archive, err := fileArchive(file, 0644, data)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("can't write %s: %v", file, err), http.StatusInternalServerError)
+		return
+	}
+	if err := api.backend.UploadArchive(r.Context(), nodeInfo.ID, "/", archive); err != nil {
+		log15.Error("API: can't upload client file", "node", node, "path", file, "error", err)
+		http.Error(w, fmt.Sprintf("can't write %s: %v", file, err), http.StatusInternalServerError)
+		return
+	}
+	log15.Info("API: client file written", "node", node, "path", file, "size", len(data))
+}
+
+func (api *simAPI) execInClient(w http.ResponseWriter, r *http.Request) {
+	suiteID, testID, err := api.requestSuiteAndTest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	node := mux.Vars(r)["node"]
+	nodeInfo, err := api.tm.GetNodeInfo(suiteID, testID, node)
+	if err != nil {
 		log15.Error("API: can't find node", "node", node, "error", err)
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
 
 	// Parse and validate the exec request.
-	commandline, err := parseExecRequest(r.Body)
+	request, err := parseExecRequest(r.Body)
 	if err != nil {
 		log15.Error("API: invalid exec request", "node", node, "error", err)
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	info, err := api.backend.RunProgram(r.Context(), nodeInfo.ID, commandline)
-	if err != nil {
+	if request.Script != nil {
+		script, err := api.uploadScript(r.Context(), nodeInfo.ID, request.Script)
+		if err != nil {
+			log15.Error("API: can't upload exec script", "node", node, "error", err)
+			http.Error(w, fmt.Sprintf("can't upload script: %v", err), http.StatusInternalServerError)
+			return
+		}
+		defer api.removeScript(nodeInfo.ID, script)
+		request.Command = append([]string{script}, request.Command...)
+	}
+	if request.Stream {
+		api.execStreaming(w, r, nodeInfo, request)
+		return
+	}
+	if request.Detach {
+		api.execDetached(w, r, nodeInfo, request)
+		return
+	}
+	if request.Raw {
+		api.execRaw(w, r, nodeInfo, request)
+		return
+	}
+
+	var stdout, stderr bytes.Buffer
+	options := request.options()
+	options.Stdout, options.Stderr = &stdout, &stderr
+	exitCode, err := api.backend.RunProgram(r.Context(), nodeInfo.ID, options)
+	timedOut := err == ErrExecTimeout
+	if err != nil && !timedOut {
 		log15.Error("API: client script exec error", "node", node, "error", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	info := &ExecInfo{Stdout: stdout.String(), Stderr: stderr.String(), ExitCode: exitCode, TimedOut: timedOut}
 	json.NewEncoder(w).Encode(&info)
 }
 
-// parseExecRequest decodes and validates a client script exec request.
-func parseExecRequest(r io.Reader) ([]string, error) {
-	var request struct {
-		Command []string `json:"command"`
+// execStreaming runs a program in a client container, streaming its output to the
+// response as it is produced. The response is a sequence of JSON-encoded execFrame
+// objects, one per line. The last frame carries the exit code or an error.
+func (api *simAPI) execStreaming(w http.ResponseWriter, r *http.Request, nodeInfo *ClientInfo, request *execRequest) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	out := newExecFrameWriter(w)
+	options := request.options()
+	options.Stdout = out.stream(func(f *execFrame, s string) { f.Stdout = s })
+	options.Stderr = out.stream(func(f *execFrame, s string) { f.Stderr = s })
+	exitCode, err := api.backend.RunProgram(r.Context(), nodeInfo.ID, options)
+	timedOut := err == ErrExecTimeout
+	if err != nil && !timedOut {
+		log15.Error("API: client script exec error", "node", nodeInfo.ID, "error", err)
+		out.write(&execFrame{Error: err.Error()})
+		return
+	}
+	out.write(&execFrame{ExitCode: &exitCode, TimedOut: timedOut})
+}
+
+// These trailers of raw exec responses contain the result of the program.
+const (
+	execExitCodeTrailer = "X-HIVE-EXIT-CODE"
+	execTimedOutTrailer = "X-HIVE-TIMED-OUT"
+	execErrorTrailer    = "X-HIVE-ERROR"
+)
+
+// execRaw runs a program in a client container. The response body is the standard
+// output of the program as-is, its standard error is discarded. Since the result is
+// only known when the output is complete, it is sent in trailers.
+func (api *simAPI) execRaw(w http.ResponseWriter, r *http.Request, nodeInfo *ClientInfo, request *execRequest) {
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Trailer", strings.Join([]string{execExitCodeTrailer, execTimedOutTrailer, execErrorTrailer}, ", "))
+	options := request.options()
+	options.Stdout = w
+	exitCode, err := api.backend.RunProgram(r.Context(), nodeInfo.ID, options)
+	timedOut := err == ErrExecTimeout
+	if err != nil && !timedOut {
+		log15.Error("API: client script exec error", "node", nodeInfo.ID, "error", err)
+		w.Header().Set(execErrorTrailer, strings.ReplaceAll(err.Error(), "\n", " "))
+		return
+	}
+	w.Header().Set(execExitCodeTrailer, strconv.Itoa(exitCode))
+	if timedOut {
+		w.Header().Set(execTimedOutTrailer, "true")
+	}
+}
+
+// execDetached starts a program in a client container without waiting for it to exit.
+// The response contains the exec ID, which identifies the program in status and kill
+// requests.
+func (api *simAPI) execDetached(w http.ResponseWriter, r *http.Request, nodeInfo *ClientInfo, request *execRequest) {
+	execID, err := api.backend.StartProgram(r.Context(), nodeInfo.ID, request.options())
+	if err != nil {
+		log15.Error("API: client script exec error", "node", nodeInfo.ID, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log15.Info("API: detached exec started", "node", nodeInfo.ID, "exec", execID)
+	json.NewEncoder(w).Encode(map[string]string{"id": execID})
+}
+
+// execStatus returns the state of a program started by a detached exec request.
+func (api *simAPI) execStatus(w http.ResponseWriter, r *http.Request) {
+	nodeInfo, ok := api.execNode(w, r)
+	if !ok {
+		return
+	}
+	execID := mux.Vars(r)["exec"]
+	status, err := api.backend.ProgramStatus(r.Context(), nodeInfo.ID, execID)
+	if err != nil {
+		api.execError(w, execID, err)
+		return
+	}
+	json.NewEncoder(w).Encode(status)
+}
+
+// execKill kills a program started by a detached exec request.
+func (api *simAPI) execKill(w http.ResponseWriter, r *http.Request) {
+	nodeInfo, ok := api.execNode(w, r)
+	if !ok {
+		return
 	}
+	execID := mux.Vars(r)["exec"]
+	if err := api.backend.KillProgram(r.Context(), nodeInfo.ID, execID); err != nil {
+		api.execError(w, execID, err)
+		return
+	}
+	log15.Info("API: detached exec killed", "node", nodeInfo.ID, "exec", execID)
+}
+
+// execNode finds the client of an exec status or kill request.
+func (api *simAPI) execNode(w http.ResponseWriter, r *http.Request) (*ClientInfo, bool) {
+	suiteID, testID, err := api.requestSuiteAndTest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	node := mux.Vars(r)["node"]
+	nodeInfo, err := api.tm.GetNodeInfo(suiteID, testID, node)
+	if err != nil {
+		log15.Error("API: can't find node", "node", node, "error", err)
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return nil, false
+	}
+	return nodeInfo, true
+}
+
+// execError writes the response for a failed exec status or kill request.
+func (api *simAPI) execError(w http.ResponseWriter, execID string, err error) {
+	if err == ErrNoSuchExec {
+		http.Error(w, fmt.Sprintf("no such exec %q", execID), http.StatusNotFound)
+		return
+	}
+	log15.Error("API: detached exec error", "exec", execID, "error", err)
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+// execRequest is the body of a client script exec request.
+type execRequest struct {
+	Command []string          `json:"command"`
+	Script  []byte            `json:"script"` // if set, Command contains the script arguments
+	Stdin   []byte            `json:"stdin"`
+	Stream  bool              `json:"stream"`
+	Detach  bool              `json:"detach"`
+	Raw     bool              `json:"raw"`
+	Timeout string            `json:"timeout"`
+	WorkDir string            `json:"workdir"`
+	Env     map[string]string `json:"env"`
+	User    string            `json:"user"`
+	Group   string            `json:"group"`
+
+	timeout time.Duration
+}
+
+// options returns the backend options for running the requested command.
+func (req *execRequest) options() ExecOptions {
+	opt := ExecOptions{Cmd: req.Command, Timeout: req.timeout, WorkDir: req.WorkDir, Env: req.Env, User: req.User}
+	if req.Group != "" {
+		opt.User += ":" + req.Group
+	}
+	if req.Stdin != nil {
+		opt.Stdin = bytes.NewReader(req.Stdin)
+	}
+	return opt
+}
+
+// parseExecRequest decodes and validates a client script exec request.
+func parseExecRequest(r io.Reader) (*execRequest, error) {
+	var request execRequest
 	if err := json.NewDecoder(r).Decode(&request); err != nil {
 		return nil, fmt.Errorf("invalid JSON: %v", err)
 	}
-	if len(request.Command) == 0 {
+	if request.Script != nil {
+		if len(request.Script) == 0 {
+			return nil, errors.New("empty script")
+		}
+		if request.Detach {
+			return nil, errors.New("detached exec does not support scripts")
+		}
+	} else {
+		cmd, err := hiveBinCommand(request.Command)
+		if err != nil {
+			return nil, err
+		}
+		request.Command = cmd
+	}
+	if request.Timeout != "" {
+		timeout, err := time.ParseDuration(request.Timeout)
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("invalid timeout %q", request.Timeout)
+		}
+		request.timeout = timeout
+	}
+	if request.WorkDir != "" && !path.IsAbs(request.WorkDir) {
+		return nil, fmt.Errorf("working directory %q is not an absolute path", request.WorkDir)
+	}
+	if strings.Contains(request.User, ":") || strings.Contains(request.Group, ":") {
+		return nil, errors.New("user and group must not contain ':'")
+	}
+	if request.Group != "" && request.User == "" {
+		return nil, errors.New("group requires user")
+	}
+	for key := range request.Env {
+		if key == "" || strings.ContainsAny(key, "=\x00") {
+			return nil, fmt.Errorf("invalid environment variable name %q", key)
+		}
+	}
+	if request.Detach && (request.Stream || request.Stdin != nil || request.timeout != 0) {
+		return nil, errors.New("detached exec does not support stream, stdin or timeout")
+	}
+	if request.Raw && (request.Stream || request.Detach) {
+		return nil, errors.New("raw exec does not support stream or detach")
+	}
+	return &request, nil
+}
+
+// hiveBinCommand validates a command which runs a script in the /hive-bin
+// directory of a client container, and returns it with the full script path.
+func hiveBinCommand(cmd []string) ([]string, error) {
+	if len(cmd) == 0 {
 		return nil, errors.New("empty command")
 	}
-	script := request.Command[0]
+	script := cmd[0]
 	if strings.Contains(script, "/") {
 		return nil, errors.New("script name must not contain directory separator")
 	}
-	request.Command[0] = "/hive-bin/" + script
-	return request.Command, nil
+	return append([]string{"/hive-bin/" + script}, cmd[1:]...), nil
+}
+
+// uploadScript writes a script sent with an exec request into a client container
+// and returns its path.
+func (api *simAPI) uploadScript(ctx context.Context, containerID string, script []byte) (string, error) {
+	name := make([]byte, 8)
+	if _, err := rand.Read(name); err != nil {
+		return "", err
+	}
+	file := "/tmp/hive-script-" + hex.EncodeToString(name)
+
+	archive, err := fileArchive(file, 0755, script)
+	if err != nil {
+		return "", err
+	}
+	if err := api.backend.UploadArchive(ctx, containerID, "/", archive); err != nil {
+		return "", err
+	}
+	return file, nil
+}
+
+// fileArchive creates a TAR archive containing a single file. The archive is meant to be
+// extracted in the root directory, so file must be an absolute path.
+func fileArchive(file string, mode int64, data []byte) (*bytes.Buffer, error) {
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	hdr := &tar.Header{Name: strings.TrimPrefix(file, "/"), Mode: mode, Size: int64(len(data))}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return nil, err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return &archive, nil
+}
+
+// removeScript deletes a script uploaded by uploadScript. This also runs when the
+// exec request was cancelled.
+func (api *simAPI) removeScript(containerID, file string) {
+	opt := ExecOptions{Cmd: []string{"rm", "-f", file}}
+	if _, err := api.backend.RunProgram(context.Background(), containerID, opt); err != nil {
+		log15.Error("API: can't remove exec script", "container", containerID, "path", file, "error", err)
+	}
+}
+
+// uploadCreate creates an upload session.
+func (api *simAPI) uploadCreate(w http.ResponseWriter, r *http.Request) {
+	suiteID, err := api.requestSuite(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	id, err := api.tm.CreateUpload(suiteID)
+	if err != nil {
+		log15.Error("API: can't create upload", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log15.Info("API: upload created", "suite", suiteID, "upload", id)
+	io.WriteString(w, id)
+}
+
+// uploadSize returns the number of bytes received for an upload.
+func (api *simAPI) uploadSize(w http.ResponseWriter, r *http.Request) {
+	suiteID, err := api.requestSuite(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	size, err := api.tm.UploadSize(suiteID, mux.Vars(r)["upload"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	fmt.Fprint(w, size)
+}
+
+// uploadAppend adds the request body to an upload. The offset query parameter
+// must match the number of bytes received so far.
+func (api *simAPI) uploadAppend(w http.ResponseWriter, r *http.Request) {
+	suiteID, err := api.requestSuite(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	id := mux.Vars(r)["upload"]
+	offset, err := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
+	if err != nil || offset < 0 {
+		http.Error(w, "invalid offset", http.StatusBadRequest)
+		return
+	}
+	size, err := api.tm.AppendUpload(suiteID, id, offset, r.Body)
+	switch {
+	case err == ErrNoSuchUpload:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case err == ErrUploadOffset:
+		http.Error(w, fmt.Sprintf("%v (%d bytes received)", err, size), http.StatusConflict)
+	case err != nil:
+		log15.Error("API: upload failed", "upload", id, "size", size, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		fmt.Fprint(w, size)
+	}
+}
+
+// uploadRemove deletes an upload.
+func (api *simAPI) uploadRemove(w http.ResponseWriter, r *http.Request) {
+	suiteID, err := api.requestSuite(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	id := mux.Vars(r)["upload"]
+	if err := api.tm.RemoveUpload(suiteID, id); err == ErrNoSuchUpload {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		log15.Error("API: can't remove upload", "upload", id, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log15.Info("API: upload removed", "suite", suiteID, "upload", id)
 }
 
 // networkCreate creates a docker network.
@@ -428,16 +1857,68 @@ func (api *simAPI) networkCreate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	networkName := mux.Vars(r)["network"]
-	err = api.tm.CreateNetwork(suiteID, networkName)
+	opt, err := parseNetworkOptions(r.URL.Query())
 	if err != nil {
-		log15.Error("API: failed to create network", "network", networkName, "error", err)
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	err = api.tm.CreateNetwork(suiteID, networkName, opt)
+	if err != nil {
+		log15.Error("API: failed to create network", "network", networkName, "error", err)
+		if err == ErrNetworkExists {
+			http.Error(w, err.Error(), http.StatusConflict)
+		} else {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+		return
+	}
 	log15.Info("API: network created", "name", networkName)
 	fmt.Fprint(w, "success")
 }
 
+// networkList lists the networks of a test suite.
+func (api *simAPI) networkList(w http.ResponseWriter, r *http.Request) {
+	suiteID, err := api.requestSuite(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	names, err := api.tm.Networks(suiteID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(names)
+}
+
+// parseNetworkOptions reads the query parameters of a network creation request.
+func parseNetworkOptions(q url.Values) (NetworkOptions, error) {
+	opt := NetworkOptions{Subnet: q.Get("subnet"), Gateway: q.Get("gateway")}
+	if v := q.Get("internal"); v != "" {
+		internal, err := strconv.ParseBool(v)
+		if err != nil {
+			return opt, fmt.Errorf("invalid value %q for internal", v)
+		}
+		opt.Internal = internal
+	}
+	if opt.Subnet != "" {
+		if _, _, err := net.ParseCIDR(opt.Subnet); err != nil {
+			return opt, fmt.Errorf("invalid subnet %q", opt.Subnet)
+		}
+	}
+	if opt.Gateway != "" {
+		if opt.Subnet == "" {
+			return opt, fmt.Errorf("gateway requires subnet")
+		}
+		if net.ParseIP(opt.Gateway) == nil {
+			return opt, fmt.Errorf("invalid gateway %q", opt.Gateway)
+		}
+	}
+	return opt, nil
+}
+
 // networkRemove removes a docker network.
 func (api *simAPI) networkRemove(w http.ResponseWriter, r *http.Request) {
 	suiteID, err := api.requestSuite(r)
@@ -470,13 +1951,44 @@ func (api *simAPI) networkIPGet(w http.ResponseWriter, r *http.Request) {
 	ipAddr, err := api.tm.ContainerIP(suiteID, network, node)
 	if err != nil {
 		log15.Error("API: failed to get container IP", "container", node, "error", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		switch err {
+		case ErrNetworkNotFound:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case ErrNotAttached:
+			http.Error(w, err.Error(), http.StatusNotFound)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
 		return
 	}
 	log15.Info("API: container IP requested", "network", network, "container", node, "ip", ipAddr)
 	fmt.Fprint(w, ipAddr)
 }
 
+// networkIPs gets the IP addresses of all containers on a network.
+func (api *simAPI) networkIPs(w http.ResponseWriter, r *http.Request) {
+	suiteID, err := api.requestSuite(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	network := mux.Vars(r)["network"]
+	ips, err := api.tm.NetworkIPs(suiteID, network)
+	if err != nil {
+		log15.Error("API: failed to get network IPs", "network", network, "error", err)
+		if err == ErrNetworkNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	log15.Info("API: network IPs requested", "network", network, "containers", len(ips))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ips)
+}
+
 // networkConnect connects a container to a network.
 func (api *simAPI) networkConnect(w http.ResponseWriter, r *http.Request) {
 	suiteID, err := api.requestSuite(r)
@@ -487,12 +1999,13 @@ func (api *simAPI) networkConnect(w http.ResponseWriter, r *http.Request) {
 
 	name := mux.Vars(r)["network"]
 	containerID := mux.Vars(r)["node"]
-	if err := api.tm.ConnectContainer(suiteID, name, containerID); err != nil {
+	aliases := r.URL.Query()["alias"]
+	if err := api.tm.ConnectContainer(suiteID, name, containerID, aliases...); err != nil {
 		log15.Error("API: failed to connect container", "network", name, "container", containerID, "error", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	log15.Info("API: container connected to network", "network", name, "container", containerID)
+	log15.Info("API: container connected to network", "network", name, "container", containerID, "aliases", aliases)
 }
 
 // networkDisconnect disconnects a container from a network.
@@ -513,6 +2026,79 @@ func (api *simAPI) networkDisconnect(w http.ResponseWriter, r *http.Request) {
 	log15.Info("API: container disconnected", "network", network, "container", containerID)
 }
 
+// networkShape applies traffic shaping to the containers of a network.
+func (api *simAPI) networkShape(w http.ResponseWriter, r *http.Request) {
+	suiteID, err := api.requestSuite(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	network := mux.Vars(r)["network"]
+	opt, err := parseNetworkShaping(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	api.shapeNetwork(w, r, suiteID, network, opt)
+}
+
+// networkUnshape removes traffic shaping from the containers of a network.
+func (api *simAPI) networkUnshape(w http.ResponseWriter, r *http.Request) {
+	suiteID, err := api.requestSuite(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	api.shapeNetwork(w, r, suiteID, mux.Vars(r)["network"], NetworkShaping{})
+}
+
+func (api *simAPI) shapeNetwork(w http.ResponseWriter, r *http.Request, suiteID TestSuiteID, network string, opt NetworkShaping) {
+	if err := api.tm.ShapeNetwork(r.Context(), suiteID, network, opt); err != nil {
+		log15.Error("API: network shaping failed", "network", network, "error", err)
+		if err == ErrNetworkNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	log15.Info("API: network shaping applied", "network", network, "latency", opt.Latency, "jitter", opt.Jitter, "loss", opt.Loss, "rate", opt.Rate)
+	fmt.Fprint(w, "success")
+}
+
+// parseNetworkShaping reads the query parameters of a network shaping request.
+func parseNetworkShaping(q url.Values) (NetworkShaping, error) {
+	var (
+		opt NetworkShaping
+		err error
+	)
+	for _, d := range []struct {
+		name string
+		dst  *time.Duration
+	}{{"latency", &opt.Latency}, {"jitter", &opt.Jitter}} {
+		if v := q.Get(d.name); v != "" {
+			if *d.dst, err = time.ParseDuration(v); err != nil || *d.dst < 0 {
+				return opt, fmt.Errorf("invalid %s %q", d.name, v)
+			}
+		}
+	}
+	if opt.Jitter > 0 && opt.Latency == 0 {
+		return opt, fmt.Errorf("jitter requires latency")
+	}
+	if v := q.Get("loss"); v != "" {
+		if opt.Loss, err = strconv.ParseFloat(v, 64); err != nil || opt.Loss < 0 || opt.Loss > 100 {
+			return opt, fmt.Errorf("invalid loss %q, must be a percentage", v)
+		}
+	}
+	if v := q.Get("rate"); v != "" {
+		if opt.Rate, err = strconv.ParseUint(v, 10, 64); err != nil {
+			return opt, fmt.Errorf("invalid rate %q", v)
+		}
+	}
+	return opt, nil
+}
+
 // requestSuite returns the suite ID from the request body and checks that
 // it corresponds to a running suite.
 func (api *simAPI) requestSuite(r *http.Request) (TestSuiteID, error) {
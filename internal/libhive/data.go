@@ -28,6 +28,8 @@ type TestSuite struct {
 	TestCases      map[TestID]*TestCase `json:"testCases"`
 	// the log-file pertaining to the simulator. (may encompass more than just one TestSuite)
 	SimulatorLog string `json:"simLog"`
+	// files attached to the suite, e.g. reports covering all test cases
+	Attachments map[string]string `json:"attachments,omitempty"` // Attachment name -> file path.
 }
 
 // TestCase represents a single test case in a test suite.
@@ -36,8 +38,12 @@ type TestCase struct {
 	Description   string                 `json:"description"` // Test case long description in MD.
 	Start         time.Time              `json:"start"`
 	End           time.Time              `json:"end"`
-	SummaryResult TestResult             `json:"summaryResult"` // The result of the whole test case.
-	ClientInfo    map[string]*ClientInfo `json:"clientInfo"`    // Info about each client.
+	SummaryResult TestResult             `json:"summaryResult"`         // The result of the whole test case.
+	ClientInfo    map[string]*ClientInfo `json:"clientInfo"`            // Info about each client.
+	Attachments   map[string]string      `json:"attachments,omitempty"` // Attachment name -> file path.
+	Labels        map[string]string      `json:"labels,omitempty"`      // Labels for filtering, e.g. category.
+
+	outputDir string // output directory of the simulator, relative to the log directory
 }
 
 // TestResult is the payload submitted to the EndTest endpoint.
@@ -54,7 +60,29 @@ type ClientInfo struct {
 	InstantiatedAt time.Time `json:"instantiatedAt"`
 	LogFile        string    `json:"logFile"` //Absolute path to the logfile.
 
-	wait func()
+	checkLive bool // wait for the client to open its RPC port when restarting
+	wait      func()
+	busy      bool              // set while the container is stopping or restarting
+	stopState *ContainerState   // state before the container was stopped
+	envFile   string            // environment file loaded by the entrypoint, if any
+	env       map[string]string // environment set by reconfiguring the client
+}
+
+// ContainerStats is a resource usage sample of a client container.
+type ContainerStats struct {
+	Time           time.Time `json:"time"`
+	CPUPercent     float64   `json:"cpuPercent"`
+	MemoryUsage    uint64    `json:"memoryUsage"`
+	MemoryLimit    uint64    `json:"memoryLimit"`
+	NetworkRxBytes uint64    `json:"networkRxBytes"`
+	NetworkTxBytes uint64    `json:"networkTxBytes"`
+}
+
+// ProgramStatus is the state of a command running in the background of a client
+// container. The exit code is set when the command is no longer running.
+type ProgramStatus struct {
+	Running  bool `json:"running"`
+	ExitCode int  `json:"exitCode"`
 }
 
 // ExecInfo is the result of running a script in a client container.
@@ -62,4 +90,5 @@ type ExecInfo struct {
 	Stdout   string `json:"stdout"`
 	Stderr   string `json:"stderr"`
 	ExitCode int    `json:"exitCode"`
+	TimedOut bool   `json:"timedOut,omitempty"`
 }
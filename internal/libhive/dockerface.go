@@ -3,8 +3,10 @@ package libhive
 import (
 	"context"
 	"fmt"
+	"io"
 	"mime/multipart"
 	"net"
+	"time"
 )
 
 // ContainerBackend captures the docker interactions of the simulation API.
@@ -14,35 +16,205 @@ type ContainerBackend interface {
 	StartContainer(ctx context.Context, containerID string, opt ContainerOptions) (*ContainerInfo, error)
 	DeleteContainer(containerID string) error
 
+	// StopContainer sends a signal to the main process of a container and waits for
+	// it to exit. If the container is still running after the timeout, it is killed.
+	StopContainer(ctx context.Context, containerID string, opt StopOptions) error
+
+	// RestartContainer stops a running container and starts it again. The filesystem
+	// of the container is preserved and its output is appended to opt.LogFile. If the
+	// container can't be stopped, the error wraps ErrContainerNotStopped.
+	RestartContainer(ctx context.Context, containerID string, opt ContainerOptions) (*ContainerInfo, error)
+
+	// PauseContainer suspends all processes in the given container. UnpauseContainer
+	// resumes them. Both methods succeed if the container is already in the requested state.
+	PauseContainer(containerID string) error
+	UnpauseContainer(containerID string) error
+
+	// SignalContainer sends a signal to the main process of a container without
+	// waiting for it to exit.
+	SignalContainer(ctx context.Context, containerID string, signal int) error
+
+	// ContainerState returns whether the main process of a container is running.
+	ContainerState(ctx context.Context, containerID string) (*ContainerState, error)
+
+	// ContainerLogs writes the output of the given container to w.
+	ContainerLogs(ctx context.Context, containerID string, opt LogsOptions, w io.Writer) error
+
+	// DownloadFiles writes a TAR archive of the given file or directory in the
+	// container to w.
+	DownloadFiles(ctx context.Context, containerID, path string, w io.Writer) error
+
+	// UploadArchive extracts a TAR archive into the given directory of the container.
+	UploadArchive(ctx context.Context, containerID, dir string, archive io.Reader) error
+
+	// ContainerStats samples the resource usage of a container and calls fn with the
+	// result. If stream is set, fn is called for every new sample until ctx is done or
+	// the container exits.
+	ContainerStats(ctx context.Context, containerID string, stream bool, fn func(*ContainerStats)) error
+
+	// InspectContainer returns the low-level information about a container,
+	// i.e. the output of 'docker inspect', encoded as JSON.
+	InspectContainer(ctx context.Context, containerID string) ([]byte, error)
+
 	// RunEnodeSh runs the /enode.sh script in the given container and returns its output.
 	RunEnodeSh(ctx context.Context, containerID string) (string, error)
 
-	// RunProgram runs a command in the given container and returns its outputs and exit code.
-	RunProgram(ctx context.Context, containerID string, cmdline []string) (*ExecInfo, error)
+	// RunProgram runs a command in the given container and returns its exit code.
+	// The output of the command is written to the streams given in opt.
+	RunProgram(ctx context.Context, containerID string, opt ExecOptions) (int, error)
+
+	// StartProgram starts a command in the given container and returns its exec ID
+	// without waiting for the command to exit. The output of the command is discarded.
+	StartProgram(ctx context.Context, containerID string, opt ExecOptions) (string, error)
+
+	// ProgramStatus returns the state of a command started by StartProgram.
+	ProgramStatus(ctx context.Context, containerID, execID string) (*ProgramStatus, error)
+
+	// KillProgram kills a command started by StartProgram.
+	KillProgram(ctx context.Context, containerID, execID string) error
 
 	// These methods configure docker networks.
 	NetworkNameToID(name string) (string, error)
-	CreateNetwork(name string) (string, error)
+	CreateNetwork(name string, opt NetworkOptions) (string, error)
 	RemoveNetwork(id string) error
 	ContainerIP(containerID, networkID string) (net.IP, error)
-	ConnectContainer(containerID, networkID string) error
+	NetworkIPs(networkID string) (map[string]net.IP, error)
+	ConnectContainer(containerID, networkID string, aliases ...string) error
 	DisconnectContainer(containerID, networkID string) error
+
+	// ShapeContainer applies traffic shaping to the interface of a container on the
+	// given network. Shaping with the zero NetworkShaping removes it.
+	ShapeContainer(ctx context.Context, containerID, networkID string, opt NetworkShaping) error
 }
 
 // This error is returned by NetworkNameToID if a docker network is not present.
 var ErrNetworkNotFound = fmt.Errorf("network not found")
 
+// This error is returned by CreateNetwork if the test suite already has a
+// network with the same name.
+var ErrNetworkExists = fmt.Errorf("network already exists")
+
+// This error is returned by ContainerIP if the container is not connected
+// to the network.
+var ErrNotAttached = fmt.Errorf("container is not attached to network")
+
+// This error is returned by ProgramStatus and KillProgram if the container
+// has no command with the given exec ID.
+var ErrNoSuchExec = fmt.Errorf("no such exec")
+
+// This error is wrapped by RestartContainer if the container could not be
+// stopped. The container is still running in this case.
+var ErrContainerNotStopped = fmt.Errorf("container could not be stopped")
+
+// This error is returned by RunProgram if the command was killed because
+// it exceeded its timeout.
+var ErrExecTimeout = fmt.Errorf("command timed out")
+
+// Client files can be uploaded as archives, which are extracted into the root directory
+// of the container. The archive type is set in the FileTypeHeader of the multipart file.
+const (
+	FileTypeHeader  = "X-HIVE-FILETYPE"
+	FileTypeTAR     = "TAR"
+	FileTypeTARGzip = "TAR_GZ"
+)
+
 // ContainerOptions contains the launch parameters for docker containers.
 type ContainerOptions struct {
 	// These options apply when creating the container.
-	Env   map[string]string
-	Files map[string]*multipart.FileHeader
+	Env        map[string]string
+	Files      map[string]*multipart.FileHeader
+	Labels     map[string]string
+	Privileged bool     // run the container in privileged mode
+	CapAdd     []string // Linux capabilities added to the container
+	Memory     int64    // memory limit in bytes, zero means unlimited
+	NanoCPUs   int64    // CPU limit in units of 1e-9 CPUs, zero means unlimited
+	Ulimits    []Ulimit // resource limits of processes in the container
+	Mounts     []Mount  // named volumes mounted into the container
+
+	// If set, the container is not connected to the default bridge network.
+	// It can only be reached through networks it is connected to explicitly.
+	NoDefaultNetwork bool
+
+	// If set, the entrypoint of the image is wrapped to load environment variables
+	// from this file when it exists. This allows changing the environment of the
+	// container between restarts. The image must provide /bin/sh.
+	EnvFile string
 
 	// These options apply when starting the container.
 	CheckLive bool   // requests check for TCP port 8545
 	LogFile   string // if set, container output is written to this file
 }
 
+// Ulimit is a process resource limit, e.g. "nofile" for the number of open files.
+type Ulimit struct {
+	Name string
+	Soft int64
+	Hard int64
+}
+
+// Mount describes a named docker volume or a host directory mounted into a container.
+type Mount struct {
+	Volume   string // name of an existing volume
+	HostDir  string // absolute path of a host directory, used instead of Volume
+	Target   string // absolute path in the container
+	ReadOnly bool
+}
+
+// ExecOptions contains the parameters for running a command in a container.
+type ExecOptions struct {
+	Cmd     []string
+	Stdin   io.Reader // if non-nil, this is sent to the command's standard input
+	WorkDir string    // working directory of the command, defaults to the container's
+	User    string    // user and optional group, e.g. "nobody:nogroup", defaults to the container's
+
+	// Environment variables of the command. They are added to the environment of the
+	// container for this command only.
+	Env map[string]string
+
+	// If set, the command is killed when it runs longer than this.
+	// RunProgram returns ErrExecTimeout in that case.
+	Timeout time.Duration
+
+	// Output streams of the command. If nil, the output is discarded.
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// ContainerState describes the state of a container's main process.
+type ContainerState struct {
+	Running  bool `json:"running"`
+	ExitCode int  `json:"exitCode"` // only valid when the process is not running
+}
+
+// StopOptions configures graceful shutdown of a container.
+type StopOptions struct {
+	Signal  int           // signal number, defaults to SIGTERM
+	Timeout time.Duration // time to wait for exit before the container is killed
+}
+
+// NetworkOptions contains the parameters for creating docker networks.
+// If Subnet is empty, docker assigns an address range.
+type NetworkOptions struct {
+	Subnet   string // IP range in CIDR notation, e.g. "10.1.0.0/16"
+	Gateway  string // gateway IP, requires Subnet
+	Internal bool   // if set, the network has no external connectivity
+}
+
+// NetworkShaping configures traffic shaping of a network. It applies to packets sent by
+// the containers on the network. The zero value disables shaping.
+type NetworkShaping struct {
+	Latency time.Duration // delay added to every packet
+	Jitter  time.Duration // random variation of the delay, requires Latency
+	Loss    float64       // percentage of dropped packets
+	Rate    uint64        // bandwidth limit in bits per second, zero means unlimited
+}
+
+// LogsOptions configures ContainerLogs.
+type LogsOptions struct {
+	Follow bool      // if set, output is streamed until the container exits or ctx is done
+	Since  time.Time // if non-zero, only output produced after this time is returned
+}
+
 // ContainerInfo is returned by StartContainer.
 type ContainerInfo struct {
 	ID      string // docker container ID
@@ -58,7 +230,9 @@ type ContainerInfo struct {
 
 // ClientMetadata is metadata to describe the client in more detail, configured with a YAML file in the client dir.
 type ClientMetadata struct {
-	Roles []string `yaml:"roles" json:"roles"`
+	Roles []string          `yaml:"roles" json:"roles"`
+	Info  map[string]string `yaml:"info" json:"info,omitempty"`
+	Ports []int             `yaml:"ports" json:"ports,omitempty"`
 }
 
 // Builder can build docker images of clients and simulators.
@@ -67,6 +241,13 @@ type Builder interface {
 	BuildClientImage(ctx context.Context, name string) (string, error)
 	BuildSimulatorImage(ctx context.Context, name string) (string, error)
 
+	// BuildClientImageWithArgs builds a variant of a client image using the given docker
+	// build arguments. Each combination of arguments has its own image tag.
+	BuildClientImageWithArgs(ctx context.Context, name string, args map[string]string) (string, error)
+
+	// PullImage pulls an image from its registry, unless it is already present.
+	PullImage(ctx context.Context, ref string) error
+
 	// ReadFile returns the content of a file in the given image.
 	ReadFile(image, path string) ([]byte, error)
 }
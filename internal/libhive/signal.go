@@ -0,0 +1,41 @@
+package libhive
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// signalNumbers maps Linux signal names to their numbers. Clients always run in Linux
+// containers, so these are used regardless of the host platform.
+var signalNumbers = map[string]int{
+	"SIGHUP":  1,
+	"SIGINT":  2,
+	"SIGQUIT": 3,
+	"SIGABRT": 6,
+	"SIGKILL": 9,
+	"SIGUSR1": 10,
+	"SIGUSR2": 12,
+	"SIGTERM": 15,
+	"SIGCONT": 18,
+	"SIGSTOP": 19,
+}
+
+// ParseSignal parses a signal name like "SIGTERM" or "TERM", or a signal number.
+func ParseSignal(s string) (int, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		if n <= 0 || n > 64 {
+			return 0, fmt.Errorf("invalid signal number %d", n)
+		}
+		return n, nil
+	}
+	name := strings.ToUpper(s)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+	n, ok := signalNumbers[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown signal %q", s)
+	}
+	return n, nil
+}
@@ -0,0 +1,84 @@
+package libhive
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// execFrame is a frame of streamed program output.
+type execFrame struct {
+	Stdout   string `json:"stdout,omitempty"`
+	Stderr   string `json:"stderr,omitempty"`
+	ExitCode *int   `json:"exitCode,omitempty"`
+	TimedOut bool   `json:"timedOut,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// execFrameWriter encodes program output frames to an HTTP response, flushing
+// the response after every frame.
+type execFrameWriter struct {
+	mu    sync.Mutex
+	enc   *json.Encoder
+	flush func()
+}
+
+func newExecFrameWriter(w http.ResponseWriter) *execFrameWriter {
+	fw := &execFrameWriter{enc: json.NewEncoder(w), flush: func() {}}
+	if f, ok := w.(http.Flusher); ok {
+		fw.flush = f.Flush
+	}
+	return fw
+}
+
+// write sends a single frame.
+func (fw *execFrameWriter) write(f *execFrame) error {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	if err := fw.enc.Encode(f); err != nil {
+		return err
+	}
+	fw.flush()
+	return nil
+}
+
+// stream returns a writer that sends everything written to it as frames.
+// The set function assigns the written data to a field of the frame.
+func (fw *execFrameWriter) stream(set func(*execFrame, string)) io.Writer {
+	return execStreamWriter{fw, set}
+}
+
+type execStreamWriter struct {
+	fw  *execFrameWriter
+	set func(*execFrame, string)
+}
+
+func (w execStreamWriter) Write(p []byte) (int, error) {
+	var f execFrame
+	w.set(&f, string(p))
+	if err := w.fw.write(&f); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// flushWriter flushes the HTTP response after every write.
+type flushWriter struct {
+	w     io.Writer
+	flush func()
+}
+
+func newFlushWriter(w http.ResponseWriter) io.Writer {
+	fw := &flushWriter{w: w, flush: func() {}}
+	if f, ok := w.(http.Flusher); ok {
+		fw.flush = f.Flush
+	}
+	return fw
+}
+
+func (fw *flushWriter) Write(p []byte) (int, error) {
+	n, err := fw.w.Write(p)
+	fw.flush()
+	return n, err
+}
@@ -1,14 +1,19 @@
 package libhive
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -17,6 +22,9 @@ import (
 
 var (
 	ErrNoSuchNode               = errors.New("no such node")
+	ErrNodeStopped              = errors.New("node is stopped")
+	ErrNodeBusy                 = errors.New("node is being stopped or restarted")
+	ErrNodeNotReconfigurable    = errors.New("node can't be reconfigured")
 	ErrNoSuchTestSuite          = errors.New("no such test suite")
 	ErrNoSuchTestCase           = errors.New("no such test case")
 	ErrMissingClientType        = errors.New("missing client type")
@@ -26,6 +34,7 @@ var (
 	ErrNoSummaryResult          = errors.New("test case must be ended with a summary result")
 	ErrDBUpdateFailed           = errors.New("could not update results set")
 	ErrTestSuiteLimited         = errors.New("testsuite test count is limited")
+	ErrNoBuilder                = errors.New("client image builds are not supported")
 )
 
 // ClientDefinition is served by the /clients API endpoint to list the available clients
@@ -62,12 +71,24 @@ type TestManager struct {
 	simContainerID string
 	simLogFile     string
 
+	// builder and the images built for client build arguments, where key
+	// is the client name and encoded arguments
+	builder      Builder
+	imageMutex   sync.Mutex
+	builtImages  map[string]*cachedImage
+	pulledImages map[string]*cachedImage
+
 	// all networks started by a specific test suite, where key
 	// is network name and value is network ID
 	networks     map[TestSuiteID]map[string]string
 	networkMutex sync.RWMutex
 
+	// files uploaded by a specific test suite, keyed by upload ID
+	uploads     map[TestSuiteID]map[string]*upload
+	uploadMutex sync.Mutex
+
 	testCaseMutex     sync.RWMutex
+	nodeIdle          *sync.Cond // signaled when a client is no longer busy
 	testSuiteMutex    sync.RWMutex
 	runningTestSuites map[TestSuiteID]*TestSuite
 	runningTestCases  map[TestID]*TestCase
@@ -77,7 +98,7 @@ type TestManager struct {
 }
 
 func NewTestManager(config SimEnv, b ContainerBackend, testLimiter int) *TestManager {
-	return &TestManager{
+	manager := &TestManager{
 		config:            config,
 		backend:           b,
 		testLimiter:       testLimiter,
@@ -85,7 +106,83 @@ func NewTestManager(config SimEnv, b ContainerBackend, testLimiter int) *TestMan
 		runningTestCases:  make(map[TestID]*TestCase),
 		results:           make(map[TestSuiteID]*TestSuite),
 		networks:          make(map[TestSuiteID]map[string]string),
+		uploads:           make(map[TestSuiteID]map[string]*upload),
+		builtImages:       make(map[string]*cachedImage),
+		pulledImages:      make(map[string]*cachedImage),
+	}
+	manager.nodeIdle = sync.NewCond(&manager.testCaseMutex)
+	return manager
+}
+
+// SetBuilder enables building client images with build arguments requested
+// by the simulator.
+func (manager *TestManager) SetBuilder(b Builder) {
+	manager.imageMutex.Lock()
+	defer manager.imageMutex.Unlock()
+	manager.builder = b
+}
+
+// ClientImage returns the image of a client built with the given build arguments.
+// The image is built only once for each combination of client and arguments.
+func (manager *TestManager) ClientImage(ctx context.Context, client string, args map[string]string) (string, error) {
+	enc, _ := json.Marshal(args) // map keys are sorted
+	builder, entry := manager.imageEntry(manager.builtImages, client+string(enc))
+	if builder == nil {
+		return "", ErrNoBuilder
+	}
+	return entry.get(func() (string, error) {
+		return builder.BuildClientImageWithArgs(ctx, client, args)
+	})
+}
+
+// PullImage ensures that the given image is available, pulling it from its registry
+// if necessary. Each image is pulled at most once.
+func (manager *TestManager) PullImage(ctx context.Context, ref string) error {
+	builder, entry := manager.imageEntry(manager.pulledImages, ref)
+	if builder == nil {
+		return ErrNoBuilder
+	}
+	_, err := entry.get(func() (string, error) {
+		return ref, builder.PullImage(ctx, ref)
+	})
+	return err
+}
+
+// imageEntry returns the builder and the cache entry of an image.
+func (manager *TestManager) imageEntry(images map[string]*cachedImage, key string) (Builder, *cachedImage) {
+	manager.imageMutex.Lock()
+	defer manager.imageMutex.Unlock()
+
+	entry := images[key]
+	if entry == nil {
+		entry = new(cachedImage)
+		images[key] = entry
 	}
+	return manager.builder, entry
+}
+
+// cachedImage is an image which is built or pulled once. Requests for the same image
+// wait for each other, but different images can be created concurrently.
+type cachedImage struct {
+	mu    sync.Mutex
+	image string // set when the image was created successfully
+}
+
+// get returns the image, calling create if it doesn't exist yet. Errors are not cached,
+// so creating the image is attempted again by the next request.
+func (c *cachedImage) get(create func() (string, error)) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.image != "" {
+		return c.image, nil
+	}
+	image, err := create()
+	if err != nil {
+		return "", err
+	}
+	c.image = image
+	return image, nil
 }
 
 // SetSimContainerInfo makes the manager aware of the simulation container.
@@ -174,8 +271,30 @@ func (manager *TestManager) GetNodeInfo(testSuite TestSuiteID, test TestID, node
 	return nodeInfo, nil
 }
 
+// RunningNodes returns copies of the running clients of a test, ordered by start time.
+func (manager *TestManager) RunningNodes(testID TestID) ([]*ClientInfo, error) {
+	manager.testCaseMutex.RLock()
+	defer manager.testCaseMutex.RUnlock()
+
+	testCase, ok := manager.runningTestCases[testID]
+	if !ok {
+		return nil, ErrNoSuchTestCase
+	}
+	nodes := make([]*ClientInfo, 0, len(testCase.ClientInfo))
+	for _, info := range testCase.ClientInfo {
+		if info.wait != nil {
+			cpy := *info
+			nodes = append(nodes, &cpy)
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].InstantiatedAt.Before(nodes[j].InstantiatedAt)
+	})
+	return nodes, nil
+}
+
 // CreateNetwork creates a docker network with the given network name.
-func (manager *TestManager) CreateNetwork(testSuite TestSuiteID, name string) error {
+func (manager *TestManager) CreateNetwork(testSuite TestSuiteID, name string, opt NetworkOptions) error {
 	_, ok := manager.IsTestSuiteRunning(testSuite)
 	if !ok {
 		return ErrNoSuchTestSuite
@@ -185,7 +304,10 @@ func (manager *TestManager) CreateNetwork(testSuite TestSuiteID, name string) er
 	manager.networkMutex.Lock()
 	defer manager.networkMutex.Unlock()
 
-	id, err := manager.backend.CreateNetwork(getUniqueName(testSuite, name))
+	if _, exists := manager.networks[testSuite][name]; exists {
+		return ErrNetworkExists
+	}
+	id, err := manager.backend.CreateNetwork(getUniqueName(testSuite, name), opt)
 	if err != nil {
 		return err
 	}
@@ -197,6 +319,24 @@ func (manager *TestManager) CreateNetwork(testSuite TestSuiteID, name string) er
 	return nil
 }
 
+// Networks returns the names of all networks created by the given test suite.
+func (manager *TestManager) Networks(testSuite TestSuiteID) ([]string, error) {
+	_, ok := manager.IsTestSuiteRunning(testSuite)
+	if !ok {
+		return nil, ErrNoSuchTestSuite
+	}
+
+	manager.networkMutex.RLock()
+	defer manager.networkMutex.RUnlock()
+
+	names := make([]string, 0, len(manager.networks[testSuite]))
+	for name := range manager.networks[testSuite] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
 // getUniqueName returns a unique network name to prevent network collisions
 func getUniqueName(testSuite TestSuiteID, name string) string {
 	return fmt.Sprintf("hive_%d_%d_%s", os.Getpid(), testSuite, name)
@@ -249,22 +389,10 @@ func (manager *TestManager) ContainerIP(testSuite TestSuiteID, networkName, cont
 		containerID = manager.simContainerID
 	}
 
-	var networkID string
-	// networkID "bridge" is special.
-	if networkName == "bridge" {
-		var err error
-		networkID, err = manager.backend.NetworkNameToID(networkName)
-		if err != nil {
-			return "", err
-		}
-	} else {
-		var exists bool
-		networkID, exists = manager.networks[testSuite][networkName]
-		if !exists {
-			return "", ErrNetworkNotFound
-		}
+	networkID, err := manager.networkID(testSuite, networkName)
+	if err != nil {
+		return "", err
 	}
-
 	ipAddr, err := manager.backend.ContainerIP(containerID, networkID)
 	if err != nil {
 		return "", err
@@ -272,8 +400,49 @@ func (manager *TestManager) ContainerIP(testSuite TestSuiteID, networkName, cont
 	return ipAddr.String(), nil
 }
 
-// ConnectContainer connects the given container to the given network.
-func (manager *TestManager) ConnectContainer(testSuite TestSuiteID, networkName, containerID string) error {
+// NetworkIPs returns the IP addresses of all containers on the given network, keyed by
+// container ID. The simulation container is returned with ID "simulation".
+func (manager *TestManager) NetworkIPs(testSuite TestSuiteID, networkName string) (map[string]net.IP, error) {
+	manager.networkMutex.RLock()
+	defer manager.networkMutex.RUnlock()
+
+	_, ok := manager.IsTestSuiteRunning(testSuite)
+	if !ok {
+		return nil, ErrNoSuchTestSuite
+	}
+
+	networkID, err := manager.networkID(testSuite, networkName)
+	if err != nil {
+		return nil, err
+	}
+	ips, err := manager.backend.NetworkIPs(networkID)
+	if err != nil {
+		return nil, err
+	}
+	if ip, ok := ips[manager.simContainerID]; ok && manager.simContainerID != "" {
+		delete(ips, manager.simContainerID)
+		ips["simulation"] = ip
+	}
+	return ips, nil
+}
+
+// networkID resolves the docker network ID of a network. The caller must hold
+// networkMutex.
+func (manager *TestManager) networkID(testSuite TestSuiteID, networkName string) (string, error) {
+	// networkID "bridge" is special.
+	if networkName == "bridge" {
+		return manager.backend.NetworkNameToID(networkName)
+	}
+	networkID, exists := manager.networks[testSuite][networkName]
+	if !exists {
+		return "", ErrNetworkNotFound
+	}
+	return networkID, nil
+}
+
+// ConnectContainer connects the given container to the given network. The container
+// can be reached by the given aliases on the network.
+func (manager *TestManager) ConnectContainer(testSuite TestSuiteID, networkName, containerID string, aliases ...string) error {
 	manager.networkMutex.RLock()
 	defer manager.networkMutex.RUnlock()
 
@@ -289,7 +458,7 @@ func (manager *TestManager) ConnectContainer(testSuite TestSuiteID, networkName,
 	if !exists {
 		return ErrNetworkNotFound
 	}
-	return manager.backend.ConnectContainer(containerID, networkID)
+	return manager.backend.ConnectContainer(containerID, networkID, aliases...)
 }
 
 // DisconnectContainer disconnects the given container from the given network.
@@ -312,6 +481,40 @@ func (manager *TestManager) DisconnectContainer(testSuite TestSuiteID, networkNa
 	return manager.backend.DisconnectContainer(containerID, networkID)
 }
 
+// ShapeNetwork applies traffic shaping to all client containers on the given network.
+// Containers connected to the network later are not affected.
+func (manager *TestManager) ShapeNetwork(ctx context.Context, testSuite TestSuiteID, networkName string, opt NetworkShaping) error {
+	manager.networkMutex.RLock()
+	defer manager.networkMutex.RUnlock()
+
+	_, ok := manager.IsTestSuiteRunning(testSuite)
+	if !ok {
+		return ErrNoSuchTestSuite
+	}
+
+	networkID, err := manager.networkID(testSuite, networkName)
+	if err != nil {
+		return err
+	}
+	ips, err := manager.backend.NetworkIPs(networkID)
+	if err != nil {
+		return err
+	}
+	ids := make([]string, 0, len(ips))
+	for id := range ips {
+		if id != manager.simContainerID {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if err := manager.backend.ShapeContainer(ctx, id, networkID, opt); err != nil {
+			return fmt.Errorf("container %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
 // EndTestSuite ends the test suite by writing the test suite results to the supplied
 // stream and removing the test suite from the running list
 func (manager *TestManager) EndTestSuite(testSuite TestSuiteID) error {
@@ -345,6 +548,7 @@ func (manager *TestManager) doEndSuite(testSuite TestSuiteID) error {
 			log15.Error("could not remove network", "err", err)
 		}
 	}
+	manager.pruneUploads(testSuite)
 	// Move the suite to results.
 	delete(manager.runningTestSuites, testSuite)
 	manager.results[testSuite] = suite
@@ -371,6 +575,11 @@ func (manager *TestManager) StartTestSuite(name string, description string) (Tes
 
 //StartTest starts a new test case, returning the testcase id as a context identifier
 func (manager *TestManager) StartTest(testSuiteID TestSuiteID, name string, description string) (TestID, error) {
+	return manager.StartTestWithLabels(testSuiteID, name, description, nil)
+}
+
+// StartTestWithLabels is like StartTest, but also stores labels with the test case.
+func (manager *TestManager) StartTestWithLabels(testSuiteID TestSuiteID, name, description string, labels map[string]string) (TestID, error) {
 	manager.testCaseMutex.Lock()
 	defer manager.testCaseMutex.Unlock()
 
@@ -390,6 +599,7 @@ func (manager *TestManager) StartTest(testSuiteID TestSuiteID, name string, desc
 	newTestCase := &TestCase{
 		Name:        name,
 		Description: description,
+		Labels:      labels,
 		Start:       time.Now(),
 	}
 	// add the test case to the test suite
@@ -406,7 +616,7 @@ func (manager *TestManager) EndTest(testSuiteRun TestSuiteID, testID TestID, sum
 	defer manager.testCaseMutex.Unlock()
 
 	// Check if the test case is running
-	testCase, ok := manager.runningTestCases[testID]
+	testCase, ok := manager.idleTestCase(testID)
 	if !ok {
 		return ErrNoSuchTestCase
 	}
@@ -418,6 +628,11 @@ func (manager *TestManager) EndTest(testSuiteRun TestSuiteID, testID TestID, sum
 	// Add the results to the test case
 	testCase.End = time.Now()
 	testCase.SummaryResult = *summaryResult
+	if testCase.outputDir != "" {
+		if err := manager.addOutputFiles(testCase); err != nil {
+			log15.Error("could not list test output files", "test", testID, "err", err)
+		}
+	}
 
 	// Stop running clients.
 	for _, v := range testCase.ClientInfo {
@@ -433,6 +648,86 @@ func (manager *TestManager) EndTest(testSuiteRun TestSuiteID, testID TestID, sum
 	return nil
 }
 
+// AddTestAttachment records a file attached to the result of a running test case.
+// The path is relative to the log directory.
+func (manager *TestManager) AddTestAttachment(testID TestID, name, path string) error {
+	manager.testCaseMutex.Lock()
+	defer manager.testCaseMutex.Unlock()
+
+	testCase, ok := manager.runningTestCases[testID]
+	if !ok {
+		return ErrNoSuchTestCase
+	}
+	if testCase.Attachments == nil {
+		testCase.Attachments = make(map[string]string)
+	}
+	testCase.Attachments[name] = path
+	return nil
+}
+
+// TestOutputDir returns the output directory of a running test case, creating it on
+// first use. Files written to the directory by the simulator are attached to the test
+// result when the test ends. The path is relative to the log directory.
+func (manager *TestManager) TestOutputDir(testSuite TestSuiteID, testID TestID) (string, error) {
+	manager.testCaseMutex.Lock()
+	defer manager.testCaseMutex.Unlock()
+
+	testCase, ok := manager.runningTestCases[testID]
+	if !ok {
+		return "", ErrNoSuchTestCase
+	}
+	if testCase.outputDir != "" {
+		return testCase.outputDir, nil
+	}
+	dir := path.Join("outputs", fmt.Sprintf("%d-%d-%d", time.Now().Unix(), testSuite, testID))
+	if err := os.MkdirAll(filepath.Join(manager.config.LogDir, filepath.FromSlash(dir)), 0777); err != nil {
+		return "", err
+	}
+	testCase.outputDir = dir
+	return dir, nil
+}
+
+// addOutputFiles attaches the files in the output directory of a test case to its
+// result. Attachments sent with the result take precedence over output files with
+// the same name.
+func (manager *TestManager) addOutputFiles(testCase *TestCase) error {
+	root := filepath.Join(manager.config.LogDir, filepath.FromSlash(testCase.outputDir))
+	return filepath.Walk(root, func(file string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(root, file)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if testCase.Attachments == nil {
+			testCase.Attachments = make(map[string]string)
+		}
+		if _, ok := testCase.Attachments[name]; !ok {
+			testCase.Attachments[name] = path.Join(testCase.outputDir, name)
+		}
+		return nil
+	})
+}
+
+// AddSuiteAttachment records a file attached to a running test suite. The path is
+// relative to the log directory.
+func (manager *TestManager) AddSuiteAttachment(testSuite TestSuiteID, name, path string) error {
+	manager.testSuiteMutex.Lock()
+	defer manager.testSuiteMutex.Unlock()
+
+	suite, ok := manager.runningTestSuites[testSuite]
+	if !ok {
+		return ErrNoSuchTestSuite
+	}
+	if suite.Attachments == nil {
+		suite.Attachments = make(map[string]string)
+	}
+	suite.Attachments[name] = path
+	return nil
+}
+
 // RegisterNode is used by test suite hosts to register the creation of a node in the context of a test
 func (manager *TestManager) RegisterNode(testID TestID, nodeID string, nodeInfo *ClientInfo) error {
 	manager.testCaseMutex.Lock()
@@ -450,28 +745,284 @@ func (manager *TestManager) RegisterNode(testID TestID, nodeID string, nodeInfo
 	return nil
 }
 
-// StopNode stops a client container.
-func (manager *TestManager) StopNode(testID TestID, nodeID string) error {
+// StopNode stops a client container. It returns the state of the container before it
+// was stopped, so callers can tell whether the client had already exited. The state is
+// nil if it could not be determined.
+func (manager *TestManager) StopNode(testID TestID, nodeID string) (*ContainerState, error) {
+	return manager.stopNode(context.Background(), testID, nodeID, nil)
+}
+
+// StopNodeGracefully stops a client container, giving the client time to shut down
+// after receiving the signal in opt.
+func (manager *TestManager) StopNodeGracefully(ctx context.Context, testID TestID, nodeID string, opt StopOptions) (*ContainerState, error) {
+	return manager.stopNode(ctx, testID, nodeID, &opt)
+}
+
+func (manager *TestManager) stopNode(ctx context.Context, testID TestID, nodeID string, opt *StopOptions) (*ContainerState, error) {
+	manager.testCaseMutex.Lock()
+	testCase, ok := manager.runningTestCases[testID]
+	if !ok {
+		manager.testCaseMutex.Unlock()
+		return nil, ErrNoSuchNode
+	}
+	nodeInfo, ok := testCase.ClientInfo[nodeID]
+	if !ok {
+		manager.testCaseMutex.Unlock()
+		return nil, ErrNoSuchNode
+	}
+	if nodeInfo.wait == nil {
+		// The state is kept for repeated stop requests.
+		state := nodeInfo.stopState
+		manager.testCaseMutex.Unlock()
+		return state, nil
+	}
+	if nodeInfo.busy {
+		manager.testCaseMutex.Unlock()
+		return nil, ErrNodeBusy
+	}
+	nodeInfo.busy = true
+	wait := nodeInfo.wait
+	manager.testCaseMutex.Unlock()
+
+	// The lock is not held while stopping because a graceful stop can take a long time.
+	state, err := manager.stopContainer(ctx, nodeInfo.ID, opt)
+	if err == nil {
+		wait()
+	}
+
 	manager.testCaseMutex.Lock()
 	defer manager.testCaseMutex.Unlock()
+	manager.releaseNode(nodeInfo)
+	if err != nil {
+		return nil, err
+	}
+	nodeInfo.wait = nil
+	nodeInfo.stopState = state
+	return state, nil
+}
+
+// stopContainer stops and deletes a client container. It returns the state of the
+// container before it was stopped, or nil if the state is unknown.
+func (manager *TestManager) stopContainer(ctx context.Context, containerID string, opt *StopOptions) (*ContainerState, error) {
+	// The state is informational only, so failing to get it doesn't prevent the stop.
+	state, err := manager.backend.ContainerState(ctx, containerID)
+	if err != nil {
+		log15.Error("could not get client state", "container", containerID, "err", err)
+		state = nil
+	}
+	if opt != nil && (state == nil || state.Running) {
+		if err := manager.backend.StopContainer(ctx, containerID, *opt); err != nil {
+			return nil, fmt.Errorf("unable to stop client: %v", err)
+		}
+	}
+	if err := manager.backend.DeleteContainer(containerID); err != nil {
+		return nil, fmt.Errorf("unable to stop client: %v", err)
+	}
+	return state, nil
+}
+
+// NodeState returns the state of a client container's main process. This can be used to
+// check whether a client has exited unexpectedly. It returns ErrNodeStopped for clients
+// which were stopped by the simulation.
+func (manager *TestManager) NodeState(ctx context.Context, testID TestID, nodeID string) (*ContainerState, error) {
+	manager.testCaseMutex.RLock()
+	defer manager.testCaseMutex.RUnlock()
 
 	testCase, ok := manager.runningTestCases[testID]
 	if !ok {
-		return ErrNoSuchNode
+		return nil, ErrNoSuchNode
 	}
 	nodeInfo, ok := testCase.ClientInfo[nodeID]
 	if !ok {
-		return ErrNoSuchNode
+		return nil, ErrNoSuchNode
+	}
+	if nodeInfo.wait == nil {
+		return nil, ErrNodeStopped
+	}
+	state, err := manager.backend.ContainerState(ctx, nodeInfo.ID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get client state: %v", err)
+	}
+	return state, nil
+}
+
+// StopAllNodes stops all running clients of a test. Failing to stop a client does not
+// prevent stopping the others. The errors of clients which could not be stopped are
+// returned, keyed by node ID.
+func (manager *TestManager) StopAllNodes(testID TestID) (map[string]error, error) {
+	manager.testCaseMutex.Lock()
+	defer manager.testCaseMutex.Unlock()
+
+	testCase, ok := manager.idleTestCase(testID)
+	if !ok {
+		return nil, ErrNoSuchTestCase
 	}
-	// Stop the container.
-	if nodeInfo.wait != nil {
+	failed := make(map[string]error)
+	for nodeID, nodeInfo := range testCase.ClientInfo {
+		if nodeInfo.wait == nil {
+			continue
+		}
 		if err := manager.backend.DeleteContainer(nodeInfo.ID); err != nil {
-			return fmt.Errorf("unable to stop client: %v", err)
+			failed[nodeID] = fmt.Errorf("unable to stop client: %v", err)
+			continue
 		}
 		nodeInfo.wait()
 		nodeInfo.wait = nil
 	}
-	return nil
+	return failed, nil
+}
+
+// RestartNode restarts a client container. The container keeps its filesystem,
+// but may be assigned a new IP address.
+func (manager *TestManager) RestartNode(ctx context.Context, testID TestID, nodeID string) (*ClientInfo, error) {
+	return manager.restartNode(ctx, testID, nodeID, nil)
+}
+
+// ReconfigureNode restarts a client container with the given environment variables.
+// The variables are written to the environment file of the container, which is loaded
+// when the client starts. Variables set by earlier calls are kept unless overridden.
+func (manager *TestManager) ReconfigureNode(ctx context.Context, testID TestID, nodeID string, env map[string]string) (*ClientInfo, error) {
+	return manager.restartNode(ctx, testID, nodeID, func(nodeInfo *ClientInfo) error {
+		if nodeInfo.envFile == "" {
+			return ErrNodeNotReconfigurable
+		}
+		merged := make(map[string]string, len(nodeInfo.env)+len(env))
+		for key, val := range nodeInfo.env {
+			merged[key] = val
+		}
+		for key, val := range env {
+			merged[key] = val
+		}
+		archive, err := fileArchive(nodeInfo.envFile, 0644, envFileContent(merged))
+		if err != nil {
+			return err
+		}
+		if err := manager.backend.UploadArchive(ctx, nodeInfo.ID, "/", archive); err != nil {
+			return fmt.Errorf("can't write environment file: %v", err)
+		}
+		nodeInfo.env = merged
+		return nil
+	})
+}
+
+// envFileContent encodes environment variables as shell assignments.
+func envFileContent(env map[string]string) []byte {
+	keys := make([]string, 0, len(env))
+	for key := range env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, key := range keys {
+		b.WriteString(key + "='" + strings.ReplaceAll(env[key], "'", `'\''`) + "'\n")
+	}
+	return []byte(b.String())
+}
+
+// restartNode restarts a client container. If prepare is non-nil, it is called
+// before the container is stopped. The restart is aborted if prepare fails.
+func (manager *TestManager) restartNode(ctx context.Context, testID TestID, nodeID string, prepare func(*ClientInfo) error) (*ClientInfo, error) {
+	nodeInfo, err := manager.reserveNode(testID, nodeID)
+	if err != nil {
+		return nil, err
+	}
+	if prepare != nil {
+		if err := prepare(nodeInfo); err != nil {
+			manager.testCaseMutex.Lock()
+			manager.releaseNode(nodeInfo)
+			manager.testCaseMutex.Unlock()
+			return nil, err
+		}
+	}
+	opt := ContainerOptions{CheckLive: nodeInfo.checkLive}
+	if nodeInfo.LogFile != "" {
+		opt.LogFile = filepath.Join(manager.config.LogDir, filepath.FromSlash(nodeInfo.LogFile))
+	}
+
+	// The lock is not held while restarting because this can take a long time.
+	info, err := manager.backend.RestartContainer(ctx, nodeInfo.ID, opt)
+
+	manager.testCaseMutex.Lock()
+	defer manager.testCaseMutex.Unlock()
+	manager.releaseNode(nodeInfo)
+	if nodeInfo.wait == nil {
+		// The client was stopped while restarting. Teardowns wait for busy clients, so
+		// this shouldn't happen, but make sure the restarted container doesn't leak.
+		if info != nil && info.Wait != nil {
+			manager.backend.DeleteContainer(nodeInfo.ID)
+			info.Wait()
+		}
+		return nil, ErrNodeStopped
+	}
+	if errors.Is(err, ErrContainerNotStopped) {
+		// The previous instance is still running.
+		return nil, fmt.Errorf("unable to restart client: %v", err)
+	}
+
+	// The previous instance of the container is gone at this point.
+	nodeInfo.wait()
+	nodeInfo.wait = nil
+	if info != nil && info.Wait != nil {
+		nodeInfo.IP = info.IP
+		nodeInfo.wait = info.Wait
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to restart client: %v", err)
+	}
+	return nodeInfo, nil
+}
+
+// reserveNode marks a running client as busy, so it can be restarted without holding
+// the lock. The caller must release the client using releaseNode when done. Busy clients
+// can't be stopped or restarted by other requests, and the test waits for them to become
+// idle before its clients are torn down.
+func (manager *TestManager) reserveNode(testID TestID, nodeID string) (*ClientInfo, error) {
+	manager.testCaseMutex.Lock()
+	defer manager.testCaseMutex.Unlock()
+
+	testCase, ok := manager.runningTestCases[testID]
+	if !ok {
+		return nil, ErrNoSuchNode
+	}
+	nodeInfo, ok := testCase.ClientInfo[nodeID]
+	if !ok {
+		return nil, ErrNoSuchNode
+	}
+	if nodeInfo.wait == nil {
+		return nil, ErrNodeStopped
+	}
+	if nodeInfo.busy {
+		return nil, ErrNodeBusy
+	}
+	nodeInfo.busy = true
+	return nodeInfo, nil
+}
+
+// releaseNode clears the busy flag of a client and wakes up requests waiting for it.
+// It must be called with the lock held.
+func (manager *TestManager) releaseNode(nodeInfo *ClientInfo) {
+	nodeInfo.busy = false
+	manager.nodeIdle.Broadcast()
+}
+
+// idleTestCase returns a running test case once none of its clients are busy. It must
+// be called with the lock held, which is released while waiting. Clients are torn down
+// only when idle because stopNode and RestartNode work on them without the lock.
+func (manager *TestManager) idleTestCase(testID TestID) (*TestCase, bool) {
+	for {
+		testCase, ok := manager.runningTestCases[testID]
+		if !ok {
+			return nil, false
+		}
+		busy := false
+		for _, nodeInfo := range testCase.ClientInfo {
+			busy = busy || nodeInfo.busy
+		}
+		if !busy {
+			return testCase, true
+		}
+		manager.nodeIdle.Wait()
+	}
 }
 
 // writeSuiteFile writes the simulation result to the log directory.
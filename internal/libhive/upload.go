@@ -0,0 +1,147 @@
+package libhive
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"gopkg.in/inconshreveable/log15.v2"
+)
+
+var (
+	ErrNoSuchUpload = errors.New("no such upload")
+	ErrUploadOffset = errors.New("upload offset does not match received size")
+)
+
+// upload is a file uploaded by the simulator in multiple requests. Data can only be
+// appended at the end of the file, so an interrupted upload can be resumed by sending
+// the data following the received size.
+type upload struct {
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// CreateUpload creates an upload session in the given test suite and returns its ID.
+// Uploads are removed when the test suite ends.
+func (manager *TestManager) CreateUpload(testSuite TestSuiteID) (string, error) {
+	if _, ok := manager.IsTestSuiteRunning(testSuite); !ok {
+		return "", ErrNoSuchTestSuite
+	}
+	file, err := ioutil.TempFile("", "hive-upload-")
+	if err != nil {
+		return "", err
+	}
+	idBytes := make([]byte, 8)
+	rand.Read(idBytes)
+	id := hex.EncodeToString(idBytes)
+
+	manager.uploadMutex.Lock()
+	defer manager.uploadMutex.Unlock()
+	if manager.uploads[testSuite] == nil {
+		manager.uploads[testSuite] = make(map[string]*upload)
+	}
+	manager.uploads[testSuite][id] = &upload{file: file}
+	return id, nil
+}
+
+// getUpload returns the upload with the given ID.
+func (manager *TestManager) getUpload(testSuite TestSuiteID, id string) (*upload, error) {
+	manager.uploadMutex.Lock()
+	defer manager.uploadMutex.Unlock()
+	u, ok := manager.uploads[testSuite][id]
+	if !ok {
+		return nil, ErrNoSuchUpload
+	}
+	return u, nil
+}
+
+// UploadSize returns the number of bytes received for an upload.
+func (manager *TestManager) UploadSize(testSuite TestSuiteID, id string) (int64, error) {
+	u, err := manager.getUpload(testSuite, id)
+	if err != nil {
+		return 0, err
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.size, nil
+}
+
+// AppendUpload adds the content of r to an upload. The offset must be equal to the
+// number of bytes received so far, otherwise ErrUploadOffset is returned. If reading r
+// fails, the data received until then is kept. AppendUpload returns the new size.
+func (manager *TestManager) AppendUpload(testSuite TestSuiteID, id string, offset int64, r io.Reader) (int64, error) {
+	u, err := manager.getUpload(testSuite, id)
+	if err != nil {
+		return 0, err
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.file == nil {
+		return 0, ErrNoSuchUpload
+	}
+	if offset != u.size {
+		return u.size, ErrUploadOffset
+	}
+	n, err := io.Copy(u.file, r)
+	u.size += n
+	return u.size, err
+}
+
+// OpenUpload returns a reader for the content of an upload. The reader must be
+// closed by the caller.
+func (manager *TestManager) OpenUpload(testSuite TestSuiteID, id string) (io.ReadCloser, error) {
+	u, err := manager.getUpload(testSuite, id)
+	if err != nil {
+		return nil, err
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.file == nil {
+		return nil, ErrNoSuchUpload
+	}
+	return os.Open(u.file.Name())
+}
+
+// RemoveUpload deletes an upload.
+func (manager *TestManager) RemoveUpload(testSuite TestSuiteID, id string) error {
+	manager.uploadMutex.Lock()
+	u, ok := manager.uploads[testSuite][id]
+	delete(manager.uploads[testSuite], id)
+	manager.uploadMutex.Unlock()
+	if !ok {
+		return ErrNoSuchUpload
+	}
+	return u.remove()
+}
+
+// pruneUploads deletes all uploads of a test suite.
+func (manager *TestManager) pruneUploads(testSuite TestSuiteID) {
+	manager.uploadMutex.Lock()
+	uploads := manager.uploads[testSuite]
+	delete(manager.uploads, testSuite)
+	manager.uploadMutex.Unlock()
+
+	for id, u := range uploads {
+		if err := u.remove(); err != nil {
+			log15.Error("could not remove upload", "id", id, "err", err)
+		}
+	}
+}
+
+// remove closes and deletes the file of the upload.
+func (u *upload) remove() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.file == nil {
+		return nil
+	}
+	u.file.Close()
+	err := os.Remove(u.file.Name())
+	u.file = nil
+	return err
+}